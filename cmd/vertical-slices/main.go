@@ -1,27 +1,154 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/config"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/shared/keys"
 )
 
 func main() {
+	// Load the settings from the config file, the environment and the flags
+	c, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("configuration:\n%s", c)
+
+	err = run(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the API until SIGINT or SIGTERM, and then shuts down gracefully.
+func run(c config.Config) error {
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Configure the API routes
 	router := chi.NewMux()
-	api := humachi.New(router, huma.DefaultConfig("My API", "1.0.0"))
+	router.Use(correlate)
+	api := humachi.New(router, huma.DefaultConfig(c.Server.Title, c.Server.Version))
 
 	// Configure the application
-	c := &config.Config{}
-	config.WireInfra(c)
-	config.WireRepositories(c)
-	config.WireProductEventHandlers(c)
-	config.WireProductAPI(c, api)
-	config.WireOrderAPI(c, api)
+	reg := module.NewRegistry(append(config.Modules(c), module.Supply(keys.API, api))...)
+	// the modules run until they are stopped, not until a signal arrives
+	ctx := context.Background()
+	err := reg.Init(ctx)
+	if err != nil {
+		return errors.Join(err, reg.Stop(ctx))
+	}
+	// Expose the stats of the handlers, among other runtime variables
+	router.Handle("/debug/vars", requireToken(c.Server.DebugToken, expvar.Handler()))
+
+	// Run the background work of the modules, eg: the outbox relay
+	err = reg.Start(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Start the server!
-	http.ListenAndServe("127.0.0.1:8888", router)
+	srv := &http.Server{Handler: router}
+	ln, err := net.Listen("tcp", c.Server.Addr)
+	if err != nil {
+		return errors.Join(err, reg.Stop(ctx))
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+	log.Printf("listening on %s", ln.Addr())
+
+	var serveErr error
+	select {
+	case <-signals.Done():
+		// a second signal kills the process
+		stop()
+		log.Printf("shutting down, within %s", c.Server.ShutdownTimeout)
+	case err := <-served:
+		serveErr = fmt.Errorf("serving HTTP: %w", err)
+		log.Printf("%v, shutting down", serveErr)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Server.ShutdownTimeout)
+	defer cancel()
+	err = shutdown(ctx, srv, reg)
+	if err != nil {
+		return errors.Join(serveErr, fmt.Errorf("shutting down: %w", err))
+	}
+	log.Print("shut down")
+	return serveErr
+}
+
+// shutdown stops accepting requests and waits for the ones in flight,
+// then drains the work taken by the modules, eg: the queued events, and stops them.
+func shutdown(ctx context.Context, srv *http.Server, reg *module.Registry) error {
+	var errs []error
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("stopping HTTP server: %w", err))
+	}
+	err = reg.Stop(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// correlationHeader carries the ID correlating the requests, and the events following from them, across services
+const correlationHeader = "X-Correlation-ID"
+
+// correlate makes the events emitted while serving the request caused by it, with an ID of its own,
+// and correlated by the ID in the correlation header, or by the ID of the request if there is none.
+// The correlation ID is returned in the header of the response.
+func correlate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := uuid.NewString()
+		correlationID := r.Header.Get(correlationHeader)
+		// the header is the client's, so its size is bounded
+		if correlationID == "" || len(correlationID) > 128 {
+			correlationID = requestID
+		}
+
+		w.Header().Set(correlationHeader, correlationID)
+		ctx := eventbus.WithCause(r.Context(), correlationID, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireToken only lets through the requests with the bearer token, if there is one.
+func requireToken(token config.Secret, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + string(token))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
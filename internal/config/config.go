@@ -1,60 +1,191 @@
 package config
 
 import (
-	"github.com/danielgtaylor/huma/v2"
-	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+	"github.com/quintans/vertical-slices/internal/shared/keys"
+
+	"github.com/quintans/vertical-slices/internal/features/deadletters"
 	"github.com/quintans/vertical-slices/internal/features/orders"
 	ordCmd "github.com/quintans/vertical-slices/internal/features/orders/commands"
-	ordQry "github.com/quintans/vertical-slices/internal/features/orders/queries"
+	ordDom "github.com/quintans/vertical-slices/internal/features/orders/domain"
+	ordPrj "github.com/quintans/vertical-slices/internal/features/orders/projections"
+	ordRead "github.com/quintans/vertical-slices/internal/features/orders/readmodel"
+	"github.com/quintans/vertical-slices/internal/features/placeorder"
 	"github.com/quintans/vertical-slices/internal/features/products"
 	prdCmd "github.com/quintans/vertical-slices/internal/features/products/commands"
-	"github.com/quintans/vertical-slices/internal/features/products/eventhandlers"
-	prdQry "github.com/quintans/vertical-slices/internal/features/products/queries"
+	prdDom "github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/features/projections"
 )
 
-type Config struct {
-	Infra
-	Repositories
+// Modules returns the modules of the application, in no particular order since the registry orders them by their dependencies.
+// A new slice only has to be added here.
+func Modules(c Config) []module.Module {
+	return []module.Module{
+		newInfraModule(c.Storage, c.Events),
+		products.NewModule(c.Storage, c.Reservations.SweepInterval),
+		orders.NewModule(c.Storage, c.Orders),
+		deadletters.NewModule(),
+		projections.NewModule(),
+		placeorder.NewModule(c.Reservations.TTL, c.Reservations.SweepInterval),
+		newOrderPolicyModule(c.Reservations.TTL),
+		newPlaceOrderAdaptersModule(),
+		newProductCatalogModule(),
+	}
+}
+
+// bridge is a module adapting what a slice provides to what another one requires,
+// so that the slices do not depend on each other.
+type bridge struct {
+	name     string
+	provides []string
+	requires []string
+	init     func(c *module.Container)
+}
+
+func (b bridge) Name() string {
+	return b.name
+}
+
+func (b bridge) Provides() []string {
+	return b.provides
 }
 
-type Infra struct {
-	EventBus *eventbus.Bus
+func (b bridge) Requires() []string {
+	return b.requires
 }
 
-type Repositories struct {
-	ProductsRepo *products.Repo
-	OrdersRepo   *orders.Repo
+func (b bridge) Init(_ context.Context, c *module.Container) error {
+	b.init(c)
+	return nil
 }
 
-func WireInfra(c *Config) {
-	eb := eventbus.New()
-	c.Infra = Infra{
-		EventBus: eb,
+// newOrderPolicyModule lets the orders slice reserve stock in the products slice, for ttl.
+func newOrderPolicyModule(ttl time.Duration) module.Module {
+	return bridge{
+		name:     "order-policy",
+		provides: []string{orders.CreateOrderPolicyKey.Name()},
+		requires: []string{products.RepositoryKey.Name()},
+		init: func(c *module.Container) {
+			repo := module.Get(c, products.RepositoryKey)
+			module.Provide[ordDom.CreateOrderPolicy](c, orders.CreateOrderPolicyKey, orderPolicy{
+				Repository: repo,
+				reserve:    prdCmd.NewReserveStockHandler(repo, ttl),
+			})
+		},
 	}
 }
 
-func WireRepositories(c *Config) {
-	c.Repositories = Repositories{
-		ProductsRepo: products.NewRepository(),
-		OrdersRepo:   orders.NewRepository(c.EventBus),
+// orderPolicy lets the orders slice reserve stock in the products slice
+type orderPolicy struct {
+	products.Repository
+	reserve func(ctx context.Context, cmd *prdCmd.ReserveStockCommand) error
+}
+
+func (p orderPolicy) ReserveStock(ctx context.Context, orderID, productID uuid.UUID, quantity int) error {
+	err := p.reserve(ctx, &prdCmd.ReserveStockCommand{
+		ProductID: productID,
+		OrderID:   orderID,
+		Quantity:  quantity,
+	})
+	if errors.Is(err, prdDom.ErrInsufficientStock) {
+		return fmt.Errorf("%d units not available: %w", quantity, ordDom.ErrInsufficientStock)
 	}
+	return err
 }
 
-func WireProductEventHandlers(c *Config) {
-	eventbus.Register(c.EventBus, eventhandlers.NewOrderCreatedHandler(c.ProductsRepo))
+// newProductCatalogModule lets the order views show the products of the products slice.
+func newProductCatalogModule() module.Module {
+	return bridge{
+		name:     "product-catalog",
+		provides: []string{orders.ProductCatalogKey.Name()},
+		requires: []string{products.RepositoryKey.Name()},
+		init: func(c *module.Container) {
+			module.Provide[ordPrj.Catalog](c, orders.ProductCatalogKey, productCatalog{
+				repo: module.Get(c, products.RepositoryKey),
+			})
+		},
+	}
 }
 
-func WireProductAPI(c *Config, api huma.API) {
-	prdCmd.RegisterCreateProductController(api, c.ProductsRepo)
-	prdCmd.RegisterDeleteProductController(api, c.ProductsRepo)
-	prdQry.RegisterGetProductController(api, c.ProductsRepo)
-	prdQry.RegisterListProductsController(api, c.ProductsRepo)
+// productCatalog lists the products of the products slice for the order views
+type productCatalog struct {
+	repo products.Repository
 }
 
-func WireOrderAPI(c *Config, api huma.API) {
-	ordCmd.RegisterCreateOrderController(api, c.OrdersRepo, c.ProductsRepo)
-	ordCmd.RegisterDeleteOrderController(api, c.OrdersRepo)
-	ordQry.RegisterGetOrderController(api, c.OrdersRepo)
-	ordQry.RegisterListOrdersController(api, c.OrdersRepo)
+func (p productCatalog) ListProducts(ctx context.Context) ([]ordRead.ProductView, error) {
+	list, err := p.repo.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]ordRead.ProductView, 0, len(list))
+	for _, prd := range list {
+		views = append(views, ordRead.ProductView{
+			ID:   prd.ID(),
+			SKU:  prd.SKU(),
+			Name: prd.Name(),
+		})
+	}
+	return views, nil
+}
+
+// newPlaceOrderAdaptersModule lets the place order saga take stock in the products slice and cancel orders in the orders slice.
+func newPlaceOrderAdaptersModule() module.Module {
+	return bridge{
+		name:     "place-order-adapters",
+		provides: []string{placeorder.InventoryKey.Name(), placeorder.OrdersKey.Name()},
+		requires: []string{products.RepositoryKey.Name(), orders.RepositoryKey.Name(), keys.Idempotency.Name()},
+		init: func(c *module.Container) {
+			module.Provide[placeorder.Inventory](c, placeorder.InventoryKey, inventory{
+				take: prdCmd.NewTakeReservedStockHandler(module.Get(c, products.RepositoryKey), module.Get(c, keys.Idempotency)),
+			})
+			module.Provide[placeorder.Orders](c, placeorder.OrdersKey, orderCanceller{
+				cancel: ordCmd.NewCancelOrderHandler(module.Get(c, orders.RepositoryKey)),
+			})
+		},
+	}
+}
+
+// inventory lets the place order saga take stock in the products slice
+type inventory struct {
+	take func(ctx context.Context, cmd *prdCmd.TakeReservedStockCommand) error
+}
+
+func (i inventory) TakeStock(ctx context.Context, orderID uuid.UUID, lines []events.OrderLine) error {
+	cmd := &prdCmd.TakeReservedStockCommand{OrderID: orderID}
+	for _, l := range lines {
+		cmd.Lines = append(cmd.Lines, prdCmd.TakeReservedStockLine{
+			ProductID: l.ProductID,
+			Quantity:  l.Quantity,
+		})
+	}
+
+	err := i.take(ctx, cmd)
+	if errors.Is(err, prdDom.ErrInsufficientStock) || errors.Is(err, prdDom.ErrStockReturned) {
+		return fmt.Errorf("%w: %w", placeorder.ErrStockUnavailable, err)
+	}
+	return err
+}
+
+// orderCanceller lets the place order saga cancel orders in the orders slice
+type orderCanceller struct {
+	cancel func(ctx context.Context, cmd *ordCmd.CancelOrderCommand) error
+}
+
+func (o orderCanceller) CancelOrder(ctx context.Context, id uuid.UUID) error {
+	err := o.cancel(ctx, &ordCmd.CancelOrderCommand{ID: id})
+	if errors.Is(err, ordDom.ErrInvalidTransition) {
+		// already cancelled, or it moved on and can no longer be cancelled
+		slog.WarnContext(ctx, "order not cancelled", "order", id, "error", err)
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/idempotency"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/lib/outbox"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/lib/problem"
+	"github.com/quintans/vertical-slices/internal/lib/projection"
+	"github.com/quintans/vertical-slices/internal/lib/saga"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+	"github.com/quintans/vertical-slices/internal/shared"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+	"github.com/quintans/vertical-slices/internal/shared/keys"
+)
+
+// infraModule provides the infrastructure shared by the slices, and publishes the events stored in the outbox.
+type infraModule struct {
+	storage infra.Storage
+	events  Events
+
+	db         *sql.DB
+	journal    *infra.Journal
+	bus        *eventbus.Bus
+	relay      *outbox.Relay
+	background module.Background
+}
+
+func newInfraModule(storage infra.Storage, events Events) *infraModule {
+	return &infraModule{
+		storage: storage,
+		events:  events,
+	}
+}
+
+func (m *infraModule) Name() string {
+	return "infra"
+}
+
+func (m *infraModule) Provides() []string {
+	provides := []string{
+		keys.Errors.Name(),
+		keys.Mediator.Name(),
+		keys.EventBus.Name(),
+		keys.Outbox.Name(),
+		keys.Idempotency.Name(),
+		keys.SagaStore.Name(),
+		keys.Projections.Name(),
+		keys.Checkpoint.Name(),
+	}
+	switch m.storage.Backend {
+	case infra.BackendSQLite:
+		provides = append(provides, keys.SQL.Name())
+	case infra.BackendFile:
+		provides = append(provides, keys.Journal.Name())
+	}
+	return provides
+}
+
+func (m *infraModule) Requires() []string {
+	return nil
+}
+
+func (m *infraModule) Init(ctx context.Context, c *module.Container) error {
+	// the slices map their own errors when they are initialised
+	errs := problem.NewMapper()
+	errs.Map(fails.ErrNotFound, http.StatusNotFound, "not_found")
+	errs.Map(fails.ErrAlreadyExists, http.StatusConflict, "already_exists")
+	errs.Map(infra.ErrUniquenessViolation, http.StatusConflict, "already_exists")
+	// a change that conflicted with another one on commit, and is not retried anymore, is told apart from a failed If-Match
+	errs.Map(fails.ErrConcurrencyConflict, http.StatusConflict, "concurrency_conflict")
+	errs.Map(fails.ErrPreconditionFailed, http.StatusPreconditionFailed, "precondition_failed")
+	errs.Map(etag.ErrInvalid, http.StatusBadRequest, "invalid_etag")
+	errs.Map(mediator.ErrInvalid, http.StatusUnprocessableEntity, "invalid_request")
+	errs.Map(mediator.ErrForbidden, http.StatusForbidden, "forbidden")
+	errs.Map(page.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor")
+	errs.Map(page.ErrInvalidSort, http.StatusBadRequest, "invalid_sort")
+	errs.Map(projection.ErrLagging, http.StatusServiceUnavailable, "lagging")
+	errs.Install()
+	module.Provide(c, keys.Errors, errs)
+
+	med := mediator.New()
+	stats := mediator.NewStats()
+	med.Use(
+		mediator.Logging(slog.Default()),
+		mediator.Metrics(stats),
+		mediator.Validation(),
+		// a conflicting change detected on commit is retried, but not a version that no longer matches the one in If-Match
+		mediator.Retry(3, 20*time.Millisecond, func(err error) bool {
+			return errors.Is(err, uow.ErrPrepare) && errors.Is(err, fails.ErrConcurrencyConflict)
+		}),
+		mediator.Transaction(),
+	)
+	expvar.Publish("handlers", expvar.Func(func() any {
+		return stats.Snapshot()
+	}))
+	module.Provide(c, keys.Mediator, med)
+
+	if m.storage.Backend != infra.BackendMemory {
+		err := os.MkdirAll(m.storage.DataDir, 0o755)
+		if err != nil {
+			return fmt.Errorf("creating data dir: %w", err)
+		}
+	}
+	switch m.storage.Backend {
+	case infra.BackendSQLite:
+		var err error
+		m.db, err = infra.OpenSQLite(filepath.Join(m.storage.DataDir, "data.db"))
+		if err != nil {
+			return err
+		}
+		module.Provide(c, keys.SQL, m.db)
+	case infra.BackendFile:
+		// a single journal, so that the changes of a unit of work are written together
+		var err error
+		m.journal, err = infra.OpenJournal(m.storage.DataDir, m.storage.File)
+		if err != nil {
+			return err
+		}
+		module.Provide(c, keys.Journal, m.journal)
+	}
+
+	deadLetters, err := m.newDeadLetters(ctx)
+	if err != nil {
+		return err
+	}
+	busOptions := []eventbus.Option{
+		eventbus.WithDeadLetters(deadLetters),
+		eventbus.WithQueueSize(m.events.Bus.QueueSize),
+		eventbus.WithWorkers(m.events.Bus.Workers),
+		eventbus.WithOverflow(m.events.Bus.Overflow),
+	}
+	if m.events.Bus.Mode == BusAsync {
+		busOptions = append(busOptions, eventbus.WithAsyncHandlers())
+	}
+	bus := eventbus.New(busOptions...)
+	m.bus = bus
+	module.Provide(c, keys.EventBus, bus)
+	module.Provide(c, keys.Projections, projection.NewRegistry())
+
+	stores, err := m.newStores(ctx)
+	if err != nil {
+		return err
+	}
+	m.relay = m.newRelay(stores.outbox, bus)
+	module.Provide[shared.Outbox](c, keys.Outbox, stores.outbox)
+	module.Provide[projection.Checkpoint](c, keys.Checkpoint, m.relay)
+	module.Provide(c, keys.Idempotency, stores.idempotency)
+	module.Provide(c, keys.SagaStore, stores.sagas)
+	return nil
+}
+
+// stores holds the stores written in the same unit of work as the aggregates
+type stores struct {
+	outbox      outbox.Store
+	idempotency idempotency.Store
+	sagas       saga.Store
+}
+
+// newStores returns the stores of the storage backend, kept with the aggregates, so that they are all written together
+func (m *infraModule) newStores(ctx context.Context) (stores, error) {
+	var (
+		s   stores
+		err error
+	)
+	switch m.storage.Backend {
+	case infra.BackendSQLite:
+		s.outbox, err = infra.NewSQLOutbox(ctx, m.db, events.NewRegistry())
+		if err != nil {
+			return stores{}, err
+		}
+		s.idempotency, err = infra.NewSQLIdempotency(ctx, m.db)
+		if err != nil {
+			return stores{}, err
+		}
+		s.sagas, err = infra.NewSQLSagaStore(ctx, m.db)
+		if err != nil {
+			return stores{}, err
+		}
+	case infra.BackendFile:
+		s.outbox, err = infra.NewFileOutbox(m.journal, events.NewRegistry())
+		if err != nil {
+			return stores{}, err
+		}
+		s.idempotency, err = infra.NewFileIdempotency(m.journal)
+		if err != nil {
+			return stores{}, err
+		}
+		s.sagas, err = infra.NewFileSagaStore(m.journal)
+		if err != nil {
+			return stores{}, err
+		}
+	default:
+		s.outbox = outbox.NewMemoryStore()
+		s.idempotency = idempotency.NewMemoryStore()
+		s.sagas = saga.NewMemoryStore()
+	}
+	return s, nil
+}
+
+// Start publishes the events stored in the outbox.
+func (m *infraModule) Start(ctx context.Context) error {
+	m.background.Go(ctx, m.relay.Run)
+	return nil
+}
+
+// Drain stops polling the outbox, publishes what is left in it and waits for the queued events to be handled.
+func (m *infraModule) Drain(ctx context.Context) error {
+	err := m.background.Stop(ctx)
+	if err != nil {
+		return fmt.Errorf("stopping outbox relay: %w", err)
+	}
+
+	var errs []error
+	err = m.relay.Flush(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("flushing outbox: %w", err))
+	}
+	err = m.bus.Shutdown(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (m *infraModule) Stop(_ context.Context) error {
+	var errs []error
+	if m.journal != nil {
+		errs = append(errs, m.journal.Close())
+	}
+	if m.db != nil {
+		errs = append(errs, m.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// newDeadLetters returns the dead letter store of the storage backend, so that they survive a restart
+func (m *infraModule) newDeadLetters(ctx context.Context) (eventbus.DeadLetterStore, error) {
+	switch m.storage.Backend {
+	case infra.BackendSQLite:
+		return infra.NewSQLDeadLetters(ctx, m.db, events.NewRegistry())
+	case infra.BackendFile:
+		return infra.NewFileDeadLetters(m.journal, events.NewRegistry())
+	default:
+		return eventbus.NewMemoryDeadLetters(), nil
+	}
+}
+
+func (m *infraModule) newRelay(store outbox.Store, bus *eventbus.Bus) *outbox.Relay {
+	return outbox.NewRelay(
+		store,
+		bus,
+		outbox.WithInterval(m.events.Relay.Interval),
+		outbox.WithBatchSize(m.events.Relay.BatchSize),
+	)
+}
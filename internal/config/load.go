@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variable of each flag, eg: the flag -data-dir is set by VS_DATA_DIR.
+const EnvPrefix = "VS_"
+
+// Load returns the settings from, in increasing order of precedence: the defaults,
+// the YAML or JSON file given by -config or VS_CONFIG, the environment variables and the command line flags.
+// The settings are validated.
+// It returns flag.ErrHelp if the usage was requested with -h.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	c := Default()
+
+	fs := flag.NewFlagSet("vertical-slices", flag.ContinueOnError)
+	configFile := fs.String("config", "", "YAML or JSON file with the settings")
+	bindFlags(fs, &c)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "Every flag can also be set by an environment variable, eg: -data-dir by %sDATA_DIR\n", EnvPrefix)
+	}
+
+	// the flags are parsed to find the config file, and parsed again in the end to override the file and the environment
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if *configFile == "" {
+		*configFile, _ = lookupEnv(envName("config"))
+	}
+	if *configFile != "" {
+		err = loadFile(*configFile, &c)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		v, ok := lookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		err := f.Value.Set(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", v, envName(f.Name), err))
+		}
+	})
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+
+	err = fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
+	}
+	return c, nil
+}
+
+// bindFlags defines a flag for each setting, defaulting to its current value.
+func bindFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.Server.Addr, "addr", c.Server.Addr, "address the HTTP server listens on")
+	fs.StringVar(&c.Server.Title, "api-title", c.Server.Title, "title of the API")
+	fs.StringVar(&c.Server.Version, "api-version", c.Server.Version, "version of the API")
+	fs.Var(&c.Server.DebugToken, "debug-token", "bearer token required to read /debug/vars, if set")
+	fs.DurationVar(&c.Server.ShutdownTimeout, "shutdown-timeout", c.Server.ShutdownTimeout, "how long the requests in flight, and the queued events, have to finish on shutdown")
+
+	fs.StringVar((*string)(&c.Storage.Backend), "storage", string(c.Storage.Backend), "storage backend: memory, file or sqlite")
+	fs.StringVar(&c.Storage.DataDir, "data-dir", c.Storage.DataDir, "directory where the file and sqlite backends keep the data")
+	fs.TextVar(&c.Storage.File.Sync, "file-sync", c.Storage.File.Sync, "when the file backend flushes to disk: always, periodic or never")
+	fs.DurationVar(&c.Storage.File.SyncInterval, "file-sync-interval", c.Storage.File.SyncInterval, "time between flushes of the file backend, with the periodic sync")
+	fs.IntVar(&c.Storage.File.SnapshotEvery, "file-snapshot-every", c.Storage.File.SnapshotEvery, "number of writes after which the file backend compacts its log")
+
+	fs.StringVar((*string)(&c.Events.Bus.Mode), "bus-mode", string(c.Events.Bus.Mode), "how the event handlers are called: inline or async")
+	fs.IntVar(&c.Events.Bus.QueueSize, "bus-queue-size", c.Events.Bus.QueueSize, "capacity of the queue of each event kind, in async mode")
+	fs.IntVar(&c.Events.Bus.Workers, "bus-workers", c.Events.Bus.Workers, "goroutines handling each event kind, in async mode")
+	fs.TextVar(&c.Events.Bus.Overflow, "bus-overflow", c.Events.Bus.Overflow, "what happens to an event published to a full queue: block, drop or fail")
+	fs.DurationVar(&c.Events.Relay.Interval, "relay-interval", c.Events.Relay.Interval, "time between polls of the outbox")
+	fs.IntVar(&c.Events.Relay.BatchSize, "relay-batch-size", c.Events.Relay.BatchSize, "maximum number of events read from the outbox in each poll")
+
+	fs.DurationVar(&c.Reservations.TTL, "reservation-ttl", c.Reservations.TTL, "how long the stock is reserved for an order that is not confirmed")
+	fs.DurationVar(&c.Reservations.SweepInterval, "sweep-interval", c.Reservations.SweepInterval, "how often the expired reservations and the saga timeouts are checked")
+
+	fs.StringVar((*string)(&c.Orders.Persistence), "orders-persistence", string(c.Orders.Persistence), "how the orders are saved: state, or events to rebuild them from")
+	fs.IntVar(&c.Orders.SnapshotEvery, "orders-snapshot-every", c.Orders.SnapshotEvery, "number of events of an event sourced order after which a snapshot is saved, zero for none")
+}
+
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadFile overrides the settings with the ones in the file, rejecting the unknown ones.
+// JSON is read as YAML, of which it is a subset.
+func loadFile(name string, c *Config) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("opening config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	err = dec.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("reading config file %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/quintans/vertical-slices/internal/config"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		args     []string
+		wantAddr string
+		wantErr  bool
+	}{
+		{name: "defaults", wantAddr: "127.0.0.1:8888"},
+		{name: "file over defaults", file: "server:\n  addr: :1000\n", wantAddr: ":1000"},
+		{
+			name:     "environment over file",
+			file:     "server:\n  addr: :1000\n",
+			env:      map[string]string{"VS_ADDR": ":2000"},
+			wantAddr: ":2000",
+		},
+		{
+			name:     "flags over environment",
+			file:     "server:\n  addr: :1000\n",
+			env:      map[string]string{"VS_ADDR": ":2000"},
+			args:     []string{"-addr", ":3000"},
+			wantAddr: ":3000",
+		},
+		{name: "JSON file", file: `{"server": {"addr": ":1000"}}`, wantAddr: ":1000"},
+		{name: "unknown setting in the file", file: "server:\n  port: 1000\n", wantErr: true},
+		{name: "invalid environment variable", env: map[string]string{"VS_BUS_WORKERS": "many"}, wantErr: true},
+		{name: "invalid setting", args: []string{"-storage", "paper"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			if tt.file != "" {
+				name := filepath.Join(t.TempDir(), "config.yaml")
+				err := os.WriteFile(name, []byte(tt.file), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				env["VS_CONFIG"] = name
+			}
+			lookupEnv := func(k string) (string, bool) {
+				v, ok := env[k]
+				return v, ok
+			}
+
+			c, err := config.Load(tt.args, lookupEnv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if c.Server.Addr != tt.wantAddr {
+				t.Errorf("Server.Addr = %q, want %q", c.Server.Addr, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	tests := []struct {
+		name  string
+		token config.Secret
+		want  string
+		// wantLine is the line of the token in the printed settings
+		wantLine string
+	}{
+		{name: "set", token: "s3cr3t", want: "[REDACTED]", wantLine: "debugToken: '[REDACTED]'"},
+		{name: "not set", want: "", wantLine: `debugToken: ""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.Default()
+			c.Server.DebugToken = tt.token
+
+			if got := tt.token.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			out := c.String()
+			if tt.token != "" && strings.Contains(out, string(tt.token)) {
+				t.Errorf("the printed settings leak the secret:\n%s", out)
+			}
+			if !strings.Contains(out, tt.wantLine) {
+				t.Errorf("the printed settings do not have %q:\n%s", tt.wantLine, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/features/orders"
+	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the application, loaded by Load.
+type Config struct {
+	Server       Server          `yaml:"server"`
+	Storage      infra.Storage   `yaml:"storage"`
+	Events       Events          `yaml:"events"`
+	Reservations Reservations    `yaml:"reservations"`
+	Orders       orders.Settings `yaml:"orders"`
+}
+
+type Server struct {
+	// Addr is the address the HTTP server listens on
+	Addr string `yaml:"addr"`
+	// Title and Version describe the API in the OpenAPI document
+	Title   string `yaml:"title"`
+	Version string `yaml:"version"`
+	// DebugToken, if set, is the bearer token required to read /debug/vars
+	DebugToken Secret `yaml:"debugToken"`
+	// ShutdownTimeout is how long the requests in flight, and the queued events, have to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+type BusMode string
+
+const (
+	// BusInline calls the event handlers when the outbox relay publishes the events
+	BusInline BusMode = "inline"
+	// BusAsync queues the events, by kind, to be handled in the background
+	BusAsync BusMode = "async"
+)
+
+type Events struct {
+	Bus   Bus   `yaml:"bus"`
+	Relay Relay `yaml:"relay"`
+}
+
+type Bus struct {
+	Mode BusMode `yaml:"mode"`
+	// QueueSize, Workers and Overflow configure the queue of each event kind, in BusAsync mode
+	QueueSize int                     `yaml:"queueSize"`
+	Workers   int                     `yaml:"workers"`
+	Overflow  eventbus.OverflowPolicy `yaml:"overflow"`
+}
+
+type Relay struct {
+	// Interval is the time between polls of the outbox
+	Interval time.Duration `yaml:"interval"`
+	// BatchSize is the maximum number of events read from the outbox in each poll
+	BatchSize int `yaml:"batchSize"`
+}
+
+type Reservations struct {
+	// TTL is how long the stock is reserved for an order that is not confirmed
+	TTL time.Duration `yaml:"ttl"`
+	// SweepInterval is how often the expired reservations are cleaned up, and the saga timeouts fired
+	SweepInterval time.Duration `yaml:"sweepInterval"`
+}
+
+// Default returns the settings used when they are not set in the config file, the environment or the flags.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:            "127.0.0.1:8888",
+			Title:           "My API",
+			Version:         "1.0.0",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Storage: infra.Storage{
+			Backend: infra.BackendMemory,
+			DataDir: "data",
+			File: infra.FileConfig{
+				Sync:          infra.SyncAlways,
+				SyncInterval:  time.Second,
+				SnapshotEvery: 1000,
+			},
+		},
+		Events: Events{
+			Bus: Bus{
+				Mode:      BusInline,
+				QueueSize: 100,
+				Workers:   1,
+				Overflow:  eventbus.OverflowBlock,
+			},
+			Relay: Relay{
+				Interval:  100 * time.Millisecond,
+				BatchSize: 100,
+			},
+		},
+		Reservations: Reservations{
+			TTL:           15 * time.Minute,
+			SweepInterval: time.Minute,
+		},
+		Orders: orders.Settings{
+			Persistence:   orders.PersistState,
+			SnapshotEvery: 100,
+		},
+	}
+}
+
+// Validate returns every invalid setting, joined together.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(setting string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", setting, fmt.Sprintf(format, args...)))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		invalid("server.addr", "%v", err)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdownTimeout", "must be positive")
+	}
+
+	switch c.Storage.Backend {
+	case infra.BackendMemory:
+	case infra.BackendFile, infra.BackendSQLite:
+		if c.Storage.DataDir == "" {
+			invalid("storage.dataDir", "required by the %s backend", c.Storage.Backend)
+		}
+	default:
+		invalid("storage.backend", "unknown backend '%s', expected one of memory, file or sqlite", c.Storage.Backend)
+	}
+	if c.Storage.File.Sync == infra.SyncPeriodic && c.Storage.File.SyncInterval <= 0 {
+		invalid("storage.file.syncInterval", "must be positive with the periodic sync mode")
+	}
+	if c.Storage.File.SnapshotEvery <= 0 {
+		invalid("storage.file.snapshotEvery", "must be positive")
+	}
+
+	switch c.Events.Bus.Mode {
+	case BusInline, BusAsync:
+	default:
+		invalid("events.bus.mode", "unknown mode '%s', expected one of inline or async", c.Events.Bus.Mode)
+	}
+	if c.Events.Bus.QueueSize <= 0 {
+		invalid("events.bus.queueSize", "must be positive")
+	}
+	if c.Events.Bus.Workers <= 0 {
+		invalid("events.bus.workers", "must be positive")
+	}
+	if c.Events.Relay.Interval <= 0 {
+		invalid("events.relay.interval", "must be positive")
+	}
+	if c.Events.Relay.BatchSize <= 0 {
+		invalid("events.relay.batchSize", "must be positive")
+	}
+
+	if c.Reservations.TTL <= 0 {
+		invalid("reservations.ttl", "must be positive")
+	}
+	if c.Reservations.SweepInterval <= 0 {
+		invalid("reservations.sweepInterval", "must be positive")
+	}
+
+	switch c.Orders.Persistence {
+	case orders.PersistState, orders.PersistEvents:
+	default:
+		invalid("orders.persistence", "unknown persistence '%s', expected one of state or events", c.Orders.Persistence)
+	}
+	if c.Orders.SnapshotEvery < 0 {
+		invalid("orders.snapshotEvery", "must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// String returns the settings as YAML, with the secrets redacted.
+func (c Config) String() string {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("marshalling config: %v", err)
+	}
+	return string(out)
+}
+
+// Secret is a setting that is never printed, eg: a token.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// MarshalText redacts the secret, so that it does not leak when the settings are printed.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Set implements flag.Value
+func (s *Secret) Set(v string) error {
+	*s = Secret(v)
+	return nil
+}
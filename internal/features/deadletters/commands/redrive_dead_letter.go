@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+// RedriveDeadLetterCommand is a command for handing the message of a dead letter again to the handler that failed it.
+type RedriveDeadLetterCommand struct {
+	ID uuid.UUID
+}
+
+type RedriveDeadLetterRequest struct {
+	ID uuid.UUID `path:"id" doc:"Dead letter ID"`
+}
+
+func RegisterRedriveDeadLetterController(api huma.API, m *mediator.Mediator, repo Redriver) {
+	// the handler of the message runs its own unit of work
+	mediator.RegisterCommand(m, mediator.Void(NewRedriveDeadLetterHandler(repo)), mediator.WithoutTransaction())
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "redriveDeadLetter",
+			Method:      http.MethodPost,
+			Path:        "/dead-letters/{id}/redrive",
+			Summary:     "Redrive a dead letter",
+			Description: "Hand the message of a dead letter again to the handler that failed it",
+			Tags:        []string{"dead-letters"},
+		},
+		func(ctx context.Context, req *RedriveDeadLetterRequest) (*struct{}, error) {
+			err := mediator.Exec(ctx, m, &RedriveDeadLetterCommand{ID: req.ID})
+
+			return nil, err
+		},
+	)
+}
+
+type Redriver interface {
+	Redrive(ctx context.Context, id uuid.UUID) error
+}
+
+func NewRedriveDeadLetterHandler(repo Redriver) func(ctx context.Context, cmd *RedriveDeadLetterCommand) error {
+	return func(ctx context.Context, cmd *RedriveDeadLetterCommand) error {
+		err := repo.Redrive(ctx, cmd.ID)
+		if err != nil {
+			return fmt.Errorf("redriving dead letter (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,14 @@
+package deadletters
+
+import (
+	"net/http"
+
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/problem"
+)
+
+// RegisterErrors maps the errors of the dead letters to HTTP problems
+func RegisterErrors(m *problem.Mapper) {
+	m.Map(eventbus.ErrDeadLetterNotFound, http.StatusNotFound, "dead_letters.not_found")
+	m.Map(eventbus.ErrDeadLettered, http.StatusUnprocessableEntity, "dead_letters.failed_again")
+}
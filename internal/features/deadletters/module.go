@@ -0,0 +1,45 @@
+package deadletters
+
+import (
+	"context"
+
+	"github.com/quintans/vertical-slices/internal/features/deadletters/commands"
+	"github.com/quintans/vertical-slices/internal/features/deadletters/queries"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/shared/keys"
+)
+
+// Module is the dead letters slice, exposing the dead letters of the event bus
+type Module struct{}
+
+func NewModule() *Module {
+	return &Module{}
+}
+
+func (m *Module) Name() string {
+	return "dead-letters"
+}
+
+func (m *Module) Provides() []string {
+	return nil
+}
+
+func (m *Module) Requires() []string {
+	return []string{
+		keys.API.Name(),
+		keys.Errors.Name(),
+		keys.Mediator.Name(),
+		keys.EventBus.Name(),
+	}
+}
+
+func (m *Module) Init(_ context.Context, c *module.Container) error {
+	RegisterErrors(module.Get(c, keys.Errors))
+
+	api, med, bus := module.Get(c, keys.API), module.Get(c, keys.Mediator), module.Get(c, keys.EventBus)
+	commands.RegisterRedriveDeadLetterController(api, med, bus)
+	queries.RegisterGetDeadLetterController(api, med, bus)
+	queries.RegisterListDeadLettersController(api, med, bus)
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package queries
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+type GetDeadLetterRequest struct {
+	ID uuid.UUID `path:"id" doc:"Dead letter ID"`
+}
+
+// GetDeadLetterQuery is a query for a dead letter by ID.
+type GetDeadLetterQuery struct {
+	ID uuid.UUID
+}
+
+type DeadLetterDTO struct {
+	ID       uuid.UUID   `json:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Dead letter ID"`
+	Handler  string      `json:"handler" example:"products.OrderCreated" doc:"Name of the handler that failed"`
+	Kind     string      `json:"kind" example:"OrderCreated" doc:"Message kind"`
+	Message  any         `json:"message" doc:"Message payload"`
+	Metadata MetadataDTO `json:"metadata" doc:"Metadata of the message"`
+	Error    string      `json:"error" doc:"Last error returned by the handler"`
+	Attempts int         `json:"attempts" example:"3" doc:"Number of attempts"`
+	FailedAt time.Time   `json:"failedAt" doc:"Time of the last attempt"`
+}
+
+type MetadataDTO struct {
+	EventID          uuid.UUID `json:"eventId" example:"00000000-0000-0000-0000-000000000000" doc:"Event ID"`
+	OccurredAt       time.Time `json:"occurredAt" doc:"Time the event occurred"`
+	AggregateID      uuid.UUID `json:"aggregateId" example:"00000000-0000-0000-0000-000000000000" doc:"ID of the aggregate that emitted the event"`
+	AggregateVersion int       `json:"aggregateVersion,omitempty" example:"2" doc:"Version of the aggregate after the event, if known"`
+	CorrelationID    string    `json:"correlationId,omitempty" doc:"ID shared by the events following from the same request"`
+	CausationID      string    `json:"causationId,omitempty" doc:"ID of the request or event that caused the event"`
+	SchemaVersion    int       `json:"schemaVersion" example:"1" doc:"Version of the shape of the message"`
+}
+
+type GetDeadLetterResponse struct {
+	Body struct {
+		DeadLetter DeadLetterDTO `json:"deadLetter" doc:"Dead letter"`
+	}
+}
+
+func RegisterGetDeadLetterController(api huma.API, m *mediator.Mediator, repo Getter) {
+	mediator.RegisterQuery(m, NewGetDeadLetterHandler(repo))
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "getDeadLetter",
+			Method:      http.MethodGet,
+			Path:        "/dead-letters/{id}",
+			Summary:     "Get a dead letter",
+			Tags:        []string{"dead-letters"},
+		},
+		func(ctx context.Context, input *GetDeadLetterRequest) (*GetDeadLetterResponse, error) {
+			deadLetter, err := mediator.Send[*DeadLetterDTO](ctx, m, &GetDeadLetterQuery{ID: input.ID})
+			if err != nil {
+				return nil, err
+			}
+
+			r := &GetDeadLetterResponse{}
+			r.Body.DeadLetter = *deadLetter
+			return r, nil
+		},
+	)
+}
+
+type Getter interface {
+	GetDeadLetter(ctx context.Context, id uuid.UUID) (eventbus.DeadLetter, error)
+}
+
+func NewGetDeadLetterHandler(repo Getter) func(ctx context.Context, q *GetDeadLetterQuery) (*DeadLetterDTO, error) {
+	return func(ctx context.Context, q *GetDeadLetterQuery) (*DeadLetterDTO, error) {
+		dl, err := repo.GetDeadLetter(ctx, q.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		return &DeadLetterDTO{
+			ID:       dl.ID,
+			Handler:  dl.Handler,
+			Kind:     dl.Message.Kind(),
+			Message:  dl.Message,
+			Metadata: MetadataDTO(dl.Metadata),
+			Error:    dl.Error,
+			Attempts: dl.Attempts,
+			FailedAt: dl.FailedAt,
+		}, nil
+	}
+}
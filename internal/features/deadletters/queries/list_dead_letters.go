@@ -0,0 +1,81 @@
+package queries
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+type ListItemDeadLetterDTO struct {
+	ID       uuid.UUID `json:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Dead letter ID"`
+	Handler  string    `json:"handler" example:"products.OrderCreated" doc:"Name of the handler that failed"`
+	Kind     string    `json:"kind" example:"OrderCreated" doc:"Message kind"`
+	Error    string    `json:"error" doc:"Last error returned by the handler"`
+	Attempts int       `json:"attempts" example:"3" doc:"Number of attempts"`
+	FailedAt time.Time `json:"failedAt" doc:"Time of the last attempt"`
+}
+
+// ListDeadLettersQuery is a query for all the dead letters.
+type ListDeadLettersQuery struct{}
+
+type ListDeadLettersResponse struct {
+	Body struct {
+		DeadLetters []ListItemDeadLetterDTO `json:"deadLetters" doc:"List of dead letters"`
+	}
+}
+
+func RegisterListDeadLettersController(api huma.API, m *mediator.Mediator, repo Lister) {
+	mediator.RegisterQuery(m, NewListDeadLettersHandler(repo))
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "listDeadLetters",
+			Method:      http.MethodGet,
+			Path:        "/dead-letters",
+			Summary:     "List all dead letters",
+			Tags:        []string{"dead-letters"},
+		},
+		func(ctx context.Context, _ *struct{}) (*ListDeadLettersResponse, error) {
+			deadLetters, err := mediator.Send[[]ListItemDeadLetterDTO](ctx, m, &ListDeadLettersQuery{})
+			if err != nil {
+				return nil, err
+			}
+
+			r := &ListDeadLettersResponse{}
+			r.Body.DeadLetters = deadLetters
+			return r, nil
+		},
+	)
+}
+
+type Lister interface {
+	ListDeadLetters(ctx context.Context) ([]eventbus.DeadLetter, error)
+}
+
+func NewListDeadLettersHandler(repo Lister) func(ctx context.Context, _ *ListDeadLettersQuery) ([]ListItemDeadLetterDTO, error) {
+	return func(ctx context.Context, _ *ListDeadLettersQuery) ([]ListItemDeadLetterDTO, error) {
+		deadLetters, err := repo.ListDeadLetters(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var dtos []ListItemDeadLetterDTO
+		for _, dl := range deadLetters {
+			dtos = append(dtos, ListItemDeadLetterDTO{
+				ID:       dl.ID,
+				Handler:  dl.Handler,
+				Kind:     dl.Message.Kind(),
+				Error:    dl.Error,
+				Attempts: dl.Attempts,
+				FailedAt: dl.FailedAt,
+			})
+		}
+		return dtos, nil
+	}
+}
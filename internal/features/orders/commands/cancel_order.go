@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+// CancelOrderCommand is a command for cancelling an order that was not paid yet.
+type CancelOrderCommand struct {
+	ID      uuid.UUID
+	Version int
+}
+
+func RegisterCancelOrderController(api huma.API, m *mediator.Mediator, repo Updater) {
+	registerTransition(
+		api,
+		m,
+		huma.Operation{
+			OperationID: "cancelOrder",
+			Method:      http.MethodPost,
+			Path:        "/orders/{id}/cancel",
+			Summary:     "Cancel Order",
+			Description: "Cancel an order that was not paid yet",
+			Tags:        []string{"orders"},
+		},
+		NewCancelOrderHandler(repo),
+	)
+}
+
+// NewCancelOrderHandler returns a handler that cancels a pending or confirmed order, that has not been paid yet.
+// The products slice then releases the stock reserved for the order, or returns it if it was already taken.
+// A command version, when given, must be the current one, so that an order changed meanwhile is not cancelled.
+func NewCancelOrderHandler(repo Updater) func(ctx context.Context, cmd *CancelOrderCommand) error {
+	return func(ctx context.Context, cmd *CancelOrderCommand) error {
+		err := transition(ctx, repo, cmd.ID, cmd.Version, (*domain.Order).Cancel)
+		if err != nil {
+			return fmt.Errorf("cancelling order (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
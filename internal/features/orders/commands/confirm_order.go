@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+// ConfirmOrderCommand is a command for confirming a pending order.
+type ConfirmOrderCommand struct {
+	ID      uuid.UUID
+	Version int
+}
+
+func RegisterConfirmOrderController(api huma.API, m *mediator.Mediator, repo Updater) {
+	registerTransition(
+		api,
+		m,
+		huma.Operation{
+			OperationID: "confirmOrder",
+			Method:      http.MethodPost,
+			Path:        "/orders/{id}/confirm",
+			Summary:     "Confirm Order",
+			Description: "Confirm a pending order",
+			Tags:        []string{"orders"},
+		},
+		NewConfirmOrderHandler(repo),
+	)
+}
+
+// NewConfirmOrderHandler returns a handler that confirms a pending order, upon which its reserved stock is taken.
+// It fails with fails.ErrPreconditionFailed if the command has a version and the order moved past it.
+func NewConfirmOrderHandler(repo Updater) func(ctx context.Context, cmd *ConfirmOrderCommand) error {
+	return func(ctx context.Context, cmd *ConfirmOrderCommand) error {
+		err := transition(ctx, repo, cmd.ID, cmd.Version, (*domain.Order).Confirm)
+		if err != nil {
+			return fmt.Errorf("confirming order (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
@@ -7,11 +7,20 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
 )
 
 type CreateOrderCommand struct {
-	ProductID uuid.UUID `json:"productId" path:"productId" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
-	Quantity  int       `json:"quantity" path:"quantity" example:"1" doc:"Quantity"`
+	Lines []CreateOrderLine `json:"lines" minItems:"1" doc:"Products to order"`
+}
+
+type CreateOrderLine struct {
+	ProductID uuid.UUID `json:"productId" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
+	Quantity  int       `json:"quantity" minimum:"1" example:"1" doc:"Quantity"`
+}
+
+type CreateOrderRequest struct {
+	Body CreateOrderCommand
 }
 
 type CreateOrderResponse struct {
@@ -20,8 +29,8 @@ type CreateOrderResponse struct {
 	}
 }
 
-func RegisterCreateOrderController(api huma.API, repo Creater, policy domain.CreateOrderPolicy) {
-	handler := NewCreateOrderHandler(repo, policy)
+func RegisterCreateOrderController(api huma.API, m *mediator.Mediator, repo Creater, policy domain.CreateOrderPolicy) {
+	mediator.RegisterCommand(m, NewCreateOrderHandler(repo, policy))
 
 	huma.Register(
 		api,
@@ -30,11 +39,11 @@ func RegisterCreateOrderController(api huma.API, repo Creater, policy domain.Cre
 			Method:      http.MethodPost,
 			Path:        "/orders",
 			Summary:     "Create Order",
-			Description: "Create a new Order for a given product ID and quantity",
+			Description: "Create a new Order for the given products and quantities",
 			Tags:        []string{"orders"},
 		},
-		func(ctx context.Context, cmd *CreateOrderCommand) (*CreateOrderResponse, error) {
-			id, err := handler(ctx, cmd)
+		func(ctx context.Context, req *CreateOrderRequest) (*CreateOrderResponse, error) {
+			id, err := mediator.Send[uuid.UUID](ctx, m, &req.Body)
 			if err != nil {
 				return nil, err
 			}
@@ -52,7 +61,15 @@ type Creater interface {
 
 func NewCreateOrderHandler(repo Creater, policy domain.CreateOrderPolicy) func(ctx context.Context, cmd *CreateOrderCommand) (uuid.UUID, error) {
 	return func(ctx context.Context, cmd *CreateOrderCommand) (uuid.UUID, error) {
-		p, err := domain.NewOrder(ctx, cmd.ProductID, cmd.Quantity, policy)
+		items := make([]domain.Item, 0, len(cmd.Lines))
+		for _, l := range cmd.Lines {
+			items = append(items, domain.Item{
+				ProductID: l.ProductID,
+				Quantity:  l.Quantity,
+			})
+		}
+
+		p, err := domain.NewOrder(ctx, items, policy)
 		if err != nil {
 			return uuid.Nil, err
 		}
@@ -7,14 +7,25 @@ import (
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
 )
 
+// DeleteOrderCommand is a command for deleting a cancelled order.
 type DeleteOrderCommand struct {
-	ID uuid.UUID `path:"id" doc:"Order ID"`
+	ID      uuid.UUID
+	Version int
 }
 
-func RegisterDeleteOrderController(api huma.API, repo Deleter) {
-	handler := NewDeleteOrderHandler(repo)
+type DeleteOrderRequest struct {
+	ID      uuid.UUID `path:"id" doc:"Order ID"`
+	IfMatch string    `header:"If-Match" doc:"Only delete if the order still has this ETag"`
+}
+
+func RegisterDeleteOrderController(api huma.API, m *mediator.Mediator, repo Deleter) {
+	mediator.RegisterCommand(m, mediator.Void(NewDeleteOrderHandler(repo)))
 
 	huma.Register(
 		api,
@@ -23,11 +34,19 @@ func RegisterDeleteOrderController(api huma.API, repo Deleter) {
 			Method:      http.MethodDelete,
 			Path:        "/orders/{id}",
 			Summary:     "Delete Order",
-			Description: "Delete an order by ID",
+			Description: "Delete a cancelled order by ID",
 			Tags:        []string{"orders"},
 		},
-		func(ctx context.Context, cmd *DeleteOrderCommand) (*struct{}, error) {
-			err := handler(ctx, cmd.ID)
+		func(ctx context.Context, req *DeleteOrderRequest) (*struct{}, error) {
+			version, err := etag.Parse(req.IfMatch)
+			if err != nil {
+				return nil, err
+			}
+
+			err = mediator.Exec(ctx, m, &DeleteOrderCommand{
+				ID:      req.ID,
+				Version: version,
+			})
 
 			return nil, err
 		},
@@ -35,14 +54,30 @@ func RegisterDeleteOrderController(api huma.API, repo Deleter) {
 }
 
 type Deleter interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
-func NewDeleteOrderHandler(repo Deleter) func(ctx context.Context, id uuid.UUID) error {
-	return func(ctx context.Context, id uuid.UUID) error {
-		err := repo.Delete(ctx, id)
+// NewDeleteOrderHandler returns a handler that deletes an order once it is cancelled, see domain.Order.CanDelete,
+// publishing OrderDeleted for the read models.
+// When the command carries a version, an order that was changed since then is kept.
+func NewDeleteOrderHandler(repo Deleter) func(ctx context.Context, cmd *DeleteOrderCommand) error {
+	return func(ctx context.Context, cmd *DeleteOrderCommand) error {
+		o, err := repo.GetByID(ctx, cmd.ID)
+		if err != nil {
+			return fmt.Errorf("getting order (%s): %w", cmd.ID, err)
+		}
+		if cmd.Version != 0 && o.Version() != cmd.Version {
+			return fmt.Errorf("deleting order (%s) version %d, current is %d: %w", cmd.ID, cmd.Version, o.Version(), fails.ErrPreconditionFailed)
+		}
+		err = o.CanDelete()
+		if err != nil {
+			return fmt.Errorf("order (%s): %w", cmd.ID, err)
+		}
+
+		err = repo.Delete(ctx, cmd.ID)
 		if err != nil {
-			return fmt.Errorf("deleting order (%s): %w", id, err)
+			return fmt.Errorf("deleting order (%s): %w", cmd.ID, err)
 		}
 
 		return nil
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+// DeliverOrderCommand is a command for recording the delivery of a shipped order.
+type DeliverOrderCommand struct {
+	ID      uuid.UUID
+	Version int
+}
+
+func RegisterDeliverOrderController(api huma.API, m *mediator.Mediator, repo Updater) {
+	registerTransition(
+		api,
+		m,
+		huma.Operation{
+			OperationID: "deliverOrder",
+			Method:      http.MethodPost,
+			Path:        "/orders/{id}/deliver",
+			Summary:     "Deliver Order",
+			Description: "Record the delivery of a shipped order",
+			Tags:        []string{"orders"},
+		},
+		NewDeliverOrderHandler(repo),
+	)
+}
+
+// NewDeliverOrderHandler returns a handler that marks a shipped order as delivered,
+// the last status of its lifecycle unless it is refunded.
+// The command version, if not zero, is checked against the order before it is delivered.
+func NewDeliverOrderHandler(repo Updater) func(ctx context.Context, cmd *DeliverOrderCommand) error {
+	return func(ctx context.Context, cmd *DeliverOrderCommand) error {
+		err := transition(ctx, repo, cmd.ID, cmd.Version, (*domain.Order).Deliver)
+		if err != nil {
+			return fmt.Errorf("delivering order (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+// PayOrderCommand is a command for recording the payment of a confirmed order.
+type PayOrderCommand struct {
+	ID      uuid.UUID
+	Version int
+}
+
+func RegisterPayOrderController(api huma.API, m *mediator.Mediator, repo Updater) {
+	registerTransition(
+		api,
+		m,
+		huma.Operation{
+			OperationID: "payOrder",
+			Method:      http.MethodPost,
+			Path:        "/orders/{id}/pay",
+			Summary:     "Pay Order",
+			Description: "Record the payment of a confirmed order",
+			Tags:        []string{"orders"},
+		},
+		NewPayOrderHandler(repo),
+	)
+}
+
+// NewPayOrderHandler returns a handler that records the payment of a confirmed order,
+// after which it can no longer be cancelled, only refunded.
+// The payment is rejected if the command version is set and is not the version of the order.
+func NewPayOrderHandler(repo Updater) func(ctx context.Context, cmd *PayOrderCommand) error {
+	return func(ctx context.Context, cmd *PayOrderCommand) error {
+		err := transition(ctx, repo, cmd.ID, cmd.Version, (*domain.Order).Pay)
+		if err != nil {
+			return fmt.Errorf("paying order (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+// RefundOrderCommand is a command for refunding a paid order.
+type RefundOrderCommand struct {
+	ID      uuid.UUID
+	Version int
+}
+
+func RegisterRefundOrderController(api huma.API, m *mediator.Mediator, repo Updater) {
+	registerTransition(
+		api,
+		m,
+		huma.Operation{
+			OperationID: "refundOrder",
+			Method:      http.MethodPost,
+			Path:        "/orders/{id}/refund",
+			Summary:     "Refund Order",
+			Description: "Refund a paid order",
+			Tags:        []string{"orders"},
+		},
+		NewRefundOrderHandler(repo),
+	)
+}
+
+// NewRefundOrderHandler returns a handler that refunds a paid order, whether it was shipped or delivered or not.
+// The stock of a refunded order is not put back.
+// Refunding twice from stale reads is prevented by the command version, that must still be the order's when set.
+func NewRefundOrderHandler(repo Updater) func(ctx context.Context, cmd *RefundOrderCommand) error {
+	return func(ctx context.Context, cmd *RefundOrderCommand) error {
+		err := transition(ctx, repo, cmd.ID, cmd.Version, (*domain.Order).Refund)
+		if err != nil {
+			return fmt.Errorf("refunding order (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+// ShipOrderCommand is a command for shipping a paid order.
+type ShipOrderCommand struct {
+	ID      uuid.UUID
+	Version int
+}
+
+func RegisterShipOrderController(api huma.API, m *mediator.Mediator, repo Updater) {
+	registerTransition(
+		api,
+		m,
+		huma.Operation{
+			OperationID: "shipOrder",
+			Method:      http.MethodPost,
+			Path:        "/orders/{id}/ship",
+			Summary:     "Ship Order",
+			Description: "Ship a paid order",
+			Tags:        []string{"orders"},
+		},
+		NewShipOrderHandler(repo),
+	)
+}
+
+// NewShipOrderHandler returns a handler that marks a paid order as shipped.
+// With a command version, an order refunded or otherwise changed since that version is not shipped.
+func NewShipOrderHandler(repo Updater) func(ctx context.Context, cmd *ShipOrderCommand) error {
+	return func(ctx context.Context, cmd *ShipOrderCommand) error {
+		err := transition(ctx, repo, cmd.ID, cmd.Version, (*domain.Order).Ship)
+		if err != nil {
+			return fmt.Errorf("shipping order (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+// TransitionOrderRequest is the request of every command that changes the status of an order.
+type TransitionOrderRequest struct {
+	ID      uuid.UUID `path:"id" doc:"Order ID"`
+	IfMatch string    `header:"If-Match" doc:"Only change the order if it still has this ETag"`
+}
+
+type Updater interface {
+	Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Order) error) error
+}
+
+// transitionCommand is the shape of every command that changes the status of an order
+type transitionCommand interface {
+	~struct {
+		ID      uuid.UUID
+		Version int
+	}
+}
+
+// registerTransition registers the handler of the command C and the operation dispatching it,
+// with the order ID and the version in If-Match.
+func registerTransition[C transitionCommand](api huma.API, m *mediator.Mediator, op huma.Operation, handler func(ctx context.Context, cmd *C) error) {
+	mediator.RegisterCommand(m, mediator.Void(handler))
+
+	huma.Register(
+		api,
+		op,
+		func(ctx context.Context, req *TransitionOrderRequest) (*struct{}, error) {
+			version, err := etag.Parse(req.IfMatch)
+			if err != nil {
+				return nil, err
+			}
+
+			err = mediator.Exec(ctx, m, &C{
+				ID:      req.ID,
+				Version: version,
+			})
+
+			return nil, err
+		},
+	)
+}
+
+// transition applies change to the order, if version is zero or the order still has that version.
+func transition(ctx context.Context, repo Updater, id uuid.UUID, version int, change func(o *domain.Order) error) error {
+	return repo.Update(ctx, id, func(_ context.Context, o *domain.Order) error {
+		if version != 0 && o.Version() != version {
+			return fmt.Errorf("expected version %d, current is %d: %w", version, o.Version(), fails.ErrPreconditionFailed)
+		}
+		return change(o)
+	})
+}
@@ -4,72 +4,299 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/lib/eventbus"
 	"github.com/quintans/vertical-slices/internal/shared/events"
 )
 
-var ErrInsufficientStock = errors.New("insufficient stock")
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrNoLines           = errors.New("order has no lines")
+	ErrInvalidQuantity   = errors.New("invalid quantity")
+	ErrNotCancelled      = errors.New("order is not cancelled")
+)
 
 type Order struct {
-	id        uuid.UUID
-	productId uuid.UUID
-	quantity  int
+	id      uuid.UUID
+	lines   []Line
+	status  Status
+	history []Transition
+	version int
 
 	events []eventbus.Message
 }
 
+// Item is a product, and how many units of it, to be ordered.
+type Item struct {
+	ProductID uuid.UUID
+	Quantity  int
+}
+
+// Line is a line of an order, with the unit price of the product at the time of the order.
+type Line struct {
+	productID uuid.UUID
+	quantity  int
+	unitPrice float64
+}
+
+func (l Line) ProductID() uuid.UUID {
+	return l.productID
+}
+
+func (l Line) Quantity() int {
+	return l.quantity
+}
+
+func (l Line) UnitPrice() float64 {
+	return l.unitPrice
+}
+
+func (l Line) Subtotal() float64 {
+	return float64(l.quantity) * l.unitPrice
+}
+
 type CreateOrderPolicy interface {
-	GetProductQuantity(ctx context.Context, id uuid.UUID) (int, error)
+	// ReserveStock holds quantity units of the product for the order.
+	// It fails with ErrInsufficientStock if there are not enough units available.
+	ReserveStock(ctx context.Context, orderID, productID uuid.UUID, quantity int) error
+	GetProductPrice(ctx context.Context, id uuid.UUID) (float64, error)
 }
 
-func NewOrder(ctx context.Context, productId uuid.UUID, quantity int, policy CreateOrderPolicy) (*Order, error) {
-	qty, err := policy.GetProductQuantity(ctx, productId)
-	if err != nil {
-		return nil, fmt.Errorf("getting stock quantity: %w", err)
+// NewOrder creates an order with a line for each product in items, reserving the stock for each line.
+// Items for the same product are merged in a single line.
+// It fails with ErrInsufficientStock, for every short line, if there isn't enough stock for all the lines.
+// It should run in a unit of work, so that the reservations are dropped if the order is not created.
+func NewOrder(ctx context.Context, items []Item, policy CreateOrderPolicy) (*Order, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("creating order: %w", ErrNoLines)
 	}
 
-	if qty < quantity {
-		return nil, fmt.Errorf("creating order: %w", ErrInsufficientStock)
+	var lines []Line
+	index := map[uuid.UUID]int{}
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("ordering %d units of product '%s': %w", item.Quantity, item.ProductID, ErrInvalidQuantity)
+		}
+
+		if i, ok := index[item.ProductID]; ok {
+			lines[i].quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(lines)
+		lines = append(lines, Line{
+			productID: item.ProductID,
+			quantity:  item.Quantity,
+		})
 	}
 
 	id := uuid.New()
-	return &Order{
-		id:        id,
-		productId: productId,
-		quantity:  quantity,
+	var short []error
+	for i, l := range lines {
+		err := policy.ReserveStock(ctx, id, l.productID, l.quantity)
+		if errors.Is(err, ErrInsufficientStock) {
+			short = append(short, fmt.Errorf("product '%s': %w", l.productID, err))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reserving stock: %w", err)
+		}
 
-		events: []eventbus.Message{
-			events.OrderCreated{
-				ID:        id,
-				ProductID: productId,
-				Quantity:  quantity,
-			},
-		},
-	}, nil
+		lines[i].unitPrice, err = policy.GetProductPrice(ctx, l.productID)
+		if err != nil {
+			return nil, fmt.Errorf("getting product price: %w", err)
+		}
+	}
+	if len(short) > 0 {
+		return nil, fmt.Errorf("creating order: %w", errors.Join(short...))
+	}
+
+	o := &Order{
+		id:      id,
+		lines:   lines,
+		status:  StatusPending,
+		history: []Transition{{To: StatusPending, At: time.Now()}},
+		version: 1,
+	}
+
+	o.events = append(o.events, events.OrderCreated{
+		ID:    o.id,
+		Lines: o.eventLines(),
+		Total: o.Total(),
+	})
+
+	return o, nil
 }
 
 func (p *Order) ID() uuid.UUID {
 	return p.id
 }
 
-func (p *Order) ProductID() uuid.UUID {
-	return p.productId
+func (p *Order) Lines() []Line {
+	return p.lines
+}
+
+// Total is the sum of the subtotals of all the lines
+func (p *Order) Total() float64 {
+	var total float64
+	for _, l := range p.lines {
+		total += l.Subtotal()
+	}
+	return total
+}
+
+func (p *Order) Status() Status {
+	return p.status
+}
+
+// CreatedAt is when the order was created, the time of its first transition
+func (p *Order) CreatedAt() time.Time {
+	if len(p.history) == 0 {
+		return time.Time{}
+	}
+	return p.history[0].At
+}
+
+// History returns the status transitions of the order, oldest first
+func (p *Order) History() []Transition {
+	return p.history
+}
+
+func (p *Order) Confirm() error {
+	return p.transition(StatusConfirmed, events.OrderConfirmed{ID: p.id, Lines: p.eventLines()})
 }
 
-func (p *Order) Quantity() int {
-	return p.quantity
+func (p *Order) Pay() error {
+	return p.transition(StatusPaid, events.OrderPaid{ID: p.id})
+}
+
+func (p *Order) Ship() error {
+	return p.transition(StatusShipped, events.OrderShipped{ID: p.id})
+}
+
+func (p *Order) Deliver() error {
+	return p.transition(StatusDelivered, events.OrderDelivered{ID: p.id})
+}
+
+func (p *Order) Cancel() error {
+	return p.transition(StatusCancelled, events.OrderCancelled{ID: p.id, Lines: p.eventLines()})
+}
+
+func (p *Order) Refund() error {
+	return p.transition(StatusRefunded, events.OrderRefunded{ID: p.id})
+}
+
+// transition moves the order to the status to, recording it in the history, and emits the event
+func (p *Order) transition(to Status, event eventbus.Message) error {
+	if !p.status.canGoTo(to) {
+		return &TransitionError{From: p.status, To: to}
+	}
+
+	p.moveTo(to, time.Now())
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *Order) moveTo(to Status, at time.Time) {
+	p.history = append(p.history, Transition{From: p.status, To: to, At: at})
+	p.status = to
+}
+
+// CanDelete fails with ErrNotCancelled if the order is not cancelled.
+// Only cancelled orders can be deleted, since cancelling is what returns the stock.
+func (p *Order) CanDelete() error {
+	if p.status != StatusCancelled {
+		return fmt.Errorf("deleting order in status '%s': %w", p.status, ErrNotCancelled)
+	}
+	return nil
+}
+
+func (p *Order) eventLines() []events.OrderLine {
+	lines := make([]events.OrderLine, 0, len(p.lines))
+	for _, l := range p.lines {
+		lines = append(lines, events.OrderLine{
+			ProductID: l.productID,
+			Quantity:  l.quantity,
+			UnitPrice: l.unitPrice,
+		})
+	}
+	return lines
+}
+
+func (p *Order) Version() int {
+	return p.version
 }
 
 func (p *Order) Events() []eventbus.Message {
 	return p.events
 }
 
-func HydrateOrder(id, product uuid.UUID, quantity int) *Order {
-	return &Order{
-		id:        id,
-		productId: product,
+func HydrateLine(productID uuid.UUID, quantity int, unitPrice float64) Line {
+	return Line{
+		productID: productID,
 		quantity:  quantity,
+		unitPrice: unitPrice,
+	}
+}
+
+// ReplayOrder rebuilds an order by applying its events, oldest first, on top of snapshot,
+// the order at the version before the first event, or nil to start from scratch.
+// The events are facts, so the transitions are not checked again.
+func ReplayOrder(snapshot *Order, history []eventbus.Envelope) (*Order, error) {
+	o := snapshot
+	if o == nil {
+		o = &Order{}
+	}
+
+	for _, e := range history {
+		if e.AggregateVersion != o.version+1 {
+			return nil, fmt.Errorf("replaying order '%s': event %d follows version %d", e.AggregateID, e.AggregateVersion, o.version)
+		}
+		err := o.apply(e.Message, e.OccurredAt)
+		if err != nil {
+			return nil, fmt.Errorf("replaying order '%s': %w", e.AggregateID, err)
+		}
+		o.version = e.AggregateVersion
+	}
+	return o, nil
+}
+
+// apply changes the order as the event, that happened at the time at, did
+func (p *Order) apply(event eventbus.Message, at time.Time) error {
+	switch e := event.(type) {
+	case events.OrderCreated:
+		p.id = e.ID
+		p.lines = make([]Line, 0, len(e.Lines))
+		for _, l := range e.Lines {
+			p.lines = append(p.lines, HydrateLine(l.ProductID, l.Quantity, l.UnitPrice))
+		}
+		p.status = StatusPending
+		p.history = []Transition{{To: StatusPending, At: at}}
+	case events.OrderConfirmed:
+		p.moveTo(StatusConfirmed, at)
+	case events.OrderPaid:
+		p.moveTo(StatusPaid, at)
+	case events.OrderShipped:
+		p.moveTo(StatusShipped, at)
+	case events.OrderDelivered:
+		p.moveTo(StatusDelivered, at)
+	case events.OrderCancelled:
+		p.moveTo(StatusCancelled, at)
+	case events.OrderRefunded:
+		p.moveTo(StatusRefunded, at)
+	default:
+		return fmt.Errorf("unexpected event '%s'", event.Kind())
+	}
+	return nil
+}
+
+func HydrateOrder(id uuid.UUID, lines []Line, status Status, history []Transition, version int) *Order {
+	return &Order{
+		id:      id,
+		lines:   lines,
+		status:  status,
+		history: history,
+		version: version,
 	}
 }
@@ -0,0 +1,195 @@
+package domain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+)
+
+var (
+	pen = uuid.New()
+	ink = uuid.New()
+)
+
+// policy has the stock and the prices of the products
+type policy struct {
+	stock  map[uuid.UUID]int
+	prices map[uuid.UUID]float64
+}
+
+func (p policy) ReserveStock(_ context.Context, _, productID uuid.UUID, quantity int) error {
+	if p.stock[productID] < quantity {
+		return domain.ErrInsufficientStock
+	}
+	return nil
+}
+
+func (p policy) GetProductPrice(_ context.Context, id uuid.UUID) (float64, error) {
+	return p.prices[id], nil
+}
+
+func TestNewOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     []domain.Item
+		wantErr   error
+		wantLines map[uuid.UUID]int
+		wantTotal float64
+	}{
+		{
+			name:      "single line",
+			items:     []domain.Item{{ProductID: pen, Quantity: 2}},
+			wantLines: map[uuid.UUID]int{pen: 2},
+			wantTotal: 3,
+		},
+		{
+			name:      "same product merged in a line",
+			items:     []domain.Item{{ProductID: pen, Quantity: 2}, {ProductID: ink, Quantity: 1}, {ProductID: pen, Quantity: 3}},
+			wantLines: map[uuid.UUID]int{pen: 5, ink: 1},
+			wantTotal: 17.5,
+		},
+		{
+			name:    "merged lines over the stock",
+			items:   []domain.Item{{ProductID: pen, Quantity: 6}, {ProductID: pen, Quantity: 5}},
+			wantErr: domain.ErrInsufficientStock,
+		},
+		{
+			name:    "no lines",
+			wantErr: domain.ErrNoLines,
+		},
+		{
+			name:    "invalid quantity",
+			items:   []domain.Item{{ProductID: pen, Quantity: 0}},
+			wantErr: domain.ErrInvalidQuantity,
+		},
+	}
+
+	p := policy{
+		stock:  map[uuid.UUID]int{pen: 10, ink: 1},
+		prices: map[uuid.UUID]float64{pen: 1.5, ink: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := domain.NewOrder(context.Background(), tt.items, p)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(o.Lines()) != len(tt.wantLines) {
+				t.Fatalf("lines = %d, want %d", len(o.Lines()), len(tt.wantLines))
+			}
+			for _, l := range o.Lines() {
+				if l.Quantity() != tt.wantLines[l.ProductID()] {
+					t.Errorf("line of %s = %d units, want %d", l.ProductID(), l.Quantity(), tt.wantLines[l.ProductID()])
+				}
+			}
+			if o.Total() != tt.wantTotal {
+				t.Errorf("Total() = %v, want %v", o.Total(), tt.wantTotal)
+			}
+			if o.Status() != domain.StatusPending || o.Version() != 1 {
+				t.Errorf("new order is %s at version %d, want pending at version 1", o.Status(), o.Version())
+			}
+			if evts := o.Events(); len(evts) != 1 || evts[0].Kind() != "OrderCreated" {
+				t.Errorf("Events() = %v, want OrderCreated", evts)
+			}
+		})
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	actions := map[string]func(*domain.Order) error{
+		"confirm": (*domain.Order).Confirm,
+		"pay":     (*domain.Order).Pay,
+		"ship":    (*domain.Order).Ship,
+		"deliver": (*domain.Order).Deliver,
+		"cancel":  (*domain.Order).Cancel,
+		"refund":  (*domain.Order).Refund,
+	}
+
+	tests := []struct {
+		from   domain.Status
+		action string
+		// want is the status after the action, empty if the transition is invalid
+		want      domain.Status
+		wantEvent string
+	}{
+		{from: domain.StatusPending, action: "confirm", want: domain.StatusConfirmed, wantEvent: "OrderConfirmed"},
+		{from: domain.StatusPending, action: "cancel", want: domain.StatusCancelled, wantEvent: "OrderCancelled"},
+		{from: domain.StatusPending, action: "pay"},
+		{from: domain.StatusPending, action: "refund"},
+		{from: domain.StatusConfirmed, action: "pay", want: domain.StatusPaid, wantEvent: "OrderPaid"},
+		{from: domain.StatusConfirmed, action: "cancel", want: domain.StatusCancelled, wantEvent: "OrderCancelled"},
+		{from: domain.StatusConfirmed, action: "confirm"},
+		{from: domain.StatusPaid, action: "ship", want: domain.StatusShipped, wantEvent: "OrderShipped"},
+		{from: domain.StatusPaid, action: "refund", want: domain.StatusRefunded, wantEvent: "OrderRefunded"},
+		{from: domain.StatusPaid, action: "cancel"},
+		{from: domain.StatusShipped, action: "deliver", want: domain.StatusDelivered, wantEvent: "OrderDelivered"},
+		{from: domain.StatusShipped, action: "refund", want: domain.StatusRefunded, wantEvent: "OrderRefunded"},
+		{from: domain.StatusDelivered, action: "refund", want: domain.StatusRefunded, wantEvent: "OrderRefunded"},
+		{from: domain.StatusDelivered, action: "ship"},
+		{from: domain.StatusCancelled, action: "confirm"},
+		{from: domain.StatusRefunded, action: "refund"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"/"+tt.action, func(t *testing.T) {
+			history := []domain.Transition{{To: tt.from}}
+			o := domain.HydrateOrder(uuid.New(), nil, tt.from, history, 1)
+
+			err := actions[tt.action](o)
+			if tt.want == "" {
+				var te *domain.TransitionError
+				if !errors.As(err, &te) || !errors.Is(err, domain.ErrInvalidTransition) {
+					t.Fatalf("error = %v, want a TransitionError", err)
+				}
+				if o.Status() != tt.from || len(o.History()) != 1 || len(o.Events()) != 0 {
+					t.Errorf("invalid transition changed the order to %s with %d transitions", o.Status(), len(o.History()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+
+			if o.Status() != tt.want {
+				t.Errorf("Status() = %s, want %s", o.Status(), tt.want)
+			}
+			h := o.History()
+			if len(h) != 2 || h[1].From != tt.from || h[1].To != tt.want {
+				t.Errorf("History() = %v, want a transition from %s to %s", h, tt.from, tt.want)
+			}
+			if evts := o.Events(); len(evts) != 1 || evts[0].Kind() != tt.wantEvent {
+				t.Errorf("Events() = %v, want %s", evts, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestCanDelete(t *testing.T) {
+	tests := []struct {
+		status  domain.Status
+		wantErr error
+	}{
+		{status: domain.StatusCancelled},
+		{status: domain.StatusPending, wantErr: domain.ErrNotCancelled},
+		{status: domain.StatusDelivered, wantErr: domain.ErrNotCancelled},
+		{status: domain.StatusRefunded, wantErr: domain.ErrNotCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			o := domain.HydrateOrder(uuid.New(), nil, tt.status, nil, 1)
+			err := o.CanDelete()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CanDelete() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+)
+
+// SortByCreated is the default sort key of the orders
+const SortByCreated = "created"
+
+// SortKeys are the keys the orders can be sorted by
+var SortKeys = map[string]page.Key[*Order]{
+	SortByCreated: page.TimeKey((*Order).CreatedAt),
+	"total":       page.FloatKey((*Order).Total),
+}
+
+// OrderID identifies the orders in the pages
+func OrderID(o *Order) uuid.UUID {
+	return o.ID()
+}
+
+// Query selects a page of the orders.
+type Query struct {
+	// ProductID, if set, selects the orders with a line for the product
+	ProductID uuid.UUID
+	// Status, if set, selects the orders in the status
+	Status Status
+	Page   page.Request
+}
+
+// Matches reports whether the order is selected by the filters of the query.
+func (q Query) Matches(o *Order) bool {
+	if q.ProductID != uuid.Nil && !slices.ContainsFunc(o.lines, func(l Line) bool { return l.productID == q.ProductID }) {
+		return false
+	}
+	if q.Status != "" && o.status != q.Status {
+		return false
+	}
+	return true
+}
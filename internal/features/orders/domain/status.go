@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// Status is a state of the order lifecycle:
+//
+//	Pending → Confirmed → Paid → Shipped → Delivered
+//
+// A Pending or Confirmed order can be Cancelled, and a Paid, Shipped or Delivered order can be Refunded.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusConfirmed Status = "confirmed"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+	StatusRefunded  Status = "refunded"
+)
+
+// transitions holds, for each status, the statuses it can go to
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusShipped, StatusRefunded},
+	StatusShipped:   {StatusDelivered, StatusRefunded},
+	StatusDelivered: {StatusRefunded},
+}
+
+func (s Status) canGoTo(to Status) bool {
+	return slices.Contains(transitions[s], to)
+}
+
+// TransitionError is returned when an order cannot go from its current status to another.
+// It matches ErrInvalidTransition.
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s: from '%s' to '%s'", ErrInvalidTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// Transition is a change of status of an order.
+// The first transition of an order, on creation, has an empty From.
+type Transition struct {
+	From Status
+	To   Status
+	At   time.Time
+}
@@ -0,0 +1,17 @@
+package orders
+
+import (
+	"net/http"
+
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/problem"
+)
+
+// RegisterErrors maps the errors of the orders domain to HTTP problems
+func RegisterErrors(m *problem.Mapper) {
+	m.Map(domain.ErrInsufficientStock, http.StatusUnprocessableEntity, "orders.insufficient_stock")
+	m.Map(domain.ErrNoLines, http.StatusUnprocessableEntity, "orders.no_lines")
+	m.Map(domain.ErrInvalidQuantity, http.StatusUnprocessableEntity, "orders.invalid_quantity")
+	m.Map(domain.ErrInvalidTransition, http.StatusConflict, "orders.invalid_transition")
+	m.Map(domain.ErrNotCancelled, http.StatusConflict, "orders.not_cancelled")
+}
@@ -0,0 +1,231 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/eventstore"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+	"github.com/quintans/vertical-slices/internal/shared"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+// EventSourcedRepo keeps each order as the stream of its events, rebuilding it by replaying them.
+// The version of an order is the version of its stream, and a deleted order is a stream ending with OrderDeleted.
+type EventSourcedRepo struct {
+	store  eventstore.Store
+	outbox shared.Outbox
+	// snapshotEvery is the number of events after which a snapshot of the order is saved, or zero for none
+	snapshotEvery int
+}
+
+func NewEventSourcedRepository(store eventstore.Store, outbox shared.Outbox, snapshotEvery int) *EventSourcedRepo {
+	return &EventSourcedRepo{
+		store:         store,
+		outbox:        outbox,
+		snapshotEvery: snapshotEvery,
+	}
+}
+
+func (r *EventSourcedRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error) {
+	return r.load(ctx, id)
+}
+
+// load replays the events of the order after its last snapshot, failing with fails.ErrNotFound if it does not exist or was deleted
+func (r *EventSourcedRepo) load(ctx context.Context, id uuid.UUID) (*domain.Order, error) {
+	var snapshot *domain.Order
+	snap, err := r.store.LoadSnapshot(ctx, id)
+	switch {
+	case errors.Is(err, eventstore.ErrNoSnapshot):
+	case err != nil:
+		return nil, fmt.Errorf("loading snapshot of order '%s': %w", id, err)
+	default:
+		snapshot, err = orderCodec{}.Decode(snap.Data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding snapshot of order '%s': %w", id, err)
+		}
+		snapshot = withOrderVersion(snapshot, snap.Version)
+	}
+
+	var from int
+	if snapshot != nil {
+		from = snapshot.Version()
+	}
+	history, err := r.store.Load(ctx, id, from)
+	if err != nil {
+		return nil, fmt.Errorf("loading events of order '%s': %w", id, err)
+	}
+	if snapshot == nil && len(history) == 0 {
+		return nil, fails.ErrNotFound
+	}
+	if len(history) > 0 {
+		if _, ok := history[len(history)-1].Message.(events.OrderDeleted); ok {
+			return nil, fails.ErrNotFound
+		}
+	}
+
+	return domain.ReplayOrder(snapshot, history)
+}
+
+func (r *EventSourcedRepo) ListAll(ctx context.Context) ([]*domain.Order, error) {
+	ids, err := r.store.Streams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]*domain.Order, 0, len(ids))
+	for _, id := range ids {
+		o, err := r.load(ctx, id)
+		if errors.Is(err, fails.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+// List returns the page of the orders selected by the query, whose page request must have been checked.
+func (r *EventSourcedRepo) List(ctx context.Context, q domain.Query) (page.Page[*domain.Order], error) {
+	all, err := r.ListAll(ctx)
+	if err != nil {
+		return page.Page[*domain.Order]{}, err
+	}
+
+	var selected []*domain.Order
+	for _, o := range all {
+		if q.Matches(o) {
+			selected = append(selected, o)
+		}
+	}
+	return page.Slice(selected, q.Page, domain.SortKeys, domain.OrderID)
+}
+
+func (r *EventSourcedRepo) Create(ctx context.Context, o *domain.Order) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		envs := wrap(ctx, o.ID(), 0, o.Events())
+		err := r.store.Append(ctx, o.ID(), 0, envs...)
+		if errors.Is(err, eventstore.ErrConflict) {
+			return fails.ErrAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		err = r.snapshot(ctx, o, 0, o.Version())
+		if err != nil {
+			return err
+		}
+
+		return r.addEvents(ctx, envs)
+	})
+}
+
+// Delete ends the stream of the order with OrderDeleted, publishing it.
+func (r *EventSourcedRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		o, err := r.load(ctx, id)
+		if errors.Is(err, fails.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		envs, err := r.append(ctx, id, o.Version(), []eventbus.Message{events.OrderDeleted{ID: id}})
+		if err != nil {
+			return err
+		}
+
+		return r.addEvents(ctx, envs)
+	})
+}
+
+func (r *EventSourcedRepo) Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Order) error) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		o, err := r.load(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		version := o.Version()
+		err = handler(ctx, o)
+		if err != nil {
+			return err
+		}
+
+		envs, err := r.append(ctx, id, version, o.Events())
+		if err != nil {
+			return err
+		}
+
+		err = r.snapshot(ctx, o, version, version+len(envs))
+		if err != nil {
+			return err
+		}
+
+		return r.addEvents(ctx, envs)
+	})
+}
+
+// append adds the events to the stream of the order, failing with fails.ErrConcurrencyConflict if it is no longer at version,
+// returning their envelopes
+func (r *EventSourcedRepo) append(ctx context.Context, id uuid.UUID, version int, events []eventbus.Message) ([]eventbus.Envelope, error) {
+	envs := wrap(ctx, id, version, events)
+	err := r.store.Append(ctx, id, version, envs...)
+	if errors.Is(err, eventstore.ErrConflict) {
+		return nil, fmt.Errorf("%w: %w", fails.ErrConcurrencyConflict, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return envs, nil
+}
+
+// wrap puts the events in envelopes numbered after the version from, as they are numbered in the stream
+func wrap(ctx context.Context, id uuid.UUID, from int, events []eventbus.Message) []eventbus.Envelope {
+	envs := eventbus.Wrap(ctx, id, from, events...)
+	for i := range envs {
+		envs[i].AggregateVersion = from + i + 1
+	}
+	return envs
+}
+
+// snapshot saves the order, that moved from the version from to the version to,
+// if its stream went past a multiple of snapshotEvery
+func (r *EventSourcedRepo) snapshot(ctx context.Context, o *domain.Order, from, to int) error {
+	if r.snapshotEvery <= 0 || from/r.snapshotEvery == to/r.snapshotEvery {
+		return nil
+	}
+
+	data, err := orderCodec{}.Encode(withOrderVersion(o, to))
+	if err != nil {
+		return err
+	}
+	err = r.store.SaveSnapshot(ctx, eventstore.Snapshot{StreamID: o.ID(), Version: to, Data: data})
+	if err != nil {
+		return fmt.Errorf("saving snapshot of order '%s': %w", o.ID(), err)
+	}
+	return nil
+}
+
+// addEvents stores the envelopes appended to the stream in the outbox, to be published by the relay once the unit of work commits
+func (r *EventSourcedRepo) addEvents(ctx context.Context, envs []eventbus.Envelope) error {
+	if len(envs) == 0 {
+		return nil
+	}
+
+	err := r.outbox.Add(ctx, envs...)
+	if err != nil {
+		return fmt.Errorf("adding order events to outbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package orders
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/commands"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/features/orders/projections"
+	"github.com/quintans/vertical-slices/internal/features/orders/queries"
+	"github.com/quintans/vertical-slices/internal/features/orders/readmodel"
+	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventstore"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+	"github.com/quintans/vertical-slices/internal/shared/keys"
+)
+
+// Repository is the orders repository provided to the other modules
+type Repository interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error)
+	ListAll(ctx context.Context) ([]*domain.Order, error)
+	List(ctx context.Context, q domain.Query) (page.Page[*domain.Order], error)
+	Create(ctx context.Context, o *domain.Order) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Order) error) error
+}
+
+var (
+	RepositoryKey = module.NewKey[Repository]("orders.repository")
+	// CreateOrderPolicyKey is the policy creating orders, provided by whoever manages the stock
+	CreateOrderPolicyKey = module.NewKey[domain.CreateOrderPolicy]("orders.create-order-policy")
+	// ProductCatalogKey lists the products shown in the order views, provided by whoever manages the products
+	ProductCatalogKey = module.NewKey[projections.Catalog]("orders.product-catalog")
+)
+
+// PersistenceMode is how the orders are saved
+type PersistenceMode string
+
+const (
+	// PersistState saves the current state of the orders
+	PersistState PersistenceMode = "state"
+	// PersistEvents saves the events of the orders, from which they are rebuilt
+	PersistEvents PersistenceMode = "events"
+)
+
+// Settings configures the orders slice
+type Settings struct {
+	// Persistence defaults to PersistState
+	Persistence PersistenceMode `yaml:"persistence"`
+	// SnapshotEvery is the number of events of an order after which a snapshot of it is saved, with PersistEvents.
+	// Zero saves no snapshots.
+	SnapshotEvery int `yaml:"snapshotEvery"`
+}
+
+// Module is the orders slice
+type Module struct {
+	storage  infra.Storage
+	settings Settings
+
+	repo Repository
+}
+
+// NewModule returns the orders slice, keeping its data in storage.
+func NewModule(storage infra.Storage, settings Settings) *Module {
+	return &Module{
+		storage:  storage,
+		settings: settings,
+	}
+}
+
+func (m *Module) Name() string {
+	return "orders"
+}
+
+func (m *Module) Provides() []string {
+	return []string{RepositoryKey.Name()}
+}
+
+func (m *Module) Requires() []string {
+	requires := []string{
+		keys.API.Name(),
+		keys.Errors.Name(),
+		keys.Mediator.Name(),
+		keys.Outbox.Name(),
+		keys.EventBus.Name(),
+		keys.Projections.Name(),
+		keys.Checkpoint.Name(),
+		CreateOrderPolicyKey.Name(),
+		ProductCatalogKey.Name(),
+	}
+	switch m.storage.Backend {
+	case infra.BackendSQLite:
+		requires = append(requires, keys.SQL.Name())
+	case infra.BackendFile:
+		requires = append(requires, keys.Journal.Name())
+	}
+	return requires
+}
+
+func (m *Module) Init(ctx context.Context, c *module.Container) error {
+	var err error
+	m.repo, err = m.newRepository(ctx, c)
+	if err != nil {
+		return err
+	}
+	module.Provide(c, RepositoryKey, m.repo)
+
+	RegisterErrors(module.Get(c, keys.Errors))
+
+	api, med := module.Get(c, keys.API), module.Get(c, keys.Mediator)
+	commands.RegisterCreateOrderController(api, med, m.repo, module.Get(c, CreateOrderPolicyKey))
+	commands.RegisterDeleteOrderController(api, med, m.repo)
+	commands.RegisterConfirmOrderController(api, med, m.repo)
+	commands.RegisterPayOrderController(api, med, m.repo)
+	commands.RegisterShipOrderController(api, med, m.repo)
+	commands.RegisterDeliverOrderController(api, med, m.repo)
+	commands.RegisterCancelOrderController(api, med, m.repo)
+	commands.RegisterRefundOrderController(api, med, m.repo)
+
+	// the queries read the views, kept up to date by the projection
+	views := readmodel.NewStore()
+	orderViews := projections.NewOrderViews(m.repo, module.Get(c, ProductCatalogKey), views)
+	orderViews.Register(module.Get(c, keys.EventBus))
+	module.Get(c, keys.Projections).Add(orderViews)
+	err = orderViews.Rebuild(ctx)
+	if err != nil {
+		return fmt.Errorf("building the order views: %w", err)
+	}
+
+	checkpoint := module.Get(c, keys.Checkpoint)
+	queries.RegisterGetOrderController(api, med, m.repo, views, checkpoint)
+	queries.RegisterListOrdersController(api, med, views, checkpoint)
+
+	return nil
+}
+
+func (m *Module) newRepository(ctx context.Context, c *module.Container) (Repository, error) {
+	outbox := module.Get(c, keys.Outbox)
+
+	switch m.settings.Persistence {
+	case PersistState, "":
+	case PersistEvents:
+		store, err := m.newEventStore(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return NewEventSourcedRepository(store, outbox, m.settings.SnapshotEvery), nil
+	default:
+		return nil, fmt.Errorf("unknown orders persistence '%s'", m.settings.Persistence)
+	}
+
+	switch m.storage.Backend {
+	case infra.BackendMemory, "":
+		return NewRepository(outbox), nil
+	case infra.BackendFile:
+		return NewFileRepository(module.Get(c, keys.Journal), outbox)
+	case infra.BackendSQLite:
+		return NewSQLRepository(ctx, module.Get(c, keys.SQL), outbox)
+	default:
+		return nil, fmt.Errorf("unknown storage backend '%s'", m.storage.Backend)
+	}
+}
+
+func (m *Module) newEventStore(ctx context.Context, c *module.Container) (eventstore.Store, error) {
+	registry := events.NewRegistry()
+
+	switch m.storage.Backend {
+	case infra.BackendMemory, "":
+		return infra.NewEventStore(registry), nil
+	case infra.BackendFile:
+		return infra.NewFileEventStore(module.Get(c, keys.Journal), "orders-events", registry)
+	case infra.BackendSQLite:
+		return infra.NewSQLEventStore(ctx, module.Get(c, keys.SQL), registry)
+	default:
+		return nil, fmt.Errorf("unknown storage backend '%s'", m.storage.Backend)
+	}
+}
@@ -0,0 +1,138 @@
+package projections
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/features/orders/readmodel"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+type Orders interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error)
+	ListAll(ctx context.Context) ([]*domain.Order, error)
+}
+
+// Catalog lists the products, to rebuild the views
+type Catalog interface {
+	ListProducts(ctx context.Context) ([]readmodel.ProductView, error)
+}
+
+// OrderViews keeps the order views up to date with the events of the orders and the products.
+//
+// On an event of an order, the view is built again from the order, so that the events can be handled more than once,
+// or out of order, and the view still ends up like the order.
+type OrderViews struct {
+	orders  Orders
+	catalog Catalog
+	store   *readmodel.Store
+
+	// mu keeps the events from being handled while the views are rebuilt
+	mu sync.Mutex
+}
+
+func NewOrderViews(orders Orders, catalog Catalog, store *readmodel.Store) *OrderViews {
+	return &OrderViews{
+		orders:  orders,
+		catalog: catalog,
+		store:   store,
+	}
+}
+
+func (p *OrderViews) Name() string {
+	return "orders.views"
+}
+
+// Rebuild builds all the views again, from the orders and the catalog.
+// The events published meanwhile wait, to be handled on top of the rebuilt views.
+func (p *OrderViews) Rebuild(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	products, err := p.catalog.ListProducts(ctx)
+	if err != nil {
+		return fmt.Errorf("listing products: %w", err)
+	}
+	orders, err := p.orders.ListAll(ctx)
+	if err != nil {
+		return fmt.Errorf("listing orders: %w", err)
+	}
+
+	p.store.Reset(orders, products)
+	return nil
+}
+
+// Register subscribes the projection to the events.
+// The handlers run inline with the publishing, so that the views are up to date once the events are published.
+func (p *OrderViews) Register(bus *eventbus.Bus) {
+	options := func(kind string) []eventbus.RegisterOption {
+		return []eventbus.RegisterOption{
+			eventbus.WithName(p.Name() + "." + kind),
+			eventbus.Inline(),
+			eventbus.WithRetry(eventbus.DefaultRetryPolicy()),
+		}
+	}
+
+	eventbus.Register(bus, p.ProductCreated, options(events.ProductCreated{}.Kind())...)
+	eventbus.Register(bus, p.ProductRenamed, options(events.ProductRenamed{}.Kind())...)
+	eventbus.Register(bus, func(ctx context.Context, e events.OrderCreated) error { return p.refresh(ctx, e.ID) }, options(events.OrderCreated{}.Kind())...)
+	eventbus.Register(bus, func(ctx context.Context, e events.OrderConfirmed) error { return p.refresh(ctx, e.ID) }, options(events.OrderConfirmed{}.Kind())...)
+	eventbus.Register(bus, func(ctx context.Context, e events.OrderPaid) error { return p.refresh(ctx, e.ID) }, options(events.OrderPaid{}.Kind())...)
+	eventbus.Register(bus, func(ctx context.Context, e events.OrderShipped) error { return p.refresh(ctx, e.ID) }, options(events.OrderShipped{}.Kind())...)
+	eventbus.Register(bus, func(ctx context.Context, e events.OrderDelivered) error { return p.refresh(ctx, e.ID) }, options(events.OrderDelivered{}.Kind())...)
+	eventbus.Register(bus, func(ctx context.Context, e events.OrderCancelled) error { return p.refresh(ctx, e.ID) }, options(events.OrderCancelled{}.Kind())...)
+	eventbus.Register(bus, func(ctx context.Context, e events.OrderRefunded) error { return p.refresh(ctx, e.ID) }, options(events.OrderRefunded{}.Kind())...)
+	eventbus.Register(bus, p.OrderDeleted, options(events.OrderDeleted{}.Kind())...)
+}
+
+func (p *OrderViews) ProductCreated(_ context.Context, e events.ProductCreated) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.store.PutProduct(readmodel.ProductView{ID: e.ID, SKU: e.SKU, Name: e.Name})
+	return nil
+}
+
+func (p *OrderViews) ProductRenamed(_ context.Context, e events.ProductRenamed) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	product, _ := p.store.Product(e.ID)
+	product.ID = e.ID
+	product.Name = e.Name
+	p.store.PutProduct(product)
+	return nil
+}
+
+func (p *OrderViews) OrderDeleted(_ context.Context, e events.OrderDeleted) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.store.DeleteOrder(e.ID)
+	return nil
+}
+
+// refresh builds the view of the order again, or deletes it if the order no longer exists
+func (p *OrderViews) refresh(ctx context.Context, id uuid.UUID) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	o, err := p.orders.GetByID(ctx, id)
+	if errors.Is(err, fails.ErrNotFound) {
+		// deleted since the event
+		p.store.DeleteOrder(id)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting order '%s': %w", id, err)
+	}
+
+	p.store.PutOrder(o)
+	return nil
+}
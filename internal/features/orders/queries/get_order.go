@@ -2,31 +2,103 @@ package queries
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/features/orders/readmodel"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/lib/projection"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
 )
 
+// catchUpTimeout is how long a query asking for fresh data waits for the read model to catch up
+const catchUpTimeout = 2 * time.Second
+
 type GetOrderRequest struct {
-	ID uuid.UUID `path:"id" doc:"Order ID"`
+	ID    uuid.UUID `path:"id" doc:"Order ID"`
+	Fresh bool      `query:"fresh" doc:"Wait for the changes committed so far to be in the read model, failing with 503 if they are not in time"`
+}
+
+// GetOrderQuery is a query for an order by ID.
+type GetOrderQuery struct {
+	ID uuid.UUID
+	// Fresh waits for the read model to catch up with the changes committed so far
+	Fresh bool
 }
 
 type OrderDTO struct {
-	ID        uuid.UUID `json:"id" path:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
-	ProductID uuid.UUID `json:"productId" path:"productId" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
-	Quantity  int       `json:"quantity" path:"quantity" example:"1" doc:"Quantity"`
+	ID      uuid.UUID       `json:"id" path:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Order ID"`
+	Lines   []OrderLineDTO  `json:"lines" doc:"Order lines"`
+	Total   float64         `json:"total" example:"21.98" doc:"Sum of the subtotals of the lines"`
+	Status  string          `json:"status" example:"pending" doc:"Order status"`
+	History []TransitionDTO `json:"history" doc:"Status transitions, oldest first"`
+	Version int             `json:"version" example:"1" doc:"Order version"`
+}
+
+type TransitionDTO struct {
+	From string    `json:"from,omitempty" example:"pending" doc:"Previous status, empty on creation"`
+	To   string    `json:"to" example:"confirmed" doc:"New status"`
+	At   time.Time `json:"at" doc:"When the transition happened"`
+}
+
+type OrderLineDTO struct {
+	ProductID uuid.UUID `json:"productId" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
+	SKU       string    `json:"sku,omitempty" example:"SKU-001" doc:"Product SKU"`
+	Name      string    `json:"name,omitempty" example:"Widget" doc:"Product name"`
+	Quantity  int       `json:"quantity" example:"2" doc:"Quantity"`
+	UnitPrice float64   `json:"unitPrice" example:"10.99" doc:"Product price at the time of the order"`
+	Subtotal  float64   `json:"subtotal" example:"21.98" doc:"Quantity times unit price"`
+}
+
+func toTransitionDTOs(history []domain.Transition) []TransitionDTO {
+	dtos := make([]TransitionDTO, 0, len(history))
+	for _, t := range history {
+		dtos = append(dtos, TransitionDTO{
+			From: string(t.From),
+			To:   string(t.To),
+			At:   t.At,
+		})
+	}
+	return dtos
+}
+
+func toOrderLineDTOs(lines []readmodel.LineView) []OrderLineDTO {
+	dtos := make([]OrderLineDTO, 0, len(lines))
+	for _, l := range lines {
+		dtos = append(dtos, OrderLineDTO{
+			ProductID: l.ProductID,
+			SKU:       l.SKU,
+			Name:      l.Name,
+			Quantity:  l.Quantity,
+			UnitPrice: l.UnitPrice,
+			Subtotal:  l.Subtotal,
+		})
+	}
+	return dtos
+}
+
+// catchUp waits for the read model to catch up, if fresh data was asked for
+func catchUp(ctx context.Context, cp projection.Checkpoint, fresh bool) error {
+	if !fresh {
+		return nil
+	}
+	return projection.Wait(ctx, cp, catchUpTimeout)
 }
 
 type GetOrderResponse struct {
+	ETag string `header:"ETag" doc:"Order version, to be used in If-Match"`
 	Body struct {
 		Order OrderDTO `json:"order" doc:"Order"`
 	}
 }
 
-func RegisterGetOrderController(api huma.API, repo Getter) {
-	handler := NewGetOrderHandler(repo)
+func RegisterGetOrderController(api huma.API, m *mediator.Mediator, orders Orders, views Getter, cp projection.Checkpoint) {
+	mediator.RegisterQuery(m, NewGetOrderHandler(orders, views, cp))
 
 	huma.Register(
 		api,
@@ -38,12 +110,13 @@ func RegisterGetOrderController(api huma.API, repo Getter) {
 			Tags:        []string{"orders"},
 		},
 		func(ctx context.Context, input *GetOrderRequest) (*GetOrderResponse, error) {
-			order, err := handler(ctx, input.ID)
+			order, err := mediator.Send[*OrderDTO](ctx, m, &GetOrderQuery{ID: input.ID, Fresh: input.Fresh})
 			if err != nil {
 				return nil, err
 			}
 
 			r := &GetOrderResponse{}
+			r.ETag = etag.Format(order.Version)
 			r.Body.Order = *order
 			return r, nil
 		},
@@ -51,20 +124,46 @@ func RegisterGetOrderController(api huma.API, repo Getter) {
 }
 
 type Getter interface {
+	GetByID(ctx context.Context, id uuid.UUID) (readmodel.OrderView, error)
+}
+
+// Orders returns the orders of the write model, whose versions are the ones checked by If-Match
+type Orders interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error)
 }
 
-func NewGetOrderHandler(repo Getter) func(ctx context.Context, id uuid.UUID) (*OrderDTO, error) {
-	return func(ctx context.Context, id uuid.UUID) (*OrderDTO, error) {
-		product, err := repo.GetByID(ctx, id)
+// NewGetOrderHandler returns a handler that reads the order from the read model.
+// The read model is caught up if it is behind the version of the write model, so that the ETag is never stale.
+func NewGetOrderHandler(orders Orders, views Getter, cp projection.Checkpoint) func(ctx context.Context, q *GetOrderQuery) (*OrderDTO, error) {
+	return func(ctx context.Context, q *GetOrderQuery) (*OrderDTO, error) {
+		err := catchUp(ctx, cp, q.Fresh)
+		if err != nil {
+			return nil, err
+		}
+
+		o, err := orders.GetByID(ctx, q.ID)
+		if err != nil {
+			return nil, err
+		}
+		order, err := views.GetByID(ctx, q.ID)
+		if errors.Is(err, fails.ErrNotFound) || (err == nil && order.Version < o.Version()) {
+			err = projection.Wait(ctx, cp, catchUpTimeout)
+			if err != nil {
+				return nil, err
+			}
+			order, err = views.GetByID(ctx, q.ID)
+		}
 		if err != nil {
 			return nil, err
 		}
 
 		return &OrderDTO{
-			ID:        product.ID(),
-			ProductID: product.ProductID(),
-			Quantity:  product.Quantity(),
+			ID:      order.ID,
+			Lines:   toOrderLineDTOs(order.Lines),
+			Total:   order.Total,
+			Status:  string(order.Status),
+			History: toTransitionDTOs(order.History),
+			Version: order.Version,
 		}, nil
 	}
 }
@@ -2,27 +2,66 @@ package queries
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/features/orders/readmodel"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/lib/projection"
 )
 
 type ListItemOrderDTO struct {
-	ID        uuid.UUID `json:"id" path:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
-	ProductID uuid.UUID `json:"productId" path:"productId" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
-	Quantity  int       `json:"quantity" path:"quantity" example:"1" doc:"Quantity"`
+	ID        uuid.UUID      `json:"id" path:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Order ID"`
+	Lines     []OrderLineDTO `json:"lines" doc:"Order lines"`
+	Total     float64        `json:"total" example:"21.98" doc:"Sum of the subtotals of the lines"`
+	Status    string         `json:"status" example:"pending" doc:"Order status"`
+	CreatedAt time.Time      `json:"createdAt" doc:"When the order was created"`
+}
+
+// ListOrdersQuery is a query for a page of the orders, filtered and sorted.
+type ListOrdersQuery struct {
+	// ProductID, if set, selects the orders with a line for the product
+	ProductID uuid.UUID
+	Status    domain.Status
+	// Sort is a key of domain.SortKeys, defaulting to domain.SortByCreated
+	Sort string
+	Desc bool
+	// Cursor is the next cursor of the previous page, sorted the same way
+	Cursor string
+	Limit  int
+	// Fresh waits for the read model to catch up with the changes committed so far
+	Fresh bool
+}
+
+type ListOrdersRequest struct {
+	ProductID string `query:"productId" format:"uuid" doc:"Only the orders with a line for this product"`
+	Status    string `query:"status" enum:"pending,confirmed,paid,shipped,delivered,cancelled,refunded" doc:"Only the orders in this status"`
+	Sort      string `query:"sort" enum:"created,total" default:"created" doc:"Sort key"`
+	Desc      bool   `query:"desc" doc:"Sort in descending order"`
+	Cursor    string `query:"cursor" doc:"Where the page starts, as returned in next by the previous page, that must be sorted the same way"`
+	Limit     int    `query:"limit" minimum:"1" maximum:"500" default:"50" doc:"Maximum number of orders in the page"`
+	Fresh     bool   `query:"fresh" doc:"Wait for the changes committed so far to be in the read model, failing with 503 if they are not in time"`
+}
+
+type ListOrdersPage struct {
+	Orders []ListItemOrderDTO
+	Next   string
 }
 
 type ListOrdersResponse struct {
 	Body struct {
-		Orders []ListItemOrderDTO `json:"orders" doc:"List of orders"`
+		Orders []ListItemOrderDTO `json:"orders" doc:"Page of orders"`
+		Next   string             `json:"next,omitempty" doc:"Cursor of the next page, if there are more orders"`
 	}
 }
 
-func RegisterListOrdersController(api huma.API, repo Lister) {
-	handler := NewListOrdersHandler(repo)
+func RegisterListOrdersController(api huma.API, m *mediator.Mediator, views Lister, cp projection.Checkpoint) {
+	mediator.RegisterQuery(m, NewListOrdersHandler(views, cp))
 
 	huma.Register(
 		api,
@@ -30,41 +69,86 @@ func RegisterListOrdersController(api huma.API, repo Lister) {
 			OperationID: "listOrders",
 			Method:      http.MethodGet,
 			Path:        "/orders",
-			Summary:     "List all orders",
+			Summary:     "List orders",
+			Description: "List a page of the orders, filtered and sorted",
 			Tags:        []string{"orders"},
 		},
-		func(ctx context.Context, _ *struct{}) (*ListOrdersResponse, error) {
-			products, err := handler(ctx)
+		func(ctx context.Context, input *ListOrdersRequest) (*ListOrdersResponse, error) {
+			var productID uuid.UUID
+			if input.ProductID != "" {
+				var err error
+				productID, err = uuid.Parse(input.ProductID)
+				if err != nil {
+					return nil, huma.Error400BadRequest(err.Error())
+				}
+			}
+
+			p, err := mediator.Send[ListOrdersPage](ctx, m, &ListOrdersQuery{
+				ProductID: productID,
+				Status:    domain.Status(input.Status),
+				Sort:      input.Sort,
+				Desc:      input.Desc,
+				Cursor:    input.Cursor,
+				Limit:     input.Limit,
+				Fresh:     input.Fresh,
+			})
 			if err != nil {
 				return nil, err
 			}
 
 			r := &ListOrdersResponse{}
-			r.Body.Orders = products
+			r.Body.Orders = p.Orders
+			r.Body.Next = p.Next
 			return r, nil
 		},
 	)
 }
 
 type Lister interface {
-	ListAll(ctx context.Context) ([]*domain.Order, error)
+	List(ctx context.Context, q domain.Query) (page.Page[readmodel.OrderView], error)
 }
 
-func NewListOrdersHandler(repo Lister) func(ctx context.Context) ([]ListItemOrderDTO, error) {
-	return func(ctx context.Context) ([]ListItemOrderDTO, error) {
-		orders, err := repo.ListAll(ctx)
+func NewListOrdersHandler(views Lister, cp projection.Checkpoint) func(ctx context.Context, q *ListOrdersQuery) (ListOrdersPage, error) {
+	return func(ctx context.Context, q *ListOrdersQuery) (ListOrdersPage, error) {
+		err := catchUp(ctx, cp, q.Fresh)
 		if err != nil {
-			return nil, err
+			return ListOrdersPage{}, fmt.Errorf("listing orders: %w", err)
 		}
 
-		var dtos []ListItemOrderDTO
-		for _, p := range orders {
-			dtos = append(dtos, ListItemOrderDTO{
-				ID:        p.ID(),
-				ProductID: p.ProductID(),
-				Quantity:  p.Quantity(),
+		after, err := page.ParseCursor(q.Cursor)
+		if err != nil {
+			return ListOrdersPage{}, fmt.Errorf("listing orders: %w", err)
+		}
+		req, err := page.Check(page.Request{Sort: q.Sort, Desc: q.Desc, After: after, Limit: q.Limit}, readmodel.SortKeys, domain.SortByCreated)
+		if err != nil {
+			return ListOrdersPage{}, fmt.Errorf("listing orders: %w", err)
+		}
+
+		orders, err := views.List(ctx, domain.Query{
+			ProductID: q.ProductID,
+			Status:    q.Status,
+			Page:      req,
+		})
+		if err != nil {
+			return ListOrdersPage{}, fmt.Errorf("listing orders: %w", err)
+		}
+
+		r := ListOrdersPage{
+			// an empty page is an empty list, not null
+			Orders: []ListItemOrderDTO{},
+		}
+		for _, o := range orders.Items {
+			r.Orders = append(r.Orders, ListItemOrderDTO{
+				ID:        o.ID,
+				Lines:     toOrderLineDTOs(o.Lines),
+				Total:     o.Total,
+				Status:    string(o.Status),
+				CreatedAt: o.CreatedAt,
 			})
 		}
-		return dtos, nil
+		if orders.Next != nil {
+			r.Next = orders.Next.String()
+		}
+		return r, nil
 	}
 }
@@ -0,0 +1,189 @@
+// Package readmodel holds the views of the orders read by the queries,
+// denormalized and kept up to date by the projections, apart from the aggregates changed by the commands.
+package readmodel
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+// OrderView is an order as shown by the queries, with the details of the products in its lines.
+type OrderView struct {
+	ID        uuid.UUID
+	Lines     []LineView
+	Total     float64
+	Status    domain.Status
+	History   []domain.Transition
+	CreatedAt time.Time
+	Version   int
+}
+
+type LineView struct {
+	ProductID uuid.UUID
+	SKU       string
+	Name      string
+	Quantity  int
+	UnitPrice float64
+	Subtotal  float64
+}
+
+// ProductView is what the order views show of a product.
+type ProductView struct {
+	ID   uuid.UUID
+	SKU  string
+	Name string
+}
+
+// NewOrderView returns the view of the order, with the details of the products found in products.
+func NewOrderView(o *domain.Order, products map[uuid.UUID]ProductView) OrderView {
+	lines := make([]LineView, 0, len(o.Lines()))
+	for _, l := range o.Lines() {
+		p := products[l.ProductID()]
+		lines = append(lines, LineView{
+			ProductID: l.ProductID(),
+			SKU:       p.SKU,
+			Name:      p.Name,
+			Quantity:  l.Quantity(),
+			UnitPrice: l.UnitPrice(),
+			Subtotal:  l.Subtotal(),
+		})
+	}
+
+	return OrderView{
+		ID:        o.ID(),
+		Lines:     lines,
+		Total:     o.Total(),
+		Status:    o.Status(),
+		History:   slices.Clone(o.History()),
+		CreatedAt: o.CreatedAt(),
+		Version:   o.Version(),
+	}
+}
+
+// SortKeys are the keys the order views can be sorted by, the same as the orders
+var SortKeys = map[string]page.Key[OrderView]{
+	domain.SortByCreated: page.TimeKey(func(v OrderView) time.Time { return v.CreatedAt }),
+	"total":              page.FloatKey(func(v OrderView) float64 { return v.Total }),
+}
+
+func viewID(v OrderView) uuid.UUID {
+	return v.ID
+}
+
+// Store keeps the order views, and the products they show, in memory.
+// The views are disposable: they are rebuilt from the orders on startup.
+type Store struct {
+	mu       sync.RWMutex
+	orders   map[uuid.UUID]OrderView
+	products map[uuid.UUID]ProductView
+}
+
+func NewStore() *Store {
+	return &Store{
+		orders:   make(map[uuid.UUID]OrderView),
+		products: make(map[uuid.UUID]ProductView),
+	}
+}
+
+func (s *Store) GetByID(_ context.Context, id uuid.UUID) (OrderView, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.orders[id]
+	if !ok {
+		return OrderView{}, fails.ErrNotFound
+	}
+	return v, nil
+}
+
+// List returns the page of the order views selected by the query, whose page request must have been checked.
+func (s *Store) List(_ context.Context, q domain.Query) (page.Page[OrderView], error) {
+	s.mu.RLock()
+	var selected []OrderView
+	for _, v := range s.orders {
+		if matches(q, v) {
+			selected = append(selected, v)
+		}
+	}
+	s.mu.RUnlock()
+
+	return page.Slice(selected, q.Page, SortKeys, viewID)
+}
+
+func matches(q domain.Query, v OrderView) bool {
+	if q.ProductID != uuid.Nil && !slices.ContainsFunc(v.Lines, func(l LineView) bool { return l.ProductID == q.ProductID }) {
+		return false
+	}
+	if q.Status != "" && v.Status != q.Status {
+		return false
+	}
+	return true
+}
+
+// PutOrder adds or replaces the view of the order, filling in the details of its products.
+func (s *Store) PutOrder(o *domain.Order) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.orders[o.ID()] = NewOrderView(o, s.products)
+}
+
+func (s *Store) DeleteOrder(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.orders, id)
+}
+
+// PutProduct adds or replaces the product, updating the lines of the views that show it.
+func (s *Store) PutProduct(p ProductView) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.products[p.ID] = p
+	for id, v := range s.orders {
+		if !slices.ContainsFunc(v.Lines, func(l LineView) bool { return l.ProductID == p.ID }) {
+			continue
+		}
+		// the views are shared with the readers, so they are copied before they change
+		v.Lines = slices.Clone(v.Lines)
+		for i := range v.Lines {
+			if v.Lines[i].ProductID == p.ID {
+				v.Lines[i].SKU = p.SKU
+				v.Lines[i].Name = p.Name
+			}
+		}
+		s.orders[id] = v
+	}
+}
+
+// Product returns the product, as known by the store.
+func (s *Store) Product(id uuid.UUID) (ProductView, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.products[id]
+	return p, ok
+}
+
+// Reset replaces all the views and products.
+func (s *Store) Reset(orders []*domain.Order, products []ProductView) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.products = make(map[uuid.UUID]ProductView, len(products))
+	for _, p := range products {
+		s.products[p.ID] = p
+	}
+	s.orders = make(map[uuid.UUID]OrderView, len(orders))
+	for _, o := range orders {
+		s.orders[o.ID()] = NewOrderView(o, s.products)
+	}
+}
@@ -2,29 +2,137 @@ package orders
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/features/orders/domain"
 	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
 	"github.com/quintans/vertical-slices/internal/shared"
+	"github.com/quintans/vertical-slices/internal/shared/events"
 	"github.com/quintans/vertical-slices/internal/shared/fails"
 )
 
 type Repo struct {
-	db       *infra.DB[*domain.Order]
-	eventBus shared.Publisher
+	db     *infra.DB[*domain.Order]
+	outbox shared.Outbox
 }
 
-func NewRepository(eb shared.Publisher) *Repo {
+func NewRepository(outbox shared.Outbox) *Repo {
 	return &Repo{
-		db:       infra.NewDB[*domain.Order](),
-		eventBus: eb,
+		db:     infra.NewDB(dbOptions...),
+		outbox: outbox,
 	}
 }
 
-func (r *Repo) GetByID(_ context.Context, id uuid.UUID) (*domain.Order, error) {
-	o, err := r.db.GetByID(id)
+// NewFileRepository returns a repository that keeps its data in the journal.
+func NewFileRepository(j *infra.Journal, outbox shared.Outbox) (*Repo, error) {
+	db, err := infra.NewFileDB(j, "orders", orderCodec{}, dbOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("opening orders db: %w", err)
+	}
+
+	return &Repo{
+		db:     db,
+		outbox: outbox,
+	}, nil
+}
+
+var dbOptions = []infra.Option[*domain.Order]{
+	infra.WithClone(cloneOrder),
+	infra.WithVersioning(orderVersion, withOrderVersion),
+}
+
+func cloneOrder(o *domain.Order) *domain.Order {
+	return withOrderVersion(o, o.Version())
+}
+
+func orderVersion(o *domain.Order) int {
+	return o.Version()
+}
+
+func withOrderVersion(o *domain.Order, version int) *domain.Order {
+	return domain.HydrateOrder(o.ID(), slices.Clone(o.Lines()), o.Status(), slices.Clone(o.History()), version)
+}
+
+type orderRecord struct {
+	ID      uuid.UUID          `json:"id"`
+	Lines   []lineRecord       `json:"lines"`
+	Status  domain.Status      `json:"status"`
+	History []transitionRecord `json:"history"`
+	Version int                `json:"version"`
+}
+
+type lineRecord struct {
+	ProductID uuid.UUID `json:"productId"`
+	Quantity  int       `json:"quantity"`
+	UnitPrice float64   `json:"unitPrice"`
+}
+
+type transitionRecord struct {
+	From domain.Status `json:"from,omitempty"`
+	To   domain.Status `json:"to"`
+	At   time.Time     `json:"at"`
+}
+
+type orderCodec struct{}
+
+func (orderCodec) Encode(o *domain.Order) ([]byte, error) {
+	lines := make([]lineRecord, 0, len(o.Lines()))
+	for _, l := range o.Lines() {
+		lines = append(lines, lineRecord{
+			ProductID: l.ProductID(),
+			Quantity:  l.Quantity(),
+			UnitPrice: l.UnitPrice(),
+		})
+	}
+
+	history := make([]transitionRecord, 0, len(o.History()))
+	for _, t := range o.History() {
+		history = append(history, transitionRecord(t))
+	}
+
+	return json.Marshal(orderRecord{
+		ID:      o.ID(),
+		Lines:   lines,
+		Status:  o.Status(),
+		History: history,
+		Version: o.Version(),
+	})
+}
+
+func (orderCodec) Decode(data []byte) (*domain.Order, error) {
+	var r orderRecord
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]domain.Line, 0, len(r.Lines))
+	for _, l := range r.Lines {
+		lines = append(lines, domain.HydrateLine(l.ProductID, l.Quantity, l.UnitPrice))
+	}
+
+	history := make([]domain.Transition, 0, len(r.History))
+	for _, t := range r.History {
+		history = append(history, domain.Transition(t))
+	}
+	if r.Status == "" {
+		// orders written before they had a status
+		r.Status = domain.StatusPending
+	}
+
+	return domain.HydrateOrder(r.ID, lines, r.Status, history, r.Version), nil
+}
+
+func (r *Repo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error) {
+	o, err := r.db.GetByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, infra.ErrDoesNotExist) {
 			return nil, fails.ErrNotFound
@@ -35,46 +143,94 @@ func (r *Repo) GetByID(_ context.Context, id uuid.UUID) (*domain.Order, error) {
 	return o, nil
 }
 
-func (r *Repo) ListAll(_ context.Context) ([]*domain.Order, error) {
-	data := r.db.ListAll()
+func (r *Repo) ListAll(ctx context.Context) ([]*domain.Order, error) {
+	data := r.db.ListAll(ctx)
 	return data, nil
 }
 
-func (r *Repo) Create(ctx context.Context, o *domain.Order) error {
-	err := r.db.Create(o.ID(), o)
-	if err != nil {
-		if errors.Is(err, infra.ErrUniquenessViolation) {
-			return fails.ErrAlreadyExists
+// List returns the page of the orders selected by the query, whose page request must have been checked.
+func (r *Repo) List(ctx context.Context, q domain.Query) (page.Page[*domain.Order], error) {
+	var selected []*domain.Order
+	for _, o := range r.db.ListAll(ctx) {
+		if q.Matches(o) {
+			selected = append(selected, o)
 		}
-		return err
 	}
+	return page.Slice(selected, q.Page, domain.SortKeys, domain.OrderID)
+}
 
-	// publish event
-	// This event can be consumed by an in process subscriber or by a message broker.
-	// In either case, in a real application, a transaction is needed to guarantee that the event is published only if the save is successful.
-	// In the case of a message broker, to guarantee consistency between the save and the publish, we would use the outbox pattern.
-	// Note: The context would be the carrier of the transaction.
-	r.eventBus.Publish(ctx, o.Events()...)
+func (r *Repo) Create(ctx context.Context, o *domain.Order) error {
+	// The events are not published here but stored in the outbox, from where a relay will publish them.
+	// Saving the order and storing its events in the same unit of work guarantees that the events are published only if the save is successful.
+	// If the caller already started a unit of work, carried by the context, this joins it.
+	return uow.Run(ctx, func(ctx context.Context) error {
+		err := r.db.Create(ctx, o.ID(), o)
+		if err != nil {
+			if errors.Is(err, infra.ErrUniquenessViolation) {
+				return fails.ErrAlreadyExists
+			}
+			return err
+		}
 
-	return nil
+		return r.addEvents(ctx, o.ID(), o.Version(), o.Events())
+	})
 }
 
-func (r *Repo) Delete(_ context.Context, id uuid.UUID) error {
-	r.db.Delete(id)
-	return nil
+// Delete removes the order, publishing OrderDeleted at the version following the last one of the order.
+// Deleting an order that does not exist does nothing.
+func (r *Repo) Delete(ctx context.Context, id uuid.UUID) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		o, err := r.db.GetByID(ctx, id)
+		if errors.Is(err, infra.ErrDoesNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = r.db.Delete(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return r.addEvents(ctx, id, o.Version()+1, []eventbus.Message{events.OrderDeleted{ID: id}})
+	})
 }
 
 func (r *Repo) Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Order) error) error {
-	err := r.db.Update(id, func(p *domain.Order) (*domain.Order, error) {
-		err := handler(ctx, p)
-		return p, err
-	})
-	if err != nil {
-		if errors.Is(err, infra.ErrDoesNotExist) {
-			return fails.ErrNotFound
+	return uow.Run(ctx, func(ctx context.Context) error {
+		var (
+			events  []eventbus.Message
+			version int
+		)
+		err := r.db.Update(ctx, id, func(p *domain.Order) (*domain.Order, error) {
+			err := handler(ctx, p)
+			events = p.Events()
+			// the version the order is saved at
+			version = p.Version() + 1
+			return p, err
+		})
+		if err != nil {
+			if errors.Is(err, infra.ErrDoesNotExist) {
+				return fails.ErrNotFound
+			}
+			return err
 		}
-		return err
+
+		return r.addEvents(ctx, id, version, events)
+	})
+}
+
+// addEvents stores the events in the outbox, to be published by the relay once the unit of work commits,
+// in envelopes telling the version of the order after them
+func (r *Repo) addEvents(ctx context.Context, id uuid.UUID, version int, events []eventbus.Message) error {
+	if len(events) == 0 {
+		return nil
 	}
 
+	err := r.outbox.Add(ctx, eventbus.Wrap(ctx, id, version, events...)...)
+	if err != nil {
+		return fmt.Errorf("adding order events to outbox: %w", err)
+	}
 	return nil
 }
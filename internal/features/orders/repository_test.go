@@ -0,0 +1,92 @@
+package orders_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+)
+
+// outbox records the envelopes added
+type outbox struct {
+	envs []eventbus.Envelope
+}
+
+func (o *outbox) Add(_ context.Context, envs ...eventbus.Envelope) error {
+	o.envs = append(o.envs, envs...)
+	return nil
+}
+
+type repository interface {
+	Create(ctx context.Context, o *domain.Order) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		newRepo func(t *testing.T, ob *outbox) repository
+	}{
+		{
+			name: "memory",
+			newRepo: func(_ *testing.T, ob *outbox) repository {
+				return orders.NewRepository(ob)
+			},
+		},
+		{
+			name: "sql",
+			newRepo: func(t *testing.T, ob *outbox) repository {
+				db, err := infra.OpenSQLite(filepath.Join(t.TempDir(), "orders.db"))
+				if err != nil {
+					t.Fatalf("OpenSQLite() error = %v", err)
+				}
+				t.Cleanup(func() { db.Close() })
+				repo, err := orders.NewSQLRepository(context.Background(), db, ob)
+				if err != nil {
+					t.Fatalf("NewSQLRepository() error = %v", err)
+				}
+				return repo
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			ob := &outbox{}
+			repo := tt.newRepo(t, ob)
+			lines := []domain.Line{domain.HydrateLine(uuid.New(), 1, 10)}
+			o := domain.HydrateOrder(uuid.New(), lines, domain.StatusCancelled, nil, 3)
+			err := repo.Create(ctx, o)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			err = repo.Delete(ctx, o.ID())
+			if err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if len(ob.envs) != 1 {
+				t.Fatalf("envelopes = %d, want 1", len(ob.envs))
+			}
+			env := ob.envs[0]
+			if env.Message != (events.OrderDeleted{ID: o.ID()}) || env.AggregateID != o.ID() || env.AggregateVersion != 4 {
+				t.Errorf("envelope = %+v, want OrderDeleted of the order at version 4", env)
+			}
+
+			err = repo.Delete(ctx, o.ID())
+			if err != nil {
+				t.Fatalf("second Delete() error = %v", err)
+			}
+			if len(ob.envs) != 1 {
+				t.Errorf("envelopes after deleting again = %d, want 1", len(ob.envs))
+			}
+		})
+	}
+}
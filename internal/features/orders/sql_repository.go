@@ -0,0 +1,467 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/orders/domain"
+	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+	"github.com/quintans/vertical-slices/internal/shared"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+var migrations = []infra.Migration{
+	{
+		Version: 1,
+		SQL: `CREATE TABLE orders (
+			id TEXT PRIMARY KEY,
+			product_id TEXT NOT NULL,
+			quantity INTEGER NOT NULL
+		)`,
+	},
+	{
+		Version: 2,
+		SQL:     `ALTER TABLE orders ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	},
+	{
+		Version: 3,
+		SQL: `CREATE TABLE order_lines (
+			order_id TEXT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+			line_no INTEGER NOT NULL,
+			product_id TEXT NOT NULL,
+			quantity INTEGER NOT NULL,
+			unit_price REAL NOT NULL,
+			PRIMARY KEY (order_id, line_no)
+		)`,
+	},
+	{
+		// the price at the time of the order was not recorded
+		Version: 4,
+		SQL:     `INSERT INTO order_lines (order_id, line_no, product_id, quantity, unit_price) SELECT id, 0, product_id, quantity, 0 FROM orders`,
+	},
+	{
+		Version: 5,
+		SQL:     `ALTER TABLE orders DROP COLUMN product_id`,
+	},
+	{
+		Version: 6,
+		SQL:     `ALTER TABLE orders DROP COLUMN quantity`,
+	},
+	{
+		Version: 7,
+		SQL:     `ALTER TABLE orders ADD COLUMN status TEXT NOT NULL DEFAULT 'pending'`,
+	},
+	{
+		Version: 8,
+		SQL: `CREATE TABLE order_transitions (
+			order_id TEXT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+			seq INTEGER NOT NULL,
+			from_status TEXT NOT NULL,
+			to_status TEXT NOT NULL,
+			at TIMESTAMP NOT NULL,
+			PRIMARY KEY (order_id, seq)
+		)`,
+	},
+	{
+		// the created time and the total are kept in the orders, to sort them
+		Version: 9,
+		SQL:     `ALTER TABLE orders ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00 +0000 UTC'`,
+	},
+	{
+		Version: 10,
+		SQL:     `UPDATE orders SET created_at = (SELECT at FROM order_transitions WHERE order_id = orders.id AND seq = 0) WHERE EXISTS (SELECT 1 FROM order_transitions WHERE order_id = orders.id AND seq = 0)`,
+	},
+	{
+		Version: 11,
+		SQL:     `ALTER TABLE orders ADD COLUMN total REAL NOT NULL DEFAULT 0`,
+	},
+	{
+		Version: 12,
+		SQL:     `UPDATE orders SET total = (SELECT COALESCE(SUM(quantity * unit_price), 0) FROM order_lines WHERE order_id = orders.id)`,
+	},
+}
+
+// SQLRepo is a repository backed by a SQL database
+type SQLRepo struct {
+	db     *sql.DB
+	outbox shared.Outbox
+}
+
+// NewSQLRepository returns a repository backed by db.
+// For the events to be stored atomically with the orders, the outbox should be kept in the same database.
+func NewSQLRepository(ctx context.Context, db *sql.DB, outbox shared.Outbox) (*SQLRepo, error) {
+	err := infra.Migrate(ctx, db, "orders", migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLRepo{
+		db:     db,
+		outbox: outbox,
+	}, nil
+}
+
+const (
+	selectOrder       = "SELECT id, status, version FROM orders"
+	selectLines       = "SELECT order_id, product_id, quantity, unit_price FROM order_lines"
+	selectTransitions = "SELECT order_id, from_status, to_status, at FROM order_transitions"
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// orderRow is an order without its lines and history
+type orderRow struct {
+	id      uuid.UUID
+	status  domain.Status
+	version int
+}
+
+func scanOrder(row scanner) (orderRow, error) {
+	var o orderRow
+	err := row.Scan(&o.id, &o.status, &o.version)
+	return o, err
+}
+
+// queryLines returns the lines of the orders matching the where clause, by order
+func queryLines(ctx context.Context, tx *sql.Tx, where string, args ...any) (map[uuid.UUID][]domain.Line, error) {
+	rows, err := tx.QueryContext(ctx, selectLines+where+" ORDER BY order_id, line_no", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := map[uuid.UUID][]domain.Line{}
+	for rows.Next() {
+		var (
+			orderID   uuid.UUID
+			productID uuid.UUID
+			quantity  int
+			unitPrice float64
+		)
+		err := rows.Scan(&orderID, &productID, &quantity, &unitPrice)
+		if err != nil {
+			return nil, err
+		}
+		lines[orderID] = append(lines[orderID], domain.HydrateLine(productID, quantity, unitPrice))
+	}
+	return lines, rows.Err()
+}
+
+// queryHistory returns the transitions of the orders matching the where clause, by order
+func queryHistory(ctx context.Context, tx *sql.Tx, where string, args ...any) (map[uuid.UUID][]domain.Transition, error) {
+	rows, err := tx.QueryContext(ctx, selectTransitions+where+" ORDER BY order_id, seq", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := map[uuid.UUID][]domain.Transition{}
+	for rows.Next() {
+		var (
+			orderID uuid.UUID
+			t       domain.Transition
+		)
+		err := rows.Scan(&orderID, &t.From, &t.To, &t.At)
+		if err != nil {
+			return nil, err
+		}
+		history[orderID] = append(history[orderID], t)
+	}
+	return history, rows.Err()
+}
+
+func getOrder(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*domain.Order, error) {
+	o, err := scanOrder(tx.QueryRowContext(ctx, selectOrder+" WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := queryLines(ctx, tx, " WHERE order_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	history, err := queryHistory(ctx, tx, " WHERE order_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.HydrateOrder(o.id, lines[o.id], o.status, history[o.id], o.version), nil
+}
+
+func (r *SQLRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Order, error) {
+	var o *domain.Order
+	err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		o, err = getOrder(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, infra.ErrDoesNotExist) {
+			return nil, fails.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func (r *SQLRepo) ListAll(ctx context.Context) ([]*domain.Order, error) {
+	var data []*domain.Order
+	err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, selectOrder)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var orders []orderRow
+		for rows.Next() {
+			o, err := scanOrder(rows)
+			if err != nil {
+				return err
+			}
+			orders = append(orders, o)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		lines, err := queryLines(ctx, tx, "")
+		if err != nil {
+			return err
+		}
+		history, err := queryHistory(ctx, tx, "")
+		if err != nil {
+			return err
+		}
+		for _, o := range orders {
+			data = append(data, domain.HydrateOrder(o.id, lines[o.id], o.status, history[o.id], o.version))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// sortColumns are the columns of the sort keys
+var sortColumns = map[string]string{
+	domain.SortByCreated: "created_at",
+	"total":              "total",
+}
+
+// List returns the page of the orders selected by the query, whose page request must have been checked.
+func (r *SQLRepo) List(ctx context.Context, q domain.Query) (page.Page[*domain.Order], error) {
+	var (
+		where []string
+		args  []any
+	)
+	if q.ProductID != uuid.Nil {
+		where = append(where, "EXISTS (SELECT 1 FROM order_lines WHERE order_id = orders.id AND product_id = ?)")
+		args = append(args, q.ProductID)
+	}
+	if q.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, q.Status)
+	}
+
+	key := domain.SortKeys[q.Page.Sort]
+	column := sortColumns[q.Page.Sort]
+	op, dir := ">", "ASC"
+	if q.Page.Desc {
+		op, dir = "<", "DESC"
+	}
+	if q.Page.After != nil {
+		v, err := key.Arg(q.Page.After.Value)
+		if err != nil {
+			return page.Page[*domain.Order]{}, err
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op))
+		args = append(args, v, v, q.Page.After.ID)
+	}
+
+	query := selectOrder
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// one more than asked, to know if there is a next page
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s LIMIT ?", column, dir)
+	args = append(args, q.Page.Limit+1)
+
+	var data []*domain.Order
+	err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var (
+			orders []orderRow
+			ids    []any
+		)
+		for rows.Next() {
+			o, err := scanOrder(rows)
+			if err != nil {
+				return err
+			}
+			orders = append(orders, o)
+			ids = append(ids, o.id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		in := " WHERE order_id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		lines, err := queryLines(ctx, tx, in, ids...)
+		if err != nil {
+			return err
+		}
+		history, err := queryHistory(ctx, tx, in, ids...)
+		if err != nil {
+			return err
+		}
+		for _, o := range orders {
+			data = append(data, domain.HydrateOrder(o.id, lines[o.id], o.status, history[o.id], o.version))
+		}
+		return nil
+	})
+	if err != nil {
+		return page.Page[*domain.Order]{}, err
+	}
+
+	return page.Of(data, q.Page, key, domain.OrderID), nil
+}
+
+func (r *SQLRepo) Create(ctx context.Context, o *domain.Order) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO orders (id, status, created_at, total, version) VALUES (?, ?, ?, ?, ?)",
+				o.ID(), o.Status(), o.CreatedAt().UTC(), o.Total(), o.Version())
+			if err != nil {
+				return err
+			}
+
+			for i, l := range o.Lines() {
+				_, err = tx.ExecContext(ctx, "INSERT INTO order_lines (order_id, line_no, product_id, quantity, unit_price) VALUES (?, ?, ?, ?, ?)",
+					o.ID(), i, l.ProductID(), l.Quantity(), l.UnitPrice())
+				if err != nil {
+					return err
+				}
+			}
+			return insertTransitions(ctx, tx, o.ID(), o.History(), 0)
+		})
+		if err != nil {
+			if errors.Is(err, infra.ErrUniquenessViolation) {
+				return fails.ErrAlreadyExists
+			}
+			return err
+		}
+
+		return r.addEvents(ctx, o.ID(), o.Version(), o.Events())
+	})
+}
+
+// insertTransitions inserts the transitions of history from the index from on
+func insertTransitions(ctx context.Context, tx *sql.Tx, id uuid.UUID, history []domain.Transition, from int) error {
+	for i := from; i < len(history); i++ {
+		t := history[i]
+		_, err := tx.ExecContext(ctx, "INSERT INTO order_transitions (order_id, seq, from_status, to_status, at) VALUES (?, ?, ?, ?, ?)",
+			id, i, t.From, t.To, t.At)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the order, publishing OrderDeleted at the version following the last one of the order.
+// Deleting an order that does not exist does nothing.
+func (r *SQLRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		var version int
+		err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+			return tx.QueryRowContext(ctx, "DELETE FROM orders WHERE id = ? RETURNING version", id).Scan(&version)
+		})
+		if errors.Is(err, infra.ErrDoesNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return r.addEvents(ctx, id, version+1, []eventbus.Message{events.OrderDeleted{ID: id}})
+	})
+}
+
+func (r *SQLRepo) Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Order) error) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		var (
+			events  []eventbus.Message
+			version int
+		)
+		err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+			o, err := getOrder(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			version = o.Version()
+			recorded := len(o.History())
+
+			err = handler(ctx, o)
+			if err != nil {
+				return err
+			}
+			events = o.Events()
+
+			// the lines do not change after the order is created
+			res, err := tx.ExecContext(ctx, "UPDATE orders SET status = ?, version = version + 1 WHERE id = ? AND version = ?", o.Status(), id, version)
+			if err != nil {
+				return err
+			}
+			err = infra.CheckVersion(res)
+			if err != nil {
+				return err
+			}
+
+			return insertTransitions(ctx, tx, id, o.History(), recorded)
+		})
+		if err != nil {
+			if errors.Is(err, infra.ErrDoesNotExist) {
+				return fails.ErrNotFound
+			}
+			return err
+		}
+
+		return r.addEvents(ctx, id, version+1, events)
+	})
+}
+
+// addEvents stores the events in the outbox, to be published by the relay once the unit of work commits,
+// in envelopes telling the version of the order after them
+func (r *SQLRepo) addEvents(ctx context.Context, id uuid.UUID, version int, events []eventbus.Message) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	err := r.outbox.Add(ctx, eventbus.Wrap(ctx, id, version, events...)...)
+	if err != nil {
+		return fmt.Errorf("adding order events to outbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package placeorder
+
+import (
+	"context"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+	"github.com/quintans/vertical-slices/internal/shared/keys"
+)
+
+var (
+	// InventoryKey is the inventory taking the stock of the orders, provided by whoever manages the stock
+	InventoryKey = module.NewKey[Inventory]("place-order.inventory")
+	// OrdersKey is what cancels the orders, provided by whoever manages the orders
+	OrdersKey = module.NewKey[Orders]("place-order.orders")
+)
+
+// Module runs the place order saga
+type Module struct {
+	timeout  time.Duration
+	interval time.Duration
+
+	saga       *Saga
+	background module.Background
+}
+
+// NewModule returns the module of the place order saga, that cancels the orders not confirmed within timeout.
+// The timeouts are checked every interval, defaulting to one minute.
+func NewModule(timeout, interval time.Duration) *Module {
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	return &Module{
+		timeout:  timeout,
+		interval: interval,
+	}
+}
+
+func (m *Module) Name() string {
+	return Name
+}
+
+func (m *Module) Provides() []string {
+	return nil
+}
+
+func (m *Module) Requires() []string {
+	return []string{
+		keys.EventBus.Name(),
+		keys.SagaStore.Name(),
+		InventoryKey.Name(),
+		OrdersKey.Name(),
+	}
+}
+
+func (m *Module) Init(_ context.Context, c *module.Container) error {
+	m.saga = New(
+		module.Get(c, keys.SagaStore),
+		module.Get(c, InventoryKey),
+		module.Get(c, OrdersKey),
+		m.timeout,
+	)
+
+	bus := module.Get(c, keys.EventBus)
+	retry := eventbus.WithRetry(eventbus.DefaultRetryPolicy(fails.ErrNotFound))
+	eventbus.Register(bus, m.saga.OrderCreated, eventbus.WithName("place-order.OrderCreated"), retry)
+	eventbus.Register(bus, m.saga.OrderConfirmed, eventbus.WithName("place-order.OrderConfirmed"), retry)
+	eventbus.Register(bus, m.saga.OrderCancelled, eventbus.WithName("place-order.OrderCancelled"), retry)
+
+	return nil
+}
+
+// Start cancels the orders whose saga timed out, periodically.
+func (m *Module) Start(ctx context.Context) error {
+	m.background.Go(ctx, func(ctx context.Context) {
+		m.saga.RunTimeouts(ctx, m.interval)
+	})
+	return nil
+}
+
+// Drain stops firing the timeouts, waiting for the ones in flight.
+func (m *Module) Drain(ctx context.Context) error {
+	return m.background.Stop(ctx)
+}
@@ -0,0 +1,100 @@
+// Package placeorder coordinates the orders and products slices while an order is placed:
+// the stock reserved when the order is created is taken when it is confirmed,
+// and the order is cancelled if the stock cannot be taken or it is not confirmed in time.
+package placeorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/saga"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+)
+
+const Name = "place-order"
+
+const (
+	stepAwaitingConfirmation = "awaiting-confirmation"
+	stepTakingStock          = "taking-stock"
+	stepCancelled            = "cancelled"
+
+	compensationCancelOrder = "cancel-order"
+)
+
+var (
+	// ErrStockUnavailable is returned by the inventory when the stock of the order can no longer be taken
+	ErrStockUnavailable = errors.New("stock unavailable")
+	ErrNotConfirmed     = errors.New("order not confirmed in time")
+)
+
+type Inventory interface {
+	// TakeStock takes the stock reserved for the order, failing with ErrStockUnavailable if any line is short or the stock was returned.
+	TakeStock(ctx context.Context, orderID uuid.UUID, lines []events.OrderLine) error
+}
+
+type Orders interface {
+	// CancelOrder cancels the order, doing nothing if it was already cancelled.
+	CancelOrder(ctx context.Context, id uuid.UUID) error
+}
+
+// Data is the state of a place order saga
+type Data struct {
+	Lines []events.OrderLine
+}
+
+// Saga is the place order saga, with the handlers of the messages it reacts to.
+type Saga struct {
+	*saga.Saga[Data]
+	OrderCreated   eventbus.Handler[events.OrderCreated]
+	OrderConfirmed eventbus.Handler[events.OrderConfirmed]
+	OrderCancelled eventbus.Handler[events.OrderCancelled]
+}
+
+// New returns the place order saga. An order that is not confirmed within timeout is cancelled.
+func New(store saga.Store, inventory Inventory, orders Orders, timeout time.Duration) *Saga {
+	s := saga.New[Data](Name, store)
+
+	s.Compensation(compensationCancelOrder, func(ctx context.Context, inst *saga.Instance[Data]) error {
+		id, err := uuid.Parse(inst.ID)
+		if err != nil {
+			return err
+		}
+		return orders.CancelOrder(ctx, id)
+	})
+	s.OnTimeout(func(_ context.Context, inst *saga.Instance[Data]) error {
+		return saga.Fail(fmt.Errorf("waiting %s in step %s: %w", timeout, inst.Step(), ErrNotConfirmed))
+	})
+
+	return &Saga{
+		Saga: s,
+		OrderCreated: saga.Start(s, func(m events.OrderCreated) string { return m.ID.String() }, func(_ context.Context, inst *saga.Instance[Data], m events.OrderCreated) error {
+			inst.Data.Lines = m.Lines
+			inst.AddCompensation(compensationCancelOrder)
+			inst.SetDeadline(time.Now().Add(timeout))
+			inst.GoTo(stepAwaitingConfirmation)
+			return nil
+		}),
+		OrderConfirmed: saga.On(s, func(m events.OrderConfirmed) string { return m.ID.String() }, func(ctx context.Context, inst *saga.Instance[Data], m events.OrderConfirmed) error {
+			inst.GoTo(stepTakingStock)
+			err := inventory.TakeStock(ctx, m.ID, m.Lines)
+			if errors.Is(err, ErrStockUnavailable) {
+				return saga.Fail(err)
+			}
+			if err != nil {
+				return err
+			}
+			inst.Complete()
+			return nil
+		}),
+		// the order was cancelled by someone else, so there is nothing left to do
+		OrderCancelled: saga.On(s, func(m events.OrderCancelled) string { return m.ID.String() }, func(_ context.Context, inst *saga.Instance[Data], _ events.OrderCancelled) error {
+			inst.GoTo(stepCancelled)
+			inst.Complete()
+			return nil
+		}),
+	}
+}
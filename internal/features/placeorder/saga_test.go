@@ -0,0 +1,130 @@
+package placeorder_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/placeorder"
+	"github.com/quintans/vertical-slices/internal/lib/saga"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+// inventory records the orders whose stock was taken, failing with err
+type inventory struct {
+	err   error
+	taken []uuid.UUID
+}
+
+func (i *inventory) TakeStock(_ context.Context, orderID uuid.UUID, _ []events.OrderLine) error {
+	if i.err != nil {
+		return i.err
+	}
+	i.taken = append(i.taken, orderID)
+	return nil
+}
+
+// orders records the orders cancelled
+type orders struct {
+	cancelled []uuid.UUID
+}
+
+func (o *orders) CancelOrder(_ context.Context, id uuid.UUID) error {
+	o.cancelled = append(o.cancelled, id)
+	return nil
+}
+
+func TestOrderConfirmed(t *testing.T) {
+	tests := []struct {
+		name          string
+		stockErr      error
+		wantTaken     int
+		wantCancelled int
+		wantStatus    saga.Status
+	}{
+		{
+			name:       "stock taken",
+			wantTaken:  1,
+			wantStatus: saga.StatusCompleted,
+		},
+		{
+			name:          "stock unavailable",
+			stockErr:      placeorder.ErrStockUnavailable,
+			wantCancelled: 1,
+			wantStatus:    saga.StatusCompensated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := saga.NewMemoryStore()
+			inv := &inventory{err: tt.stockErr}
+			ord := &orders{}
+			s := placeorder.New(store, inv, ord, time.Minute)
+			id := uuid.New()
+			lines := []events.OrderLine{{ProductID: uuid.New(), Quantity: 1}}
+
+			err := s.OrderCreated(ctx, events.OrderCreated{ID: id, Lines: lines})
+			if err != nil {
+				t.Fatalf("OrderCreated() error = %v", err)
+			}
+
+			err = s.OrderConfirmed(ctx, events.OrderConfirmed{ID: id, Lines: lines})
+			if err != nil {
+				t.Fatalf("OrderConfirmed() error = %v", err)
+			}
+			if len(inv.taken) != tt.wantTaken || len(ord.cancelled) != tt.wantCancelled {
+				t.Errorf("taken %v and cancelled %v, want %d and %d", inv.taken, ord.cancelled, tt.wantTaken, tt.wantCancelled)
+			}
+			st, err := store.Get(ctx, placeorder.Name, id.String())
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if st.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", st.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestConfirmedBeforeCreated(t *testing.T) {
+	ctx := context.Background()
+	store := saga.NewMemoryStore()
+	inv := &inventory{}
+	s := placeorder.New(store, inv, &orders{}, time.Minute)
+	id := uuid.New()
+	lines := []events.OrderLine{{ProductID: uuid.New(), Quantity: 2}}
+
+	err := s.OrderConfirmed(ctx, events.OrderConfirmed{ID: id, Lines: lines})
+	if !errors.Is(err, saga.ErrNotFound) {
+		t.Fatalf("OrderConfirmed() before OrderCreated() error = %v, want %v", err, saga.ErrNotFound)
+	}
+	// the handlers retry every error but fails.ErrNotFound
+	if errors.Is(err, fails.ErrNotFound) {
+		t.Fatalf("OrderConfirmed() before OrderCreated() error = %v, would not be retried", err)
+	}
+
+	err = s.OrderCreated(ctx, events.OrderCreated{ID: id, Lines: lines})
+	if err != nil {
+		t.Fatalf("OrderCreated() error = %v", err)
+	}
+	// the retry of OrderConfirmed
+	err = s.OrderConfirmed(ctx, events.OrderConfirmed{ID: id, Lines: lines})
+	if err != nil {
+		t.Fatalf("OrderConfirmed() retried error = %v", err)
+	}
+	if len(inv.taken) != 1 || inv.taken[0] != id {
+		t.Errorf("taken = %v, want the stock of %s", inv.taken, id)
+	}
+	st, err := store.Get(ctx, placeorder.Name, id.String())
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if st.Status != saga.StatusCompleted {
+		t.Errorf("status = %s, want %s", st.Status, saga.StatusCompleted)
+	}
+}
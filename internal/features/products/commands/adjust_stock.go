@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+)
+
+// AdjustStockCommand is a command for correcting the stock of a product outside of orders and restocks.
+type AdjustStockCommand struct {
+	ID      uuid.UUID
+	Version int
+	Delta   int
+	Reason  domain.AdjustmentReason
+}
+
+type AdjustStockRequest struct {
+	ID      uuid.UUID `path:"id" doc:"Product ID"`
+	IfMatch string    `header:"If-Match" doc:"Only adjust if the product still has this ETag"`
+	Body    struct {
+		Delta  int    `json:"delta" example:"-2" doc:"Units to add to, or remove from when negative, the stock"`
+		Reason string `json:"reason" enum:"damaged,lost,found,correction" example:"damaged" doc:"Reason for the adjustment"`
+	}
+}
+
+func RegisterAdjustStockController(api huma.API, m *mediator.Mediator, repo Updater) {
+	mediator.RegisterCommand(m, mediator.Void(NewAdjustStockHandler(repo)))
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "adjustStock",
+			Method:      http.MethodPost,
+			Path:        "/products/{id}/stock-adjustments",
+			Summary:     "Adjust Stock",
+			Description: "Correct the stock of a product, e.g. for damaged or lost units",
+			Tags:        []string{"products"},
+		},
+		func(ctx context.Context, req *AdjustStockRequest) (*struct{}, error) {
+			version, err := etag.Parse(req.IfMatch)
+			if err != nil {
+				return nil, err
+			}
+
+			err = mediator.Exec(ctx, m, &AdjustStockCommand{
+				ID:      req.ID,
+				Version: version,
+				Delta:   req.Body.Delta,
+				Reason:  domain.AdjustmentReason(req.Body.Reason),
+			})
+
+			return nil, err
+		},
+	)
+}
+
+func NewAdjustStockHandler(repo Updater) func(ctx context.Context, cmd *AdjustStockCommand) error {
+	return func(ctx context.Context, cmd *AdjustStockCommand) error {
+		err := repo.Update(ctx, cmd.ID, func(_ context.Context, p *domain.Product) error {
+			err := checkVersion(p, cmd.Version)
+			if err != nil {
+				return err
+			}
+
+			return p.AdjustStock(cmd.Delta, cmd.Reason)
+		})
+		if err != nil {
+			return fmt.Errorf("adjusting stock of product (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
@@ -2,18 +2,47 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
 )
 
 // CreateProductCommand is a command for creating a product.
 type CreateProductCommand struct {
-	SKU   string  `json:"sku" path:"sku" maxLength:"15" example:"P001" doc:"Product SKU"`
-	Name  string  `json:"name" path:"name" maxLength:"30" example:"Product 1" doc:"Product name"`
-	Price float64 `json:"price" path:"price" example:"10.99" doc:"Product price"`
+	SKU   string  `json:"sku" maxLength:"15" example:"P001" doc:"Product SKU"`
+	Name  string  `json:"name" maxLength:"30" example:"Product 1" doc:"Product name"`
+	Price float64 `json:"price" example:"10.99" doc:"Product price"`
+}
+
+// Validate fails if the SKU or the name are blank, or the price is not positive
+func (c *CreateProductCommand) Validate() error {
+	var errs []error
+	if strings.TrimSpace(c.SKU) == "" {
+		errs = append(errs, errors.New("sku is blank"))
+	}
+	errs = append(errs, validateDetails(c.Name, c.Price)...)
+	return errors.Join(errs...)
+}
+
+// validateDetails checks what is shared by the creation and the update of a product
+func validateDetails(name string, price float64) []error {
+	var errs []error
+	if strings.TrimSpace(name) == "" {
+		errs = append(errs, errors.New("name is blank"))
+	}
+	if price <= 0 {
+		errs = append(errs, errors.New("price is not positive"))
+	}
+	return errs
+}
+
+type CreateProductRequest struct {
+	Body CreateProductCommand
 }
 
 type CreateProductResponse struct {
@@ -22,8 +51,8 @@ type CreateProductResponse struct {
 	}
 }
 
-func RegisterCreateProductController(api huma.API, repo Creater) {
-	handler := NewCreateProductHandler(repo)
+func RegisterCreateProductController(api huma.API, m *mediator.Mediator, repo Creater) {
+	mediator.RegisterCommand(m, NewCreateProductHandler(repo))
 
 	huma.Register(
 		api,
@@ -35,8 +64,8 @@ func RegisterCreateProductController(api huma.API, repo Creater) {
 			Description: "Create a new product",
 			Tags:        []string{"products"},
 		},
-		func(ctx context.Context, cmd *CreateProductCommand) (*CreateProductResponse, error) {
-			id, err := handler(ctx, cmd)
+		func(ctx context.Context, req *CreateProductRequest) (*CreateProductResponse, error) {
+			id, err := mediator.Send[uuid.UUID](ctx, m, &req.Body)
 			if err != nil {
 				return nil, err
 			}
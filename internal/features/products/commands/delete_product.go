@@ -7,14 +7,25 @@ import (
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
 )
 
+// DeleteProductCommand is a command for deleting a product.
 type DeleteProductCommand struct {
-	ID uuid.UUID `path:"id" doc:"Product ID"`
+	ID      uuid.UUID
+	Version int
 }
 
-func RegisterDeleteProductController(api huma.API, repo Deleter) {
-	handler := NewDeleteProductHandler(repo)
+type DeleteProductRequest struct {
+	ID      uuid.UUID `path:"id" doc:"Product ID"`
+	IfMatch string    `header:"If-Match" doc:"Only delete if the product still has this ETag"`
+}
+
+func RegisterDeleteProductController(api huma.API, m *mediator.Mediator, repo Deleter) {
+	mediator.RegisterCommand(m, mediator.Void(NewDeleteProductHandler(repo)))
 
 	huma.Register(
 		api,
@@ -25,8 +36,16 @@ func RegisterDeleteProductController(api huma.API, repo Deleter) {
 			Summary:     "Delete Product",
 			Tags:        []string{"products"},
 		},
-		func(ctx context.Context, cmd *DeleteProductCommand) (*struct{}, error) {
-			err := handler(ctx, cmd.ID)
+		func(ctx context.Context, req *DeleteProductRequest) (*struct{}, error) {
+			version, err := etag.Parse(req.IfMatch)
+			if err != nil {
+				return nil, err
+			}
+
+			err = mediator.Exec(ctx, m, &DeleteProductCommand{
+				ID:      req.ID,
+				Version: version,
+			})
 
 			return nil, err
 		},
@@ -34,14 +53,27 @@ func RegisterDeleteProductController(api huma.API, repo Deleter) {
 }
 
 type Deleter interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Product, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
-func NewDeleteProductHandler(repo Deleter) func(ctx context.Context, id uuid.UUID) error {
-	return func(ctx context.Context, id uuid.UUID) error {
-		err := repo.Delete(ctx, id)
+// NewDeleteProductHandler returns a handler that deletes a product.
+// Only when the command has a version is the product read first, to fail if it was changed since that version.
+func NewDeleteProductHandler(repo Deleter) func(ctx context.Context, cmd *DeleteProductCommand) error {
+	return func(ctx context.Context, cmd *DeleteProductCommand) error {
+		if cmd.Version != 0 {
+			p, err := repo.GetByID(ctx, cmd.ID)
+			if err != nil {
+				return fmt.Errorf("getting product (%s): %w", cmd.ID, err)
+			}
+			if p.Version() != cmd.Version {
+				return fmt.Errorf("deleting product (%s) version %d, current is %d: %w", cmd.ID, cmd.Version, p.Version(), fails.ErrPreconditionFailed)
+			}
+		}
+
+		err := repo.Delete(ctx, cmd.ID)
 		if err != nil {
-			return fmt.Errorf("deleting product (%s): %w", id, err)
+			return fmt.Errorf("deleting product (%s): %w", cmd.ID, err)
 		}
 
 		return nil
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+type ReservationsReleaser interface {
+	ListAll(ctx context.Context) ([]*domain.Product, error)
+	Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Product) error) error
+}
+
+// NewReleaseExpiredReservationsHandler returns a handler that removes the expired reservations of all products,
+// returning how many were removed.
+// Expired reservations already don't hold stock, this is to clean them up.
+func NewReleaseExpiredReservationsHandler(repo ReservationsReleaser) func(ctx context.Context) (int, error) {
+	return func(ctx context.Context) (int, error) {
+		products, err := repo.ListAll(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("listing products: %w", err)
+		}
+
+		var (
+			released int
+			errs     []error
+		)
+		for _, product := range products {
+			if !product.HasExpiredReservations() {
+				continue
+			}
+
+			// each product in its own unit of work, so that a failure does not hold back the others
+			err := uow.Run(ctx, func(ctx context.Context) error {
+				return repo.Update(ctx, product.ID(), func(_ context.Context, p *domain.Product) error {
+					released += p.ReleaseExpired()
+					return nil
+				})
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("releasing expired reservations of product (%s): %w", product.ID(), err))
+			}
+		}
+
+		return released, errors.Join(errs...)
+	}
+}
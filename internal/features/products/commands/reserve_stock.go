@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+)
+
+// ReserveStockCommand is a command for holding stock of a product for an order.
+// It is not exposed through the API, orders reserve stock when they are created.
+type ReserveStockCommand struct {
+	ProductID uuid.UUID
+	OrderID   uuid.UUID
+	Quantity  int
+}
+
+// NewReserveStockHandler returns a handler that reserves stock for an order, for ttl.
+// It should run in the same unit of work that creates the order, so that the reservation is dropped if the order is not created.
+func NewReserveStockHandler(repo Updater, ttl time.Duration) func(ctx context.Context, cmd *ReserveStockCommand) error {
+	return func(ctx context.Context, cmd *ReserveStockCommand) error {
+		err := repo.Update(ctx, cmd.ProductID, func(_ context.Context, p *domain.Product) error {
+			return p.Reserve(cmd.OrderID, cmd.Quantity, ttl)
+		})
+		if err != nil {
+			return fmt.Errorf("reserving stock of product (%s): %w", cmd.ProductID, err)
+		}
+
+		return nil
+	}
+}
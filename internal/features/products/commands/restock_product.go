@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+)
+
+// RestockProductCommand is a command for adding new units to the stock of a product.
+type RestockProductCommand struct {
+	ID       uuid.UUID
+	Version  int
+	Quantity int
+}
+
+type RestockProductRequest struct {
+	ID      uuid.UUID `path:"id" doc:"Product ID"`
+	IfMatch string    `header:"If-Match" doc:"Only restock if the product still has this ETag"`
+	Body    struct {
+		Quantity int `json:"quantity" minimum:"1" example:"10" doc:"Units to add to the stock"`
+	}
+}
+
+func RegisterRestockProductController(api huma.API, m *mediator.Mediator, repo Updater) {
+	mediator.RegisterCommand(m, mediator.Void(NewRestockProductHandler(repo)))
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "restockProduct",
+			Method:      http.MethodPost,
+			Path:        "/products/{id}/restock",
+			Summary:     "Restock Product",
+			Description: "Add new units to the stock of a product",
+			Tags:        []string{"products"},
+		},
+		func(ctx context.Context, req *RestockProductRequest) (*struct{}, error) {
+			version, err := etag.Parse(req.IfMatch)
+			if err != nil {
+				return nil, err
+			}
+
+			err = mediator.Exec(ctx, m, &RestockProductCommand{
+				ID:       req.ID,
+				Version:  version,
+				Quantity: req.Body.Quantity,
+			})
+
+			return nil, err
+		},
+	)
+}
+
+func NewRestockProductHandler(repo Updater) func(ctx context.Context, cmd *RestockProductCommand) error {
+	return func(ctx context.Context, cmd *RestockProductCommand) error {
+		err := repo.Update(ctx, cmd.ID, func(_ context.Context, p *domain.Product) error {
+			err := checkVersion(p, cmd.Version)
+			if err != nil {
+				return err
+			}
+
+			return p.Restock(cmd.Quantity)
+		})
+		if err != nil {
+			return fmt.Errorf("restocking product (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
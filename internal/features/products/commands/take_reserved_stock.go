@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+// TakeReservedStockCommand is a command for taking from the stock the units reserved for an order.
+// It is not exposed through the API, it is issued when an order is confirmed.
+type TakeReservedStockCommand struct {
+	OrderID uuid.UUID
+	Lines   []TakeReservedStockLine
+}
+
+type TakeReservedStockLine struct {
+	ProductID uuid.UUID
+	Quantity  int
+}
+
+// Keys records the orders whose stock was already taken or returned,
+// so that a command issued more than once is only handled once.
+type Keys interface {
+	Claim(ctx context.Context, key string) (bool, error)
+	Contains(ctx context.Context, key string) (bool, error)
+}
+
+// NewTakeReservedStockHandler returns a handler that takes from the stock the units reserved for the order.
+// The products are updated in a single unit of work, so that if any line is short none is taken.
+func NewTakeReservedStockHandler(repo Updater, keys Keys) func(ctx context.Context, cmd *TakeReservedStockCommand) error {
+	return func(ctx context.Context, cmd *TakeReservedStockCommand) error {
+		return uow.Run(ctx, func(ctx context.Context) error {
+			taken, err := keys.Claim(ctx, domain.StockTakenKey(cmd.OrderID))
+			if err != nil || !taken {
+				return err
+			}
+			// the order was cancelled before its stock was taken, and the reservations released
+			returned, err := keys.Contains(ctx, domain.StockReturnedKey(cmd.OrderID))
+			if err != nil {
+				return err
+			}
+			if returned {
+				return fmt.Errorf("taking stock for order (%s): %w", cmd.OrderID, domain.ErrStockReturned)
+			}
+
+			for _, l := range cmd.Lines {
+				err := repo.Update(ctx, l.ProductID, func(_ context.Context, p *domain.Product) error {
+					return p.CommitReservation(cmd.OrderID, l.Quantity)
+				})
+				if err != nil {
+					return fmt.Errorf("taking stock of product (%s) for order (%s): %w", l.ProductID, cmd.OrderID, err)
+				}
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+// UpdateProductCommand is a command for changing the name and price of a product.
+type UpdateProductCommand struct {
+	ID      uuid.UUID
+	Version int
+	Name    string
+	Price   float64
+}
+
+// Validate fails if the name is blank or the price is not positive
+func (c *UpdateProductCommand) Validate() error {
+	return errors.Join(validateDetails(c.Name, c.Price)...)
+}
+
+type UpdateProductRequest struct {
+	ID      uuid.UUID `path:"id" doc:"Product ID"`
+	IfMatch string    `header:"If-Match" doc:"Only update if the product still has this ETag"`
+	Body    struct {
+		Name  string  `json:"name" maxLength:"30" example:"Product 1" doc:"Product name"`
+		Price float64 `json:"price" minimum:"0" example:"10.99" doc:"Product price"`
+	}
+}
+
+func RegisterUpdateProductController(api huma.API, m *mediator.Mediator, repo Updater) {
+	mediator.RegisterCommand(m, mediator.Void(NewUpdateProductHandler(repo)))
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "updateProduct",
+			Method:      http.MethodPut,
+			Path:        "/products/{id}",
+			Summary:     "Update Product",
+			Description: "Change the name and price of a product",
+			Tags:        []string{"products"},
+		},
+		func(ctx context.Context, req *UpdateProductRequest) (*struct{}, error) {
+			version, err := etag.Parse(req.IfMatch)
+			if err != nil {
+				return nil, err
+			}
+
+			err = mediator.Exec(ctx, m, &UpdateProductCommand{
+				ID:      req.ID,
+				Version: version,
+				Name:    req.Body.Name,
+				Price:   req.Body.Price,
+			})
+
+			return nil, err
+		},
+	)
+}
+
+type Updater interface {
+	Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Product) error) error
+}
+
+// NewUpdateProductHandler returns a handler that renames and reprices a product, publishing ProductRenamed and PriceChanged
+// for what actually changed. The orders already placed keep the unit prices they were created with.
+// A non zero command version guards against overwriting a change made by someone else since it was read.
+func NewUpdateProductHandler(repo Updater) func(ctx context.Context, cmd *UpdateProductCommand) error {
+	return func(ctx context.Context, cmd *UpdateProductCommand) error {
+		err := repo.Update(ctx, cmd.ID, func(_ context.Context, p *domain.Product) error {
+			err := checkVersion(p, cmd.Version)
+			if err != nil {
+				return err
+			}
+
+			p.Update(cmd.Name, cmd.Price)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("updating product (%s): %w", cmd.ID, err)
+		}
+
+		return nil
+	}
+}
+
+// checkVersion fails if version is not zero and the product no longer has it
+func checkVersion(p *domain.Product, version int) error {
+	if version != 0 && p.Version() != version {
+		return fmt.Errorf("expected version %d, current is %d: %w", version, p.Version(), fails.ErrPreconditionFailed)
+	}
+	return nil
+}
@@ -2,30 +2,70 @@ package domain
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/shared/events"
 )
 
-var ErrInsufficientStock = errors.New("insufficient stock")
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrInvalidQuantity   = errors.New("invalid quantity")
+	ErrInvalidReason     = errors.New("invalid stock adjustment reason")
+	// ErrStockReturned is returned when taking the stock of an order whose stock was already returned
+	ErrStockReturned = errors.New("stock already returned")
+)
+
+// AdjustmentReason explains why the stock was adjusted outside of orders and restocks.
+type AdjustmentReason string
+
+const (
+	ReasonDamaged    AdjustmentReason = "damaged"
+	ReasonLost       AdjustmentReason = "lost"
+	ReasonFound      AdjustmentReason = "found"
+	ReasonCorrection AdjustmentReason = "correction"
+)
+
+var reasons = []AdjustmentReason{ReasonDamaged, ReasonLost, ReasonFound, ReasonCorrection}
 
 // Product represents a product in our catalog.
 type Product struct {
-	id       uuid.UUID
-	sku      string
-	name     string
-	price    float64
-	quantity int
+	id        uuid.UUID
+	sku       string
+	name      string
+	price     float64
+	quantity  int
+	createdAt time.Time
+	version   int
+
+	reservations []Reservation
+
+	events []eventbus.Message
 }
 
 // NewProduct creates a new product.
 func NewProduct(sku, name string, price float64, quantity int) *Product {
-	return &Product{
-		id:       uuid.New(),
-		sku:      sku,
-		name:     name,
-		price:    price,
-		quantity: quantity,
+	p := &Product{
+		id:        uuid.New(),
+		sku:       sku,
+		name:      name,
+		price:     price,
+		quantity:  quantity,
+		createdAt: time.Now().UTC(),
+		version:   1,
 	}
+
+	p.events = append(p.events, events.ProductCreated{
+		ID:    p.id,
+		SKU:   p.sku,
+		Name:  p.name,
+		Price: p.price,
+	})
+
+	return p
 }
 
 // ID returns the product's ID.
@@ -50,24 +90,98 @@ func (p *Product) Quantity() int {
 	return p.quantity
 }
 
+// CreatedAt returns when the product was created, or the zero time if that was not recorded.
+func (p *Product) CreatedAt() time.Time {
+	return p.createdAt
+}
+
+// Version returns the product's version, incremented every time the product is saved.
+func (p *Product) Version() int {
+	return p.version
+}
+
+func (p *Product) Events() []eventbus.Message {
+	return p.events
+}
+
+// Update changes the product's name and price.
+func (p *Product) Update(name string, price float64) {
+	if name != p.name {
+		p.name = name
+		p.events = append(p.events, events.ProductRenamed{
+			ID:   p.id,
+			Name: name,
+		})
+	}
+
+	if price != p.price {
+		p.events = append(p.events, events.PriceChanged{
+			ID:       p.id,
+			OldPrice: p.price,
+			NewPrice: price,
+		})
+		p.price = price
+	}
+}
+
+// Restock adds new units to the stock.
+func (p *Product) Restock(quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("restocking %d units: %w", quantity, ErrInvalidQuantity)
+	}
+
+	p.IncreaseStock(quantity)
+	p.events = append(p.events, events.ProductRestocked{
+		ID:       p.id,
+		Quantity: quantity,
+		Stock:    p.quantity,
+	})
+	return nil
+}
+
+// AdjustStock corrects the stock by delta units, that can be negative, for the given reason.
+func (p *Product) AdjustStock(delta int, reason AdjustmentReason) error {
+	if !slices.Contains(reasons, reason) {
+		return fmt.Errorf("adjusting stock: '%s': %w", reason, ErrInvalidReason)
+	}
+	if delta == 0 {
+		return fmt.Errorf("adjusting stock by 0 units: %w", ErrInvalidQuantity)
+	}
+	if p.Available()+delta < 0 {
+		return fmt.Errorf("adjusting stock by %d units, %d available: %w", delta, p.Available(), ErrInsufficientStock)
+	}
+
+	p.quantity += delta
+	p.events = append(p.events, events.StockAdjusted{
+		ID:     p.id,
+		Delta:  delta,
+		Reason: string(reason),
+		Stock:  p.quantity,
+	})
+	return nil
+}
+
 func (p *Product) IncreaseStock(quantity int) {
 	p.quantity += quantity
 }
 
 func (p *Product) DecreaseStock(quantity int) error {
-	if p.quantity < quantity {
+	if p.Available() < quantity {
 		return ErrInsufficientStock
 	}
 	p.quantity -= quantity
 	return nil
 }
 
-func HydrateProduct(id uuid.UUID, sku, name string, price float64, quantity int) *Product {
+func HydrateProduct(id uuid.UUID, sku, name string, price float64, quantity int, reservations []Reservation, createdAt time.Time, version int) *Product {
 	return &Product{
-		id:       id,
-		sku:      sku,
-		name:     name,
-		price:    price,
-		quantity: quantity,
+		id:           id,
+		sku:          sku,
+		name:         name,
+		price:        price,
+		quantity:     quantity,
+		reservations: reservations,
+		createdAt:    createdAt,
+		version:      version,
 	}
 }
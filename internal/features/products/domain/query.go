@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+)
+
+// SortByCreated is the default sort key of the products
+const SortByCreated = "created"
+
+// SortKeys are the keys the products can be sorted by
+var SortKeys = map[string]page.Key[*Product]{
+	"name":        page.StringKey((*Product).Name),
+	"price":       page.FloatKey((*Product).Price),
+	"sku":         page.StringKey((*Product).SKU),
+	SortByCreated: page.TimeKey((*Product).CreatedAt),
+}
+
+// ProductID identifies the products in the pages
+func ProductID(p *Product) uuid.UUID {
+	return p.ID()
+}
+
+// Query selects a page of the products.
+type Query struct {
+	// Name, if set, selects the products with a name containing it, ignoring the case
+	Name string
+	// MinPrice and MaxPrice, if set, select the products with a price within them, inclusive
+	MinPrice *float64
+	MaxPrice *float64
+	Page     page.Request
+}
+
+// Matches reports whether the product is selected by the filters of the query.
+func (q Query) Matches(p *Product) bool {
+	if q.Name != "" && !strings.Contains(strings.ToLower(p.Name()), strings.ToLower(q.Name)) {
+		return false
+	}
+	if q.MinPrice != nil && p.Price() < *q.MinPrice {
+		return false
+	}
+	if q.MaxPrice != nil && p.Price() > *q.MaxPrice {
+		return false
+	}
+	return true
+}
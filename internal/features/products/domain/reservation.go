@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+)
+
+const (
+	releasedCancelled = "cancelled"
+	releasedExpired   = "expired"
+)
+
+// Reservation is stock held for an order until the order is confirmed or cancelled, or the reservation expires.
+// Expired reservations no longer hold stock, even before they are released.
+type Reservation struct {
+	OrderID   uuid.UUID
+	Quantity  int
+	ExpiresAt time.Time
+}
+
+func (r Reservation) expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+func (p *Product) Reservations() []Reservation {
+	return p.reservations
+}
+
+// Reserved returns the units held by the reservations that did not expire
+func (p *Product) Reserved() int {
+	now := time.Now()
+	var reserved int
+	for _, r := range p.reservations {
+		if !r.expired(now) {
+			reserved += r.Quantity
+		}
+	}
+	return reserved
+}
+
+// Available returns the units in stock that are not reserved
+func (p *Product) Available() int {
+	return p.quantity - p.Reserved()
+}
+
+// Reserve holds quantity units for the order, for ttl.
+// Reserving again for the same order replaces the previous reservation.
+func (p *Product) Reserve(orderID uuid.UUID, quantity int, ttl time.Duration) error {
+	if quantity <= 0 {
+		return fmt.Errorf("reserving %d units: %w", quantity, ErrInvalidQuantity)
+	}
+
+	p.removeReservation(orderID)
+	if p.Available() < quantity {
+		return fmt.Errorf("reserving %d units, %d available: %w", quantity, p.Available(), ErrInsufficientStock)
+	}
+
+	r := Reservation{
+		OrderID:   orderID,
+		Quantity:  quantity,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	p.reservations = append(p.reservations, r)
+	p.events = append(p.events, events.StockReserved{
+		ID:        p.id,
+		OrderID:   orderID,
+		Quantity:  quantity,
+		ExpiresAt: r.ExpiresAt,
+	})
+	return nil
+}
+
+// CommitReservation takes from the stock the quantity units reserved for the order.
+// If the reservation is gone, eg: it expired, or it holds fewer units, the units are taken if they are still available.
+func (p *Product) CommitReservation(orderID uuid.UUID, quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("committing %d units: %w", quantity, ErrInvalidQuantity)
+	}
+
+	// the units of the order's own reservation become available
+	p.removeReservation(orderID)
+	if p.Available() < quantity {
+		return fmt.Errorf("committing %d units, %d available: %w", quantity, p.Available(), ErrInsufficientStock)
+	}
+
+	p.quantity -= quantity
+	p.events = append(p.events, events.ReservationCommitted{
+		ID:       p.id,
+		OrderID:  orderID,
+		Quantity: quantity,
+		Stock:    p.quantity,
+	})
+	return nil
+}
+
+// ReleaseReservation frees the stock reserved for the order, if any.
+func (p *Product) ReleaseReservation(orderID uuid.UUID) {
+	if r, ok := p.removeReservation(orderID); ok {
+		p.releasedEvent(r, releasedCancelled)
+	}
+}
+
+// ReturnStock puts back in the stock the quantity units taken for the order.
+func (p *Product) ReturnStock(orderID uuid.UUID, quantity int) {
+	p.IncreaseStock(quantity)
+	p.events = append(p.events, events.StockReturned{
+		ID:       p.id,
+		OrderID:  orderID,
+		Quantity: quantity,
+		Stock:    p.quantity,
+	})
+}
+
+// ReleaseExpired removes the reservations that expired, returning how many.
+func (p *Product) ReleaseExpired() int {
+	now := time.Now()
+	var released int
+	p.reservations = slices.DeleteFunc(p.reservations, func(r Reservation) bool {
+		if !r.expired(now) {
+			return false
+		}
+		p.releasedEvent(r, releasedExpired)
+		released++
+		return true
+	})
+	return released
+}
+
+// HasExpiredReservations returns true if any reservation expired.
+func (p *Product) HasExpiredReservations() bool {
+	now := time.Now()
+	return slices.ContainsFunc(p.reservations, func(r Reservation) bool {
+		return r.expired(now)
+	})
+}
+
+func (p *Product) removeReservation(orderID uuid.UUID) (Reservation, bool) {
+	i := slices.IndexFunc(p.reservations, func(r Reservation) bool {
+		return r.OrderID == orderID
+	})
+	if i < 0 {
+		return Reservation{}, false
+	}
+
+	r := p.reservations[i]
+	p.reservations = slices.Delete(p.reservations, i, i+1)
+	return r, true
+}
+
+func (p *Product) releasedEvent(r Reservation, reason string) {
+	p.events = append(p.events, events.ReservationReleased{
+		ID:       p.id,
+		OrderID:  r.OrderID,
+		Quantity: r.Quantity,
+		Reason:   reason,
+	})
+}
+
+// StockTakenKey is the idempotency key recording that the stock reserved for the order was taken
+func StockTakenKey(orderID uuid.UUID) string {
+	return "products.stock-taken:" + orderID.String()
+}
+
+// StockReturnedKey is the idempotency key recording that the stock of the order was released or returned
+func StockReturnedKey(orderID uuid.UUID) string {
+	return "products.stock-returned:" + orderID.String()
+}
@@ -0,0 +1,170 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+)
+
+var (
+	order = uuid.New()
+	other = uuid.New()
+)
+
+func live(orderID uuid.UUID, quantity int) domain.Reservation {
+	return domain.Reservation{OrderID: orderID, Quantity: quantity, ExpiresAt: time.Now().Add(time.Hour)}
+}
+
+func expired(orderID uuid.UUID, quantity int) domain.Reservation {
+	return domain.Reservation{OrderID: orderID, Quantity: quantity, ExpiresAt: time.Now().Add(-time.Second)}
+}
+
+// product returns a product with 10 units in stock and the reservations
+func product(reservations ...domain.Reservation) *domain.Product {
+	return domain.HydrateProduct(uuid.New(), "SKU-1", "pen", 1.5, 10, reservations, time.Now(), 1)
+}
+
+func kinds(p *domain.Product) []string {
+	var kinds []string
+	for _, e := range p.Events() {
+		kinds = append(kinds, e.Kind())
+	}
+	return kinds
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name          string
+		reservations  []domain.Reservation
+		quantity      int
+		wantErr       error
+		wantAvailable int
+	}{
+		{name: "available", reservations: []domain.Reservation{live(other, 3)}, quantity: 7, wantAvailable: 0},
+		{name: "not available", reservations: []domain.Reservation{live(other, 3)}, quantity: 8, wantErr: domain.ErrInsufficientStock, wantAvailable: 7},
+		{name: "expired reservations hold no stock", reservations: []domain.Reservation{expired(other, 3)}, quantity: 10, wantAvailable: 0},
+		{name: "replaces the reservation of the order", reservations: []domain.Reservation{live(order, 5)}, quantity: 10, wantAvailable: 0},
+		{name: "invalid quantity", quantity: 0, wantErr: domain.ErrInvalidQuantity, wantAvailable: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := product(tt.reservations...)
+
+			err := p.Reserve(order, tt.quantity, time.Minute)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve() error = %v, want %v", err, tt.wantErr)
+			}
+			if p.Available() != tt.wantAvailable {
+				t.Errorf("Available() = %d, want %d", p.Available(), tt.wantAvailable)
+			}
+			if p.Quantity() != 10 {
+				t.Errorf("Quantity() = %d, want the stock untouched", p.Quantity())
+			}
+			if err == nil && len(kinds(p)) != 1 {
+				t.Errorf("events = %v, want StockReserved", kinds(p))
+			}
+		})
+	}
+}
+
+func TestCommitReservation(t *testing.T) {
+	tests := []struct {
+		name         string
+		reservations []domain.Reservation
+		quantity     int
+		wantErr      error
+		wantQuantity int
+	}{
+		{name: "reserved", reservations: []domain.Reservation{live(order, 4)}, quantity: 4, wantQuantity: 6},
+		{name: "expired reservation with stock available", reservations: []domain.Reservation{expired(order, 4)}, quantity: 4, wantQuantity: 6},
+		{name: "no reservation with stock available", quantity: 2, wantQuantity: 8},
+		{name: "no reservation with the stock held by others", reservations: []domain.Reservation{live(other, 8)}, quantity: 4, wantErr: domain.ErrInsufficientStock, wantQuantity: 10},
+		{name: "reservation of fewer units with stock available", reservations: []domain.Reservation{live(order, 2)}, quantity: 4, wantQuantity: 6},
+		{name: "reservation of fewer units with the stock held by others", reservations: []domain.Reservation{live(order, 2), live(other, 7)}, quantity: 4, wantErr: domain.ErrInsufficientStock, wantQuantity: 10},
+		{name: "invalid quantity", reservations: []domain.Reservation{live(order, 2)}, quantity: 0, wantErr: domain.ErrInvalidQuantity, wantQuantity: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := product(tt.reservations...)
+
+			err := p.CommitReservation(order, tt.quantity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CommitReservation() error = %v, want %v", err, tt.wantErr)
+			}
+			if p.Quantity() != tt.wantQuantity {
+				t.Errorf("Quantity() = %d, want %d", p.Quantity(), tt.wantQuantity)
+			}
+			if err != nil {
+				return
+			}
+			for _, r := range p.Reservations() {
+				if r.OrderID == order {
+					t.Errorf("reservation of the order left after commit: %+v", r)
+				}
+			}
+		})
+	}
+}
+
+func TestReleaseExpired(t *testing.T) {
+	p := product(expired(order, 1), live(other, 2), expired(uuid.New(), 3))
+	if !p.HasExpiredReservations() {
+		t.Fatal("HasExpiredReservations() = false, want true")
+	}
+
+	released := p.ReleaseExpired()
+	if released != 2 {
+		t.Errorf("ReleaseExpired() = %d, want 2", released)
+	}
+	if rs := p.Reservations(); len(rs) != 1 || rs[0].OrderID != other {
+		t.Errorf("Reservations() = %v, want the live one", rs)
+	}
+	if p.HasExpiredReservations() {
+		t.Error("HasExpiredReservations() after release = true, want false")
+	}
+	if got := kinds(p); len(got) != 2 || got[0] != "ReservationReleased" {
+		t.Errorf("events = %v, want two ReservationReleased", got)
+	}
+}
+
+func TestReleaseReservation(t *testing.T) {
+	tests := []struct {
+		name         string
+		reservations []domain.Reservation
+		wantEvents   int
+	}{
+		{name: "reserved", reservations: []domain.Reservation{live(order, 4), live(other, 1)}, wantEvents: 1},
+		{name: "not reserved", reservations: []domain.Reservation{live(other, 1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := product(tt.reservations...)
+
+			p.ReleaseReservation(order)
+			if p.Available() != 9 {
+				t.Errorf("Available() = %d, want 9", p.Available())
+			}
+			if len(p.Events()) != tt.wantEvents {
+				t.Errorf("events = %v, want %d", kinds(p), tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestReturnStock(t *testing.T) {
+	p := product()
+
+	p.ReturnStock(order, 3)
+	if p.Quantity() != 13 {
+		t.Errorf("Quantity() = %d, want 13", p.Quantity())
+	}
+	if got := kinds(p); len(got) == 0 || got[len(got)-1] != "StockReturned" {
+		t.Errorf("events = %v, want StockReturned last", got)
+	}
+}
@@ -0,0 +1,15 @@
+package products
+
+import (
+	"net/http"
+
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/problem"
+)
+
+// RegisterErrors maps the errors of the products domain to HTTP problems
+func RegisterErrors(m *problem.Mapper) {
+	m.Map(domain.ErrInsufficientStock, http.StatusUnprocessableEntity, "products.insufficient_stock")
+	m.Map(domain.ErrInvalidQuantity, http.StatusUnprocessableEntity, "products.invalid_quantity")
+	m.Map(domain.ErrInvalidReason, http.StatusUnprocessableEntity, "products.invalid_reason")
+}
@@ -0,0 +1,55 @@
+package eventhandlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+	"github.com/quintans/vertical-slices/internal/shared/events"
+)
+
+type Updater interface {
+	Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Product) error) error
+}
+
+// Keys records the orders whose stock was already taken or returned,
+// so that a message delivered more than once is only handled once.
+type Keys interface {
+	Claim(ctx context.Context, key string) (bool, error)
+	Contains(ctx context.Context, key string) (bool, error)
+}
+
+// NewOrderCancelledHandler returns a handler that releases the stock reserved for the order,
+// or returns it to the products if it was already taken.
+// This is done only once, even if the message is delivered more than once.
+func NewOrderCancelledHandler(repo Updater, keys Keys) eventbus.Handler[events.OrderCancelled] {
+	return func(ctx context.Context, m events.OrderCancelled) error {
+		return uow.Run(ctx, func(ctx context.Context) error {
+			returned, err := keys.Claim(ctx, domain.StockReturnedKey(m.ID))
+			if err != nil || !returned {
+				return err
+			}
+			taken, err := keys.Contains(ctx, domain.StockTakenKey(m.ID))
+			if err != nil {
+				return err
+			}
+
+			for _, l := range m.Lines {
+				err := repo.Update(ctx, l.ProductID, func(ctx context.Context, p *domain.Product) error {
+					p.ReleaseReservation(m.ID)
+					if taken {
+						p.ReturnStock(m.ID, l.Quantity)
+					}
+					return nil
+				})
+				if err != nil {
+					return fmt.Errorf("returning stock of product '%s' for order '%s': %w", l.ProductID, m.ID, err)
+				}
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package products
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/commands"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/features/products/eventhandlers"
+	"github.com/quintans/vertical-slices/internal/features/products/queries"
+	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/idempotency"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+	"github.com/quintans/vertical-slices/internal/shared/keys"
+)
+
+// Repository is the products repository provided to the other modules
+type Repository interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Product, error)
+	GetBySKU(ctx context.Context, sku string) (*domain.Product, error)
+	ListAll(ctx context.Context) ([]*domain.Product, error)
+	List(ctx context.Context, q domain.Query) (page.Page[*domain.Product], error)
+	Create(ctx context.Context, p *domain.Product) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Product) error) error
+	GetProductPrice(ctx context.Context, id uuid.UUID) (float64, error)
+}
+
+var RepositoryKey = module.NewKey[Repository]("products.repository")
+
+// Module is the products slice
+type Module struct {
+	storage       infra.Storage
+	sweepInterval time.Duration
+
+	repo       Repository
+	background module.Background
+}
+
+// NewModule returns the products slice, keeping its data in storage.
+// The expired stock reservations are cleaned up every sweepInterval, defaulting to one minute.
+func NewModule(storage infra.Storage, sweepInterval time.Duration) *Module {
+	if sweepInterval == 0 {
+		sweepInterval = time.Minute
+	}
+
+	return &Module{
+		storage:       storage,
+		sweepInterval: sweepInterval,
+	}
+}
+
+func (m *Module) Name() string {
+	return "products"
+}
+
+func (m *Module) Provides() []string {
+	return []string{RepositoryKey.Name()}
+}
+
+func (m *Module) Requires() []string {
+	requires := []string{
+		keys.API.Name(),
+		keys.Errors.Name(),
+		keys.Mediator.Name(),
+		keys.EventBus.Name(),
+		keys.Outbox.Name(),
+		keys.Idempotency.Name(),
+	}
+	switch m.storage.Backend {
+	case infra.BackendSQLite:
+		requires = append(requires, keys.SQL.Name())
+	case infra.BackendFile:
+		requires = append(requires, keys.Journal.Name())
+	}
+	return requires
+}
+
+func (m *Module) Init(ctx context.Context, c *module.Container) error {
+	var err error
+	m.repo, err = m.newRepository(ctx, c)
+	if err != nil {
+		return err
+	}
+	module.Provide(c, RepositoryKey, m.repo)
+
+	RegisterErrors(module.Get(c, keys.Errors))
+
+	api, med := module.Get(c, keys.API), module.Get(c, keys.Mediator)
+	commands.RegisterCreateProductController(api, med, m.repo)
+	commands.RegisterDeleteProductController(api, med, m.repo)
+	commands.RegisterUpdateProductController(api, med, m.repo)
+	commands.RegisterRestockProductController(api, med, m.repo)
+	commands.RegisterAdjustStockController(api, med, m.repo)
+	queries.RegisterGetProductController(api, med, m.repo)
+	queries.RegisterGetProductBySKUController(api, med, m.repo)
+	queries.RegisterListProductsController(api, med, m.repo)
+
+	const orderCancelled = "products.OrderCancelled"
+	idem := module.Get(c, keys.Idempotency)
+	eventbus.Register(
+		module.Get(c, keys.EventBus),
+		idempotency.Once(idem, orderCancelled, eventhandlers.NewOrderCancelledHandler(m.repo, idem)),
+		eventbus.WithName(orderCancelled),
+		eventbus.WithRetry(eventbus.DefaultRetryPolicy(domain.ErrInsufficientStock, fails.ErrNotFound)),
+	)
+
+	return nil
+}
+
+func (m *Module) newRepository(ctx context.Context, c *module.Container) (Repository, error) {
+	outbox := module.Get(c, keys.Outbox)
+
+	switch m.storage.Backend {
+	case infra.BackendMemory, "":
+		return NewRepository(outbox), nil
+	case infra.BackendFile:
+		return NewFileRepository(module.Get(c, keys.Journal), outbox)
+	case infra.BackendSQLite:
+		return NewSQLRepository(ctx, module.Get(c, keys.SQL), outbox)
+	default:
+		return nil, fmt.Errorf("unknown storage backend '%s'", m.storage.Backend)
+	}
+}
+
+// Start releases the stock held by orders that were not confirmed in time, periodically.
+func (m *Module) Start(ctx context.Context) error {
+	release := commands.NewReleaseExpiredReservationsHandler(m.repo)
+
+	m.background.Go(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(m.sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := release(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "releasing expired reservations", "error", err)
+				}
+				if n > 0 {
+					slog.InfoContext(ctx, "released expired reservations", "count", n)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// Drain stops releasing the expired reservations, waiting for a release in flight.
+func (m *Module) Drain(ctx context.Context) error {
+	return m.background.Stop(ctx)
+}
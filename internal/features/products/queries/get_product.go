@@ -7,27 +7,39 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
 )
 
 type GetProductRequest struct {
 	ID uuid.UUID `path:"id" doc:"Product ID"`
 }
 
+// GetProductQuery is a query for a product by ID.
+type GetProductQuery struct {
+	ID uuid.UUID
+}
+
 type ProductDTO struct {
-	ID    uuid.UUID `json:"id" path:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
-	SKU   string    `json:"sku" path:"sku" maxLength:"15" example:"P001" doc:"Product SKU"`
-	Name  string    `json:"name" path:"name" maxLength:"30" example:"Product 1" doc:"Product name"`
-	Price float64   `json:"price" path:"price" example:"10.99" doc:"Product price"`
+	ID        uuid.UUID `json:"id" path:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
+	SKU       string    `json:"sku" path:"sku" maxLength:"15" example:"P001" doc:"Product SKU"`
+	Name      string    `json:"name" path:"name" maxLength:"30" example:"Product 1" doc:"Product name"`
+	Price     float64   `json:"price" path:"price" example:"10.99" doc:"Product price"`
+	OnHand    int       `json:"onHand" example:"10" doc:"Units in stock"`
+	Reserved  int       `json:"reserved" example:"2" doc:"Units in stock held for orders not confirmed yet"`
+	Available int       `json:"available" example:"8" doc:"Units in stock that can be ordered"`
+	Version   int       `json:"version" example:"1" doc:"Product version"`
 }
 
 type GetProductResponse struct {
+	ETag string `header:"ETag" doc:"Product version, to be used in If-Match"`
 	Body struct {
 		Product ProductDTO `json:"product" doc:"Product"`
 	}
 }
 
-func RegisterGetProductController(api huma.API, repo Getter) {
-	handler := NewGetProductHandler(repo)
+func RegisterGetProductController(api huma.API, m *mediator.Mediator, repo Getter) {
+	mediator.RegisterQuery(m, NewGetProductHandler(repo))
 
 	huma.Register(
 		api,
@@ -39,12 +51,13 @@ func RegisterGetProductController(api huma.API, repo Getter) {
 			Tags:        []string{"products"},
 		},
 		func(ctx context.Context, input *GetProductRequest) (*GetProductResponse, error) {
-			product, err := handler(ctx, input.ID)
+			product, err := mediator.Send[*ProductDTO](ctx, m, &GetProductQuery{ID: input.ID})
 			if err != nil {
 				return nil, err
 			}
 
 			r := &GetProductResponse{}
+			r.ETag = etag.Format(product.Version)
 			r.Body.Product = *product
 			return r, nil
 		},
@@ -55,18 +68,22 @@ type Getter interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Product, error)
 }
 
-func NewGetProductHandler(repo Getter) func(ctx context.Context, id uuid.UUID) (*ProductDTO, error) {
-	return func(ctx context.Context, id uuid.UUID) (*ProductDTO, error) {
-		product, err := repo.GetByID(ctx, id)
+func NewGetProductHandler(repo Getter) func(ctx context.Context, q *GetProductQuery) (*ProductDTO, error) {
+	return func(ctx context.Context, q *GetProductQuery) (*ProductDTO, error) {
+		product, err := repo.GetByID(ctx, q.ID)
 		if err != nil {
 			return nil, err
 		}
 
 		return &ProductDTO{
-			ID:    product.ID(),
-			SKU:   product.SKU(),
-			Name:  product.Name(),
-			Price: product.Price(),
+			ID:        product.ID(),
+			SKU:       product.SKU(),
+			Name:      product.Name(),
+			Price:     product.Price(),
+			OnHand:    product.Quantity(),
+			Reserved:  product.Reserved(),
+			Available: product.Available(),
+			Version:   product.Version(),
 		}, nil
 	}
 }
@@ -0,0 +1,70 @@
+package queries
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+)
+
+type GetProductBySKURequest struct {
+	SKU string `path:"sku" maxLength:"15" doc:"Product SKU"`
+}
+
+// GetProductBySKUQuery is a query for a product by SKU.
+type GetProductBySKUQuery struct {
+	SKU string
+}
+
+func RegisterGetProductBySKUController(api huma.API, m *mediator.Mediator, repo SKUGetter) {
+	mediator.RegisterQuery(m, NewGetProductBySKUHandler(repo))
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "getProductBySKU",
+			Method:      http.MethodGet,
+			Path:        "/products/by-sku/{sku}",
+			Summary:     "Get a Product by SKU",
+			Tags:        []string{"products"},
+		},
+		func(ctx context.Context, input *GetProductBySKURequest) (*GetProductResponse, error) {
+			product, err := mediator.Send[*ProductDTO](ctx, m, &GetProductBySKUQuery{SKU: input.SKU})
+			if err != nil {
+				return nil, err
+			}
+
+			r := &GetProductResponse{}
+			r.ETag = etag.Format(product.Version)
+			r.Body.Product = *product
+			return r, nil
+		},
+	)
+}
+
+type SKUGetter interface {
+	GetBySKU(ctx context.Context, sku string) (*domain.Product, error)
+}
+
+func NewGetProductBySKUHandler(repo SKUGetter) func(ctx context.Context, q *GetProductBySKUQuery) (*ProductDTO, error) {
+	return func(ctx context.Context, q *GetProductBySKUQuery) (*ProductDTO, error) {
+		product, err := repo.GetBySKU(ctx, q.SKU)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ProductDTO{
+			ID:        product.ID(),
+			SKU:       product.SKU(),
+			Name:      product.Name(),
+			Price:     product.Price(),
+			OnHand:    product.Quantity(),
+			Reserved:  product.Reserved(),
+			Available: product.Available(),
+			Version:   product.Version(),
+		}, nil
+	}
+}
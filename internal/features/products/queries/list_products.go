@@ -2,28 +2,74 @@ package queries
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/shared/param"
 )
 
 type ListItemProductDTO struct {
-	ID    uuid.UUID `json:"id" path:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
-	SKU   string    `json:"sku" path:"sku" maxLength:"15" example:"P001" doc:"Product SKU"`
-	Name  string    `json:"name" path:"name" maxLength:"30" example:"Product 1" doc:"Product name"`
-	Price float64   `json:"price" path:"price" example:"10.99" doc:"Product price"`
+	ID        uuid.UUID `json:"id" path:"id" example:"00000000-0000-0000-0000-000000000000" doc:"Product ID"`
+	SKU       string    `json:"sku" path:"sku" maxLength:"15" example:"P001" doc:"Product SKU"`
+	Name      string    `json:"name" path:"name" maxLength:"30" example:"Product 1" doc:"Product name"`
+	Price     float64   `json:"price" path:"price" example:"10.99" doc:"Product price"`
+	OnHand    int       `json:"onHand" example:"10" doc:"Units in stock"`
+	Reserved  int       `json:"reserved" example:"2" doc:"Units in stock held for orders not confirmed yet"`
+	Available int       `json:"available" example:"8" doc:"Units in stock that can be ordered"`
+	CreatedAt time.Time `json:"createdAt" doc:"When the product was created"`
+}
+
+// ListProductsQuery is a query for a page of the products, filtered and sorted.
+type ListProductsQuery struct {
+	Name     string
+	MinPrice *float64
+	MaxPrice *float64
+	// Sort is a key of domain.SortKeys, defaulting to domain.SortByCreated
+	Sort string
+	Desc bool
+	// Cursor is the next cursor of the previous page, sorted the same way
+	Cursor string
+	Limit  int
+}
+
+func (q *ListProductsQuery) Validate() error {
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MinPrice > *q.MaxPrice {
+		return errors.New("the minimum price is above the maximum price")
+	}
+	return nil
+}
+
+type ListProductsRequest struct {
+	Name     string                  `query:"name" maxLength:"30" doc:"Only the products with a name containing it, ignoring the case"`
+	MinPrice param.Optional[float64] `query:"minPrice" doc:"Only the products with at least this price"`
+	MaxPrice param.Optional[float64] `query:"maxPrice" doc:"Only the products with at most this price"`
+	Sort     string                  `query:"sort" enum:"name,price,sku,created" default:"created" doc:"Sort key"`
+	Desc     bool                    `query:"desc" doc:"Sort in descending order"`
+	Cursor   string                  `query:"cursor" doc:"Where the page starts, as returned in next by the previous page, that must be sorted the same way"`
+	Limit    int                     `query:"limit" minimum:"1" maximum:"500" default:"50" doc:"Maximum number of products in the page"`
+}
+
+type ListProductsPage struct {
+	Products []ListItemProductDTO
+	Next     string
 }
 
 type ListProductsResponse struct {
 	Body struct {
-		Products []ListItemProductDTO `json:"products" doc:"List of products"`
+		Products []ListItemProductDTO `json:"products" doc:"Page of products"`
+		Next     string               `json:"next,omitempty" doc:"Cursor of the next page, if there are more products"`
 	}
 }
 
-func RegisterListProductsController(api huma.API, repo Lister) {
-	handler := NewListProductsHandler(repo)
+func RegisterListProductsController(api huma.API, m *mediator.Mediator, repo Lister) {
+	mediator.RegisterQuery(m, NewListProductsHandler(repo))
 
 	huma.Register(
 		api,
@@ -31,42 +77,76 @@ func RegisterListProductsController(api huma.API, repo Lister) {
 			OperationID: "listProducts",
 			Method:      http.MethodGet,
 			Path:        "/products",
-			Summary:     "List all Product",
+			Summary:     "List Products",
+			Description: "List a page of the products, filtered and sorted",
 			Tags:        []string{"products"},
 		},
-		func(ctx context.Context, _ *struct{}) (*ListProductsResponse, error) {
-			products, err := handler(ctx)
+		func(ctx context.Context, input *ListProductsRequest) (*ListProductsResponse, error) {
+			p, err := mediator.Send[ListProductsPage](ctx, m, &ListProductsQuery{
+				Name:     input.Name,
+				MinPrice: input.MinPrice.Ptr(),
+				MaxPrice: input.MaxPrice.Ptr(),
+				Sort:     input.Sort,
+				Desc:     input.Desc,
+				Cursor:   input.Cursor,
+				Limit:    input.Limit,
+			})
 			if err != nil {
 				return nil, err
 			}
 
 			r := &ListProductsResponse{}
-			r.Body.Products = products
+			r.Body.Products = p.Products
+			r.Body.Next = p.Next
 			return r, nil
 		},
 	)
 }
 
 type Lister interface {
-	ListAll(ctx context.Context) ([]*domain.Product, error)
+	List(ctx context.Context, q domain.Query) (page.Page[*domain.Product], error)
 }
 
-func NewListProductsHandler(repo Lister) func(ctx context.Context) ([]ListItemProductDTO, error) {
-	return func(ctx context.Context) ([]ListItemProductDTO, error) {
-		products, err := repo.ListAll(ctx)
+func NewListProductsHandler(repo Lister) func(ctx context.Context, q *ListProductsQuery) (ListProductsPage, error) {
+	return func(ctx context.Context, q *ListProductsQuery) (ListProductsPage, error) {
+		after, err := page.ParseCursor(q.Cursor)
+		if err != nil {
+			return ListProductsPage{}, fmt.Errorf("listing products: %w", err)
+		}
+		req, err := page.Check(page.Request{Sort: q.Sort, Desc: q.Desc, After: after, Limit: q.Limit}, domain.SortKeys, domain.SortByCreated)
+		if err != nil {
+			return ListProductsPage{}, fmt.Errorf("listing products: %w", err)
+		}
+
+		products, err := repo.List(ctx, domain.Query{
+			Name:     q.Name,
+			MinPrice: q.MinPrice,
+			MaxPrice: q.MaxPrice,
+			Page:     req,
+		})
 		if err != nil {
-			return nil, err
+			return ListProductsPage{}, fmt.Errorf("listing products: %w", err)
 		}
 
-		var dtos []ListItemProductDTO
-		for _, p := range products {
-			dtos = append(dtos, ListItemProductDTO{
-				ID:    p.ID(),
-				SKU:   p.SKU(),
-				Name:  p.Name(),
-				Price: p.Price(),
+		r := ListProductsPage{
+			// an empty page is an empty list, not null
+			Products: []ListItemProductDTO{},
+		}
+		for _, p := range products.Items {
+			r.Products = append(r.Products, ListItemProductDTO{
+				ID:        p.ID(),
+				SKU:       p.SKU(),
+				Name:      p.Name(),
+				Price:     p.Price(),
+				OnHand:    p.Quantity(),
+				Reserved:  p.Reserved(),
+				Available: p.Available(),
+				CreatedAt: p.CreatedAt(),
 			})
 		}
-		return dtos, nil
+		if products.Next != nil {
+			r.Next = products.Next.String()
+		}
+		return r, nil
 	}
 }
@@ -2,27 +2,122 @@ package products
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/quintans/vertical-slices/internal/features/products/domain"
 	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+	"github.com/quintans/vertical-slices/internal/shared"
 	"github.com/quintans/vertical-slices/internal/shared/fails"
 )
 
 type Repo struct {
-	db *infra.DB[*domain.Product]
+	db     *infra.DB[*domain.Product]
+	outbox shared.Outbox
 }
 
-func NewRepository() *Repo {
+func NewRepository(outbox shared.Outbox) *Repo {
 	return &Repo{
-		db: infra.NewDB[*domain.Product](),
+		db:     infra.NewDB(dbOptions...),
+		outbox: outbox,
 	}
 }
 
-func (r *Repo) GetByID(_ context.Context, id uuid.UUID) (*domain.Product, error) {
-	p, err := r.db.GetByID(id)
+// NewFileRepository returns a repository that keeps its data in the journal.
+func NewFileRepository(j *infra.Journal, outbox shared.Outbox) (*Repo, error) {
+	db, err := infra.NewFileDB(j, "products", productCodec{}, dbOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("opening products db: %w", err)
+	}
+
+	return &Repo{
+		db:     db,
+		outbox: outbox,
+	}, nil
+}
+
+// skuIndex is the unique index of the products by SKU
+const skuIndex = "sku"
+
+var dbOptions = []infra.Option[*domain.Product]{
+	infra.WithClone(cloneProduct),
+	infra.WithVersioning(productVersion, withProductVersion),
+	infra.WithUniqueIndex(skuIndex, (*domain.Product).SKU),
+}
+
+func cloneProduct(p *domain.Product) *domain.Product {
+	return withProductVersion(p, p.Version())
+}
+
+func productVersion(p *domain.Product) int {
+	return p.Version()
+}
+
+func withProductVersion(p *domain.Product, version int) *domain.Product {
+	return domain.HydrateProduct(p.ID(), p.SKU(), p.Name(), p.Price(), p.Quantity(), slices.Clone(p.Reservations()), p.CreatedAt(), version)
+}
+
+type productRecord struct {
+	ID           uuid.UUID           `json:"id"`
+	SKU          string              `json:"sku"`
+	Name         string              `json:"name"`
+	Price        float64             `json:"price"`
+	Quantity     int                 `json:"quantity"`
+	Reservations []reservationRecord `json:"reservations,omitempty"`
+	CreatedAt    time.Time           `json:"createdAt"`
+	Version      int                 `json:"version"`
+}
+
+type reservationRecord struct {
+	OrderID   uuid.UUID `json:"orderId"`
+	Quantity  int       `json:"quantity"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type productCodec struct{}
+
+func (productCodec) Encode(p *domain.Product) ([]byte, error) {
+	var reservations []reservationRecord
+	for _, r := range p.Reservations() {
+		reservations = append(reservations, reservationRecord(r))
+	}
+
+	return json.Marshal(productRecord{
+		ID:           p.ID(),
+		SKU:          p.SKU(),
+		Name:         p.Name(),
+		Price:        p.Price(),
+		Quantity:     p.Quantity(),
+		Reservations: reservations,
+		CreatedAt:    p.CreatedAt(),
+		Version:      p.Version(),
+	})
+}
+
+func (productCodec) Decode(data []byte) (*domain.Product, error) {
+	var r productRecord
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	var reservations []domain.Reservation
+	for _, res := range r.Reservations {
+		reservations = append(reservations, domain.Reservation(res))
+	}
+
+	return domain.HydrateProduct(r.ID, r.SKU, r.Name, r.Price, r.Quantity, reservations, r.CreatedAt, r.Version), nil
+}
+
+func (r *Repo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Product, error) {
+	p, err := r.db.GetByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, infra.ErrDoesNotExist) {
 			return nil, fails.ErrNotFound
@@ -33,44 +128,92 @@ func (r *Repo) GetByID(_ context.Context, id uuid.UUID) (*domain.Product, error)
 	return p, nil
 }
 
-func (r *Repo) ListAll(_ context.Context) ([]*domain.Product, error) {
-	data := r.db.ListAll()
+func (r *Repo) GetBySKU(ctx context.Context, sku string) (*domain.Product, error) {
+	p, err := r.db.GetBy(ctx, skuIndex, sku)
+	if err != nil {
+		if errors.Is(err, infra.ErrDoesNotExist) {
+			return nil, fails.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (r *Repo) ListAll(ctx context.Context) ([]*domain.Product, error) {
+	data := r.db.ListAll(ctx)
 	return data, nil
 }
 
-func (r *Repo) Create(_ context.Context, p *domain.Product) error {
-	err := r.db.Create(p.ID(), p)
-	if err != nil {
-		if errors.Is(err, infra.ErrUniquenessViolation) {
-			return fails.ErrAlreadyExists
+// List returns the page of the products selected by the query, whose page request must have been checked.
+func (r *Repo) List(ctx context.Context, q domain.Query) (page.Page[*domain.Product], error) {
+	var selected []*domain.Product
+	for _, p := range r.db.ListAll(ctx) {
+		if q.Matches(p) {
+			selected = append(selected, p)
 		}
-		return err
 	}
-	return nil
+	return page.Slice(selected, q.Page, domain.SortKeys, domain.ProductID)
 }
 
-func (r *Repo) Delete(_ context.Context, id uuid.UUID) error {
-	r.db.Delete(id)
-	return nil
+func (r *Repo) Create(ctx context.Context, p *domain.Product) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		err := r.db.Create(ctx, p.ID(), p)
+		if err != nil {
+			if errors.Is(err, infra.ErrUniquenessViolation) {
+				return fmt.Errorf("product with SKU '%s': %w", p.SKU(), fails.ErrAlreadyExists)
+			}
+			return err
+		}
+
+		return r.addEvents(ctx, p.ID(), p.Version(), p.Events())
+	})
+}
+
+func (r *Repo) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.Delete(ctx, id)
 }
 
 func (r *Repo) Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Product) error) error {
-	err := r.db.Update(id, func(p *domain.Product) (*domain.Product, error) {
-		err := handler(ctx, p)
-		return p, err
-	})
-	if err != nil {
-		if errors.Is(err, infra.ErrDoesNotExist) {
-			return fails.ErrNotFound
+	return uow.Run(ctx, func(ctx context.Context) error {
+		var (
+			events  []eventbus.Message
+			version int
+		)
+		err := r.db.Update(ctx, id, func(p *domain.Product) (*domain.Product, error) {
+			err := handler(ctx, p)
+			events = p.Events()
+			// the version the product is saved at
+			version = p.Version() + 1
+			return p, err
+		})
+		if err != nil {
+			if errors.Is(err, infra.ErrDoesNotExist) {
+				return fails.ErrNotFound
+			}
+			return err
 		}
-		return err
+
+		return r.addEvents(ctx, id, version, events)
+	})
+}
+
+// addEvents stores the events in the outbox, to be published by the relay once the unit of work commits,
+// in envelopes telling the version of the product after them
+func (r *Repo) addEvents(ctx context.Context, id uuid.UUID, version int, events []eventbus.Message) error {
+	if len(events) == 0 {
+		return nil
 	}
 
+	err := r.outbox.Add(ctx, eventbus.Wrap(ctx, id, version, events...)...)
+	if err != nil {
+		return fmt.Errorf("adding product events to outbox: %w", err)
+	}
 	return nil
 }
 
-func (r *Repo) GetProductQuantity(_ context.Context, id uuid.UUID) (int, error) {
-	p, err := r.db.GetByID(id)
+func (r *Repo) GetProductPrice(ctx context.Context, id uuid.UUID) (float64, error) {
+	p, err := r.db.GetByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, infra.ErrDoesNotExist) {
 			return 0, fmt.Errorf("no product with id '%s': %w", id, fails.ErrNotFound)
@@ -78,5 +221,5 @@ func (r *Repo) GetProductQuantity(_ context.Context, id uuid.UUID) (int, error)
 		return 0, err
 	}
 
-	return p.Quantity(), nil
+	return p.Price(), nil
 }
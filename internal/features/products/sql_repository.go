@@ -0,0 +1,433 @@
+package products
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/features/products/domain"
+	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+	"github.com/quintans/vertical-slices/internal/shared"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+var migrations = []infra.Migration{
+	{
+		Version: 1,
+		SQL: `CREATE TABLE products (
+			id TEXT PRIMARY KEY,
+			sku TEXT NOT NULL,
+			name TEXT NOT NULL,
+			price REAL NOT NULL,
+			quantity INTEGER NOT NULL
+		)`,
+	},
+	{
+		Version: 2,
+		SQL:     `ALTER TABLE products ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	},
+	{
+		Version: 3,
+		SQL: `CREATE TABLE product_reservations (
+			product_id TEXT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+			order_id TEXT NOT NULL,
+			quantity INTEGER NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (product_id, order_id)
+		)`,
+	},
+	{
+		// the creation time of the existing products was not recorded
+		Version: 4,
+		SQL:     `ALTER TABLE products ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00 +0000 UTC'`,
+	},
+	{
+		// the SKUs were not unique, so the SKU of every product but the first one created is suffixed by its ID
+		Version: 5,
+		SQL: `UPDATE products SET sku = sku || '-' || id WHERE EXISTS (
+			SELECT 1 FROM products AS p WHERE p.sku = products.sku AND (p.created_at < products.created_at OR (p.created_at = products.created_at AND p.id < products.id))
+		)`,
+	},
+	{
+		Version: 6,
+		SQL:     `CREATE UNIQUE INDEX products_sku ON products (sku)`,
+	},
+}
+
+// SQLRepo is a repository backed by a SQL database
+type SQLRepo struct {
+	db     *sql.DB
+	outbox shared.Outbox
+}
+
+// NewSQLRepository returns a repository backed by db.
+// For the events to be stored atomically with the products, the outbox should be kept in the same database.
+func NewSQLRepository(ctx context.Context, db *sql.DB, outbox shared.Outbox) (*SQLRepo, error) {
+	err := infra.Migrate(ctx, db, "products", migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLRepo{
+		db:     db,
+		outbox: outbox,
+	}, nil
+}
+
+const (
+	selectProduct      = "SELECT id, sku, name, price, quantity, created_at, version FROM products"
+	selectReservations = "SELECT product_id, order_id, quantity, expires_at FROM product_reservations"
+)
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanProduct scans a product without its reservations
+func scanProduct(row scanner) (*domain.Product, error) {
+	var (
+		id        uuid.UUID
+		sku       string
+		name      string
+		price     float64
+		quantity  int
+		createdAt time.Time
+		version   int
+	)
+	err := row.Scan(&id, &sku, &name, &price, &quantity, &createdAt, &version)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.HydrateProduct(id, sku, name, price, quantity, nil, createdAt, version), nil
+}
+
+// queryReservations returns the reservations of the products matching the where clause, by product
+func queryReservations(ctx context.Context, tx *sql.Tx, where string, args ...any) (map[uuid.UUID][]domain.Reservation, error) {
+	rows, err := tx.QueryContext(ctx, selectReservations+where+" ORDER BY product_id, expires_at", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := map[uuid.UUID][]domain.Reservation{}
+	for rows.Next() {
+		var (
+			productID uuid.UUID
+			r         domain.Reservation
+		)
+		err := rows.Scan(&productID, &r.OrderID, &r.Quantity, &r.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		reservations[productID] = append(reservations[productID], r)
+	}
+	return reservations, rows.Err()
+}
+
+// withReservations returns a copy of p with its reservations
+func withReservations(p *domain.Product, reservations []domain.Reservation) *domain.Product {
+	return domain.HydrateProduct(p.ID(), p.SKU(), p.Name(), p.Price(), p.Quantity(), reservations, p.CreatedAt(), p.Version())
+}
+
+func getProduct(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*domain.Product, error) {
+	return findProduct(ctx, tx, " WHERE id = ?", id)
+}
+
+// findProduct returns the product matching the where clause, that must match at most one
+func findProduct(ctx context.Context, tx *sql.Tx, where string, args ...any) (*domain.Product, error) {
+	p, err := scanProduct(tx.QueryRowContext(ctx, selectProduct+where, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := queryReservations(ctx, tx, " WHERE product_id = ?", p.ID())
+	if err != nil {
+		return nil, err
+	}
+	return withReservations(p, reservations[p.ID()]), nil
+}
+
+// saveReservations replaces the reservations of the product
+func saveReservations(ctx context.Context, tx *sql.Tx, p *domain.Product) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM product_reservations WHERE product_id = ?", p.ID())
+	if err != nil {
+		return err
+	}
+
+	for _, r := range p.Reservations() {
+		_, err = tx.ExecContext(ctx, "INSERT INTO product_reservations (product_id, order_id, quantity, expires_at) VALUES (?, ?, ?, ?)",
+			p.ID(), r.OrderID, r.Quantity, r.ExpiresAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Product, error) {
+	var p *domain.Product
+	err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		p, err = getProduct(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, infra.ErrDoesNotExist) {
+			return nil, fails.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (r *SQLRepo) GetBySKU(ctx context.Context, sku string) (*domain.Product, error) {
+	var p *domain.Product
+	err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		p, err = findProduct(ctx, tx, " WHERE sku = ?", sku)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, infra.ErrDoesNotExist) {
+			return nil, fails.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (r *SQLRepo) ListAll(ctx context.Context) ([]*domain.Product, error) {
+	var data []*domain.Product
+	err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, selectProduct)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			p, err := scanProduct(rows)
+			if err != nil {
+				return err
+			}
+			data = append(data, p)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		reservations, err := queryReservations(ctx, tx, "")
+		if err != nil {
+			return err
+		}
+		for i, p := range data {
+			data[i] = withReservations(p, reservations[p.ID()])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// sortColumns are the columns of the sort keys
+var sortColumns = map[string]string{
+	"name":               "name",
+	"price":              "price",
+	"sku":                "sku",
+	domain.SortByCreated: "created_at",
+}
+
+// List returns the page of the products selected by the query, whose page request must have been checked.
+func (r *SQLRepo) List(ctx context.Context, q domain.Query) (page.Page[*domain.Product], error) {
+	var (
+		where []string
+		args  []any
+	)
+	if q.Name != "" {
+		where = append(where, "instr(lower(name), lower(?)) > 0")
+		args = append(args, q.Name)
+	}
+	if q.MinPrice != nil {
+		where = append(where, "price >= ?")
+		args = append(args, *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		where = append(where, "price <= ?")
+		args = append(args, *q.MaxPrice)
+	}
+
+	key := domain.SortKeys[q.Page.Sort]
+	column := sortColumns[q.Page.Sort]
+	op, dir := ">", "ASC"
+	if q.Page.Desc {
+		op, dir = "<", "DESC"
+	}
+	if q.Page.After != nil {
+		v, err := key.Arg(q.Page.After.Value)
+		if err != nil {
+			return page.Page[*domain.Product]{}, err
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op))
+		args = append(args, v, v, q.Page.After.ID)
+	}
+
+	query := selectProduct
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// one more than asked, to know if there is a next page
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s LIMIT ?", column, dir)
+	args = append(args, q.Page.Limit+1)
+
+	var data []*domain.Product
+	err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var ids []any
+		for rows.Next() {
+			p, err := scanProduct(rows)
+			if err != nil {
+				return err
+			}
+			data = append(data, p)
+			ids = append(ids, p.ID())
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		reservations, err := queryReservations(ctx, tx, " WHERE product_id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", ids...)
+		if err != nil {
+			return err
+		}
+		for i, p := range data {
+			data[i] = withReservations(p, reservations[p.ID()])
+		}
+		return nil
+	})
+	if err != nil {
+		return page.Page[*domain.Product]{}, err
+	}
+
+	return page.Of(data, q.Page, key, domain.ProductID), nil
+}
+
+func (r *SQLRepo) Create(ctx context.Context, p *domain.Product) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO products (id, sku, name, price, quantity, created_at, version) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				p.ID(), p.SKU(), p.Name(), p.Price(), p.Quantity(), p.CreatedAt().UTC(), p.Version())
+			if err != nil {
+				return err
+			}
+			return saveReservations(ctx, tx, p)
+		})
+		if err != nil {
+			if errors.Is(err, infra.ErrUniquenessViolation) {
+				return fmt.Errorf("product with SKU '%s': %w", p.SKU(), fails.ErrAlreadyExists)
+			}
+			return err
+		}
+
+		return r.addEvents(ctx, p.ID(), p.Version(), p.Events())
+	})
+}
+
+func (r *SQLRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM products WHERE id = ?", id)
+		return err
+	})
+}
+
+func (r *SQLRepo) Update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Product) error) error {
+	return uow.Run(ctx, func(ctx context.Context) error {
+		return r.update(ctx, id, handler)
+	})
+}
+
+func (r *SQLRepo) update(ctx context.Context, id uuid.UUID, handler func(context.Context, *domain.Product) error) error {
+	var (
+		events  []eventbus.Message
+		version int
+	)
+	err := infra.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		p, err := getProduct(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		version = p.Version()
+
+		err = handler(ctx, p)
+		if err != nil {
+			return err
+		}
+		events = p.Events()
+
+		res, err := tx.ExecContext(ctx, "UPDATE products SET sku = ?, name = ?, price = ?, quantity = ?, version = version + 1 WHERE id = ? AND version = ?",
+			p.SKU(), p.Name(), p.Price(), p.Quantity(), id, version)
+		if err != nil {
+			return err
+		}
+		err = infra.CheckVersion(res)
+		if err != nil {
+			return err
+		}
+
+		return saveReservations(ctx, tx, p)
+	})
+	if err != nil {
+		if errors.Is(err, infra.ErrDoesNotExist) {
+			return fails.ErrNotFound
+		}
+		return err
+	}
+
+	return r.addEvents(ctx, id, version+1, events)
+}
+
+// addEvents stores the events in the outbox, to be published by the relay once the unit of work commits,
+// in envelopes telling the version of the product after them
+func (r *SQLRepo) addEvents(ctx context.Context, id uuid.UUID, version int, events []eventbus.Message) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	err := r.outbox.Add(ctx, eventbus.Wrap(ctx, id, version, events...)...)
+	if err != nil {
+		return fmt.Errorf("adding product events to outbox: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLRepo) GetProductPrice(ctx context.Context, id uuid.UUID) (float64, error) {
+	p, err := r.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, fails.ErrNotFound) {
+			return 0, fmt.Errorf("no product with id '%s': %w", id, fails.ErrNotFound)
+		}
+		return 0, err
+	}
+
+	return p.Price(), nil
+}
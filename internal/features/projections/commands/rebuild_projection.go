@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+// RebuildProjectionCommand is a command for discarding the read model of a projection and building it again from scratch.
+type RebuildProjectionCommand struct {
+	Name string
+}
+
+type RebuildProjectionRequest struct {
+	Name string `path:"name" example:"orders.views" doc:"Projection name"`
+}
+
+func RegisterRebuildProjectionController(api huma.API, m *mediator.Mediator, registry Rebuilder) {
+	// the projection only reads the source of truth
+	mediator.RegisterCommand(m, mediator.Void(NewRebuildProjectionHandler(registry)), mediator.WithoutTransaction())
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "rebuildProjection",
+			Method:      http.MethodPost,
+			Path:        "/projections/{name}/rebuild",
+			Summary:     "Rebuild a projection",
+			Description: "Discard the read model of a projection and build it again from the source of truth",
+			Tags:        []string{"projections"},
+		},
+		func(ctx context.Context, req *RebuildProjectionRequest) (*struct{}, error) {
+			err := mediator.Exec(ctx, m, &RebuildProjectionCommand{Name: req.Name})
+
+			return nil, err
+		},
+	)
+}
+
+type Rebuilder interface {
+	Rebuild(ctx context.Context, name string) error
+}
+
+func NewRebuildProjectionHandler(registry Rebuilder) func(ctx context.Context, cmd *RebuildProjectionCommand) error {
+	return func(ctx context.Context, cmd *RebuildProjectionCommand) error {
+		return registry.Rebuild(ctx, cmd.Name)
+	}
+}
@@ -0,0 +1,13 @@
+package projections
+
+import (
+	"net/http"
+
+	"github.com/quintans/vertical-slices/internal/lib/problem"
+	"github.com/quintans/vertical-slices/internal/lib/projection"
+)
+
+// RegisterErrors maps the errors of the projections to HTTP problems
+func RegisterErrors(m *problem.Mapper) {
+	m.Map(projection.ErrUnknown, http.StatusNotFound, "projections.not_found")
+}
@@ -0,0 +1,45 @@
+package projections
+
+import (
+	"context"
+
+	"github.com/quintans/vertical-slices/internal/features/projections/commands"
+	"github.com/quintans/vertical-slices/internal/features/projections/queries"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/shared/keys"
+)
+
+// Module is the projections slice, to rebuild the read models of the other slices and check their lag
+type Module struct{}
+
+func NewModule() *Module {
+	return &Module{}
+}
+
+func (m *Module) Name() string {
+	return "projections"
+}
+
+func (m *Module) Provides() []string {
+	return nil
+}
+
+func (m *Module) Requires() []string {
+	return []string{
+		keys.API.Name(),
+		keys.Errors.Name(),
+		keys.Mediator.Name(),
+		keys.Projections.Name(),
+		keys.Checkpoint.Name(),
+	}
+}
+
+func (m *Module) Init(_ context.Context, c *module.Container) error {
+	RegisterErrors(module.Get(c, keys.Errors))
+
+	api, med, registry := module.Get(c, keys.API), module.Get(c, keys.Mediator), module.Get(c, keys.Projections)
+	commands.RegisterRebuildProjectionController(api, med, registry)
+	queries.RegisterListProjectionsController(api, med, registry, module.Get(c, keys.Checkpoint))
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/lib/projection"
+)
+
+// ListProjectionsQuery is a query for the projections and how far behind the changes they are.
+type ListProjectionsQuery struct{}
+
+type ListProjectionsDTO struct {
+	Projections []string `json:"projections" example:"[\"orders.views\"]" doc:"Names of the projections"`
+	Lag         uint64   `json:"lag" example:"0" doc:"Number of changes committed that the projections did not handle yet"`
+}
+
+type ListProjectionsResponse struct {
+	Body ListProjectionsDTO
+}
+
+func RegisterListProjectionsController(api huma.API, m *mediator.Mediator, registry Lister, cp projection.Checkpoint) {
+	mediator.RegisterQuery(m, NewListProjectionsHandler(registry, cp))
+
+	huma.Register(
+		api,
+		huma.Operation{
+			OperationID: "listProjections",
+			Method:      http.MethodGet,
+			Path:        "/projections",
+			Summary:     "List the projections",
+			Description: "List the projections and how far behind the committed changes they are",
+			Tags:        []string{"projections"},
+		},
+		func(ctx context.Context, _ *struct{}) (*ListProjectionsResponse, error) {
+			dto, err := mediator.Send[ListProjectionsDTO](ctx, m, &ListProjectionsQuery{})
+			if err != nil {
+				return nil, err
+			}
+
+			return &ListProjectionsResponse{Body: dto}, nil
+		},
+	)
+}
+
+type Lister interface {
+	Names() []string
+}
+
+func NewListProjectionsHandler(registry Lister, cp projection.Checkpoint) func(ctx context.Context, _ *ListProjectionsQuery) (ListProjectionsDTO, error) {
+	return func(ctx context.Context, _ *ListProjectionsQuery) (ListProjectionsDTO, error) {
+		lag, err := cp.Lag(ctx)
+		if err != nil {
+			return ListProjectionsDTO{}, fmt.Errorf("checking projection lag: %w", err)
+		}
+
+		return ListProjectionsDTO{
+			Projections: registry.Names(),
+			Lag:         lag,
+		}, nil
+	}
+}
@@ -0,0 +1,144 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// ErrChangesLost is returned when the changes a subscriber asked for are no longer retained,
+// eg: it fell too far behind. It must start over from a snapshot.
+var ErrChangesLost = errors.New("changes lost")
+
+// DefaultChangeRetention is the number of changes a DB keeps for the subscribers that fall behind
+const DefaultChangeRetention = 1024
+
+// maxChangeBatch is the maximum number of changes handed to a subscriber at once
+const maxChangeBatch = 256
+
+type Op string
+
+const (
+	OpInsert Op = "insert"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+)
+
+// Change is a committed change of a value of a DB.
+type Change[T any] struct {
+	// Seq numbers the changes of a DB, in the order they were made, starting at 1
+	Seq uint64
+	Op  Op
+	ID  uuid.UUID
+	// Before is the value before the change, the zero value on insert
+	Before T
+	// After is the value after the change, the zero value on delete
+	After T
+}
+
+// WithChangeRetention sets the number of changes kept for the subscribers that fall behind,
+// defaulting to DefaultChangeRetention. A subscriber further behind gets ErrChangesLost.
+func WithChangeRetention[T any](n int) Option[T] {
+	return func(db *DB[T]) {
+		db.feed.retain = n
+	}
+}
+
+// Snapshot returns all the values and the sequence number of the last change they include,
+// from where Watch picks up the changes made after.
+func (r *DB[T]) Snapshot() ([]T, uint64) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	list := make([]T, 0, len(r.data))
+	for _, v := range r.data {
+		list = append(list, v)
+	}
+	return list, r.feed.seq
+}
+
+// Watch calls fn with every change made after the sequence number from, in order,
+// until the context is done or fn fails, returning why it stopped.
+// The writes never wait for the subscribers: one that falls behind the retained changes gets ErrChangesLost.
+// Starting from 0 replays the retained changes, if no change was lost yet.
+func (r *DB[T]) Watch(ctx context.Context, from uint64, fn func(Change[T]) error) error {
+	for {
+		r.mutex.RLock()
+		changes, wait, err := r.feed.after(from)
+		r.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+
+		for _, c := range changes {
+			err := fn(c)
+			if err != nil {
+				return err
+			}
+			from = c.Seq
+		}
+		if len(changes) > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+// feed keeps the last changes of a DB, for its subscribers. It must be used with the lock of the DB held.
+type feed[T any] struct {
+	retain  int
+	changes []Change[T]
+	// seq is the sequence number of the last change
+	seq uint64
+	// notify is closed, and replaced, when there are new changes
+	notify chan struct{}
+}
+
+func newFeed[T any](retain int) *feed[T] {
+	return &feed[T]{
+		retain: retain,
+		notify: make(chan struct{}),
+	}
+}
+
+func (f *feed[T]) publish(changes []Change[T]) {
+	f.changes = append(f.changes, changes...)
+	f.seq = changes[len(changes)-1].Seq
+	// trimmed once in a while, rather than on every change
+	if len(f.changes) > 2*f.retain {
+		f.changes = slices.Clone(f.changes[len(f.changes)-f.retain:])
+	}
+
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// after returns the changes after the sequence number from, or a channel closed when there are some
+func (f *feed[T]) after(from uint64) ([]Change[T], <-chan struct{}, error) {
+	if from > f.seq {
+		// eg: a sequence number from before a restart, when the changes were not persisted
+		return nil, nil, fmt.Errorf("sequence number %d is ahead of the last change %d: %w", from, f.seq, ErrChangesLost)
+	}
+	if from == f.seq {
+		return nil, f.notify, nil
+	}
+
+	// the changes are numbered without gaps
+	first := f.seq - uint64(len(f.changes)) + 1
+	if from+1 < first {
+		return nil, nil, fmt.Errorf("changes after %d, the oldest retained is %d: %w", from, first, ErrChangesLost)
+	}
+	changes := f.changes[from+1-first:]
+	if len(changes) > maxChangeBatch {
+		changes = changes[:maxChangeBatch]
+	}
+	return slices.Clone(changes), nil, nil
+}
@@ -0,0 +1,181 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+// watched is a change as seen by a subscriber
+type watched struct {
+	Seq   uint64
+	Op    Op
+	Email string
+}
+
+// watch returns the changes after from, until there are n of them or it times out
+func watch(t *testing.T, db *DB[user], from uint64, n int) ([]watched, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var got []watched
+	errEnough := errors.New("enough")
+	err := db.Watch(ctx, from, func(c Change[user]) error {
+		email := c.After.Email
+		if c.Op == OpDelete {
+			email = c.Before.Email
+		}
+		got = append(got, watched{Seq: c.Seq, Op: c.Op, Email: email})
+		if len(got) == n {
+			return errEnough
+		}
+		return nil
+	})
+	if errors.Is(err, errEnough) {
+		err = nil
+	}
+	return got, err
+}
+
+func TestWatch(t *testing.T) {
+	// the changes made to the DB by every test
+	all := []watched{
+		{Seq: 1, Op: OpInsert, Email: "a@"},
+		{Seq: 2, Op: OpInsert, Email: "b@"},
+		{Seq: 3, Op: OpUpdate, Email: "a2@"},
+		{Seq: 4, Op: OpDelete, Email: "b@"},
+		{Seq: 5, Op: OpInsert, Email: "c@"},
+	}
+
+	tests := []struct {
+		name    string
+		retain  int
+		from    uint64
+		wantErr error
+		want    []watched
+	}{
+		{name: "from the start", retain: 10, from: 0, want: all},
+		{name: "from the middle", retain: 10, from: 2, want: all[2:]},
+		// the changes are trimmed to the retained ones once they are more than twice as many
+		{name: "within the retained changes", retain: 2, from: 3, want: all[3:]},
+		{name: "behind the retained changes", retain: 2, from: 1, wantErr: ErrChangesLost},
+		{name: "ahead of the last change", retain: 10, from: 6, wantErr: ErrChangesLost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := NewDB(WithChangeRetention[user](tt.retain))
+
+			a, b := uuid.New(), uuid.New()
+			steps := []func() error{
+				func() error { return db.Create(ctx, a, user{Email: "a@"}) },
+				func() error { return db.Create(ctx, b, user{Email: "b@"}) },
+				func() error {
+					return db.Update(ctx, a, func(u user) (user, error) {
+						u.Email = "a2@"
+						return u, nil
+					})
+				},
+				func() error { return db.Delete(ctx, b) },
+				// deleting what does not exist is not a change
+				func() error { return db.Delete(ctx, uuid.New()) },
+				func() error { return db.Create(ctx, uuid.New(), user{Email: "c@"}) },
+			}
+			for i, step := range steps {
+				err := step()
+				if err != nil {
+					t.Fatalf("step %d error = %v", i, err)
+				}
+			}
+
+			got, err := watch(t, db, tt.from, len(tt.want))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Watch() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Watch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchUnitOfWork(t *testing.T) {
+	tests := []struct {
+		name     string
+		rollback bool
+		want     []watched
+	}{
+		{
+			name: "committed",
+			want: []watched{
+				{Seq: 2, Op: OpInsert, Email: "b@"},
+				{Seq: 3, Op: OpInsert, Email: "c@"},
+			},
+		},
+		{name: "rolled back", rollback: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := NewDB[user]()
+			err := db.Create(ctx, uuid.New(), user{Email: "a@"})
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			// a subscriber starting from a snapshot only gets the changes made after it
+			_, from := db.Snapshot()
+
+			_ = uow.Run(ctx, func(ctx context.Context) error {
+				for _, email := range []string{"b@", "c@"} {
+					err := db.Create(ctx, uuid.New(), user{Email: email})
+					if err != nil {
+						t.Fatalf("Create(%s) error = %v", email, err)
+					}
+				}
+				if tt.rollback {
+					return errors.New("rollback")
+				}
+				return nil
+			})
+
+			got, err := watch(t, db, from, len(tt.want))
+			if tt.rollback && !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Watch() error = %v, want it to wait for changes", err)
+			}
+			if !tt.rollback && err != nil {
+				t.Fatalf("Watch() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Watch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchWaitsForChanges(t *testing.T) {
+	ctx := context.Background()
+	db := NewDB[user]()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = db.Create(ctx, uuid.New(), user{Email: "a@"})
+	}()
+
+	got, err := watch(t, db, 0, 1)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	want := []watched{{Seq: 1, Op: OpInsert, Email: "a@"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("Watch() = %v, want %v", got, want)
+	}
+}
@@ -1,68 +1,263 @@
 package infra
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
 )
 
 var ErrDoesNotExist = errors.New("does not exist")
 var ErrUniquenessViolation = errors.New("uniqueness violation")
 
+// absent is the version read of a value that does not exist
+const absent = -1
+
+// DB is an in memory store, optionally made durable by a write-ahead log (see NewFileDB).
+// When the context carries a unit of work, the changes are staged and only applied when the unit of work commits.
 type DB[T any] struct {
-	data  map[uuid.UUID]T
-	mutex sync.RWMutex
+	data       map[uuid.UUID]T
+	mutex      sync.RWMutex
+	clone      func(T) T
+	versioning *versioning[T]
+	indexes    map[string]*index[T]
+	feed       *feed[T]
+	sequence   *sequence[T]
+	journal    *dbJournal[T]
+}
+
+type versioning[T any] struct {
+	get func(T) int
+	set func(T, int) T
+}
+
+type sequence[T any] struct {
+	get  func(T) uint64
+	set  func(T, uint64) T
+	last uint64
+}
+
+type Option[T any] func(*DB[T])
+
+// WithClone sets the function used to copy a value before it is handed to an update,
+// so that a failed update does not leave the stored value half changed.
+// Required when T is a pointer.
+func WithClone[T any](clone func(T) T) Option[T] {
+	return func(db *DB[T]) {
+		db.clone = clone
+	}
+}
+
+// WithVersioning makes every update increment the version of the value.
+// In a unit of work, the versions of the values read, or that they were missing, are checked on commit,
+// failing with fails.ErrConcurrencyConflict if any was changed in the meantime.
+func WithVersioning[T any](get func(T) int, set func(T, int) T) Option[T] {
+	return func(db *DB[T]) {
+		db.versioning = &versioning[T]{get: get, set: set}
+	}
+}
+
+// WithSequence numbers the values in the order they are inserted, on commit, eg: to read them in that order.
+// The numbering goes on from the highest number stored.
+func WithSequence[T any](get func(T) uint64, set func(T, uint64) T) Option[T] {
+	return func(db *DB[T]) {
+		db.sequence = &sequence[T]{get: get, set: set}
+	}
+}
+
+// WithIndex adds a secondary index, by the key returned by key, to be looked up with FindBy.
+// The values with an empty key are not indexed.
+func WithIndex[T any](name string, key func(T) string) Option[T] {
+	return func(db *DB[T]) {
+		db.indexes[name] = newIndex(key, false)
+	}
 }
 
-func NewDB[T any]() *DB[T] {
-	return &DB[T]{
-		data: make(map[uuid.UUID]T),
+// WithUniqueIndex adds a secondary index, like WithIndex, where no two values can have the same key.
+// A write giving a value the key of another fails with ErrUniquenessViolation.
+func WithUniqueIndex[T any](name string, key func(T) string) Option[T] {
+	return func(db *DB[T]) {
+		db.indexes[name] = newIndex(key, true)
 	}
 }
 
-func (r *DB[T]) GetByID(id uuid.UUID) (T, error) {
+func NewDB[T any](options ...Option[T]) *DB[T] {
+	db := &DB[T]{
+		data:    make(map[uuid.UUID]T),
+		clone:   func(v T) T { return v },
+		indexes: make(map[string]*index[T]),
+		feed:    newFeed[T](DefaultChangeRetention),
+	}
+	for _, o := range options {
+		o(db)
+	}
+	return db
+}
+
+func (r *DB[T]) GetByID(ctx context.Context, id uuid.UUID) (T, error) {
+	if tx, ok := r.tx(ctx); ok {
+		if w, ok := tx.writes[id]; ok {
+			if w.deleted {
+				var zero T
+				return zero, ErrDoesNotExist
+			}
+			return w.value, nil
+		}
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
 	if p, ok := r.data[id]; ok {
+		if tx, ok := r.tx(ctx); ok && r.versioning != nil {
+			tx.reads[id] = r.versioning.get(p)
+		}
 		return p, nil
 	}
 
+	if tx, ok := r.tx(ctx); ok && r.versioning != nil {
+		tx.reads[id] = absent
+	}
 	var zero T
 	return zero, ErrDoesNotExist
 }
 
-func (r *DB[T]) ListAll() []T {
+func (r *DB[T]) ListAll(ctx context.Context) []T {
+	tx, inTx := r.tx(ctx)
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
 	var list []T
-	for _, v := range r.data {
+	for k, v := range r.data {
+		if inTx {
+			if _, ok := tx.writes[k]; ok {
+				continue
+			}
+		}
 		list = append(list, v)
 	}
+	if inTx {
+		for _, k := range tx.order {
+			if w := tx.writes[k]; !w.deleted {
+				list = append(list, w.value)
+			}
+		}
+	}
 	return list
 }
 
-func (r *DB[T]) Create(id uuid.UUID, p T) error {
+// FindBy returns the values with the key in the index name.
+func (r *DB[T]) FindBy(ctx context.Context, name, key string) ([]T, error) {
+	idx, ok := r.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown index '%s'", name)
+	}
+	tx, inTx := r.tx(ctx)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var list []T
+	for id := range idx.ids[key] {
+		if inTx {
+			if _, ok := tx.writes[id]; ok {
+				continue
+			}
+		}
+		v := r.data[id]
+		if inTx && r.versioning != nil {
+			tx.reads[id] = r.versioning.get(v)
+		}
+		list = append(list, v)
+	}
+	if inTx {
+		for _, id := range tx.order {
+			if w := tx.writes[id]; !w.deleted && idx.key(w.value) == key {
+				list = append(list, w.value)
+			}
+		}
+	}
+	return list, nil
+}
+
+// GetBy returns the value with the key in the unique index name.
+// If more than one value has the key, eg: written before the index existed, any of them is returned.
+func (r *DB[T]) GetBy(ctx context.Context, name, key string) (T, error) {
+	list, err := r.FindBy(ctx, name, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if len(list) == 0 {
+		var zero T
+		return zero, ErrDoesNotExist
+	}
+	return list[0], nil
+}
+
+func (r *DB[T]) Create(ctx context.Context, id uuid.UUID, p T) error {
+	if tx, ok := r.tx(ctx); ok {
+		if _, err := r.GetByID(ctx, id); err == nil {
+			return ErrUniquenessViolation
+		}
+		// checked now, to fail early, and again on commit
+		err := r.checkUniqueRLocked(tx, id, p)
+		if err != nil {
+			return err
+		}
+		tx.stage(id, write[T]{value: p, created: true})
+		return nil
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	if _, ok := r.data[id]; ok {
 		return ErrUniquenessViolation
 	}
+	err := r.checkUnique(nil, id, p)
+	if err != nil {
+		return err
+	}
 
-	r.data[id] = p
-	return nil
+	return r.apply(map[uuid.UUID]write[T]{id: {value: p}}, []uuid.UUID{id})
 }
 
-func (r *DB[T]) Delete(id uuid.UUID) {
+func (r *DB[T]) Delete(ctx context.Context, id uuid.UUID) error {
+	if tx, ok := r.tx(ctx); ok {
+		tx.stage(id, write[T]{deleted: true})
+		return nil
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	delete(r.data, id)
+
+	return r.apply(map[uuid.UUID]write[T]{id: {deleted: true}}, []uuid.UUID{id})
 }
 
-func (r *DB[T]) Update(id uuid.UUID, fn func(p T) (T, error)) error {
+func (r *DB[T]) Update(ctx context.Context, id uuid.UUID, fn func(p T) (T, error)) error {
+	if tx, ok := r.tx(ctx); ok {
+		p, err := r.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		p, err = fn(r.clone(p))
+		if err != nil {
+			return err
+		}
+		err = r.checkUniqueRLocked(tx, id, p)
+		if err != nil {
+			return err
+		}
+		tx.stage(id, write[T]{value: r.nextVersion(p)})
+		return nil
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
@@ -72,11 +267,317 @@ func (r *DB[T]) Update(id uuid.UUID, fn func(p T) (T, error)) error {
 	}
 
 	var err error
-	p, err = fn(p)
+	p, err = fn(r.clone(p))
 	if err != nil {
 		return err
 	}
+	p = r.nextVersion(p)
+	err = r.checkUnique(nil, id, p)
+	if err != nil {
+		return err
+	}
+
+	return r.apply(map[uuid.UUID]write[T]{id: {value: p}}, []uuid.UUID{id})
+}
 
-	r.data[id] = p
+func (r *DB[T]) nextVersion(p T) T {
+	if r.versioning == nil {
+		return p
+	}
+	return r.versioning.set(p, r.versioning.get(p)+1)
+}
+
+// put stores the value, updating the indexes. Must be called with the lock held.
+func (r *DB[T]) put(id uuid.UUID, v T) {
+	r.remove(id)
+	r.data[id] = v
+	for _, idx := range r.indexes {
+		idx.add(id, v)
+	}
+}
+
+// remove deletes the value, updating the indexes. Must be called with the lock held.
+func (r *DB[T]) remove(id uuid.UUID) {
+	old, ok := r.data[id]
+	if !ok {
+		return
+	}
+	delete(r.data, id)
+	for _, idx := range r.indexes {
+		idx.remove(id, old)
+	}
+}
+
+// reindex rebuilds the indexes, and the sequence, from the data, eg: after it was recovered
+func (r *DB[T]) reindex() {
+	if r.sequence != nil {
+		for _, v := range r.data {
+			r.sequence.last = max(r.sequence.last, r.sequence.get(v))
+		}
+	}
+
+	for _, idx := range r.indexes {
+		idx.ids = make(map[string]map[uuid.UUID]struct{})
+		for id, v := range r.data {
+			idx.add(id, v)
+		}
+	}
+}
+
+func (r *DB[T]) checkUniqueRLocked(tx *staging[T], id uuid.UUID, v T) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.checkUnique(tx, id, v)
+}
+
+// checkUnique fails with ErrUniquenessViolation if writing v with the id, in the unit of work tx, if any,
+// gives it the key of another value in a unique index.
+// Values that already had the same key, eg: written before the index existed, are left as they are.
+// Must be called with the lock held.
+func (r *DB[T]) checkUnique(tx *staging[T], id uuid.UUID, v T) error {
+	for name, idx := range r.indexes {
+		if !idx.unique {
+			continue
+		}
+		key := idx.key(v)
+		if key == "" {
+			continue
+		}
+		if old, ok := r.data[id]; ok && idx.key(old) == key {
+			continue
+		}
+
+		for other := range idx.ids[key] {
+			if other == id {
+				continue
+			}
+			if tx != nil {
+				// the value is being changed, or deleted, in the unit of work
+				if _, ok := tx.writes[other]; ok {
+					continue
+				}
+			}
+			return fmt.Errorf("%s '%s': %w", name, key, ErrUniquenessViolation)
+		}
+		if tx == nil {
+			continue
+		}
+		for other, w := range tx.writes {
+			if other != id && !w.deleted && idx.key(w.value) == key {
+				return fmt.Errorf("%s '%s': %w", name, key, ErrUniquenessViolation)
+			}
+		}
+	}
+	return nil
+}
+
+// index is a secondary index of the values by a key
+type index[T any] struct {
+	key    func(T) string
+	unique bool
+	ids    map[string]map[uuid.UUID]struct{}
+}
+
+func newIndex[T any](key func(T) string, unique bool) *index[T] {
+	return &index[T]{
+		key:    key,
+		unique: unique,
+		ids:    make(map[string]map[uuid.UUID]struct{}),
+	}
+}
+
+func (x *index[T]) add(id uuid.UUID, v T) {
+	key := x.key(v)
+	if key == "" {
+		return
+	}
+	ids, ok := x.ids[key]
+	if !ok {
+		ids = make(map[uuid.UUID]struct{})
+		x.ids[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (x *index[T]) remove(id uuid.UUID, v T) {
+	key := x.key(v)
+	ids := x.ids[key]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(x.ids, key)
+	}
+}
+
+// apply makes the writes, in order, writing them to the journal, if any, before they are applied.
+// Must be called with the lock held.
+func (r *DB[T]) apply(writes map[uuid.UUID]write[T], order []uuid.UUID) error {
+	changes := r.changes(writes, order)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if r.journal != nil {
+		entries, err := r.journal.entries(changes)
+		if err != nil {
+			return err
+		}
+		err = r.journal.journal.write(entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.commit(changes)
 	return nil
 }
+
+// changes returns the changes the writes make, in order, numbered for the change feed. Must be called with the lock held.
+func (r *DB[T]) changes(writes map[uuid.UUID]write[T], order []uuid.UUID) []Change[T] {
+	changes := make([]Change[T], 0, len(order))
+	seq := r.feed.seq
+	var inserted uint64
+	if r.sequence != nil {
+		inserted = r.sequence.last
+	}
+	for _, id := range order {
+		w := writes[id]
+		old, exists := r.data[id]
+		c := Change[T]{ID: id, Before: old, After: w.value}
+		switch {
+		case w.deleted && !exists:
+			continue
+		case w.deleted:
+			c.Op = OpDelete
+			var zero T
+			c.After = zero
+		case exists:
+			c.Op = OpUpdate
+		default:
+			c.Op = OpInsert
+		}
+		seq++
+		c.Seq = seq
+		if c.Op == OpInsert && r.sequence != nil {
+			inserted++
+			c.After = r.sequence.set(c.After, inserted)
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// commit applies the changes and publishes them. Must be called with the lock held.
+func (r *DB[T]) commit(changes []Change[T]) {
+	if len(changes) == 0 {
+		return
+	}
+
+	for _, c := range changes {
+		if c.Op == OpDelete {
+			r.remove(c.ID)
+		} else {
+			r.put(c.ID, c.After)
+		}
+		if c.Op == OpInsert && r.sequence != nil {
+			r.sequence.last = max(r.sequence.last, r.sequence.get(c.After))
+		}
+	}
+	r.feed.publish(changes)
+}
+
+func (r *DB[T]) tx(ctx context.Context) (*staging[T], bool) {
+	return uow.Enlist(ctx, r, func() *staging[T] {
+		s := &staging[T]{
+			db:     r,
+			writes: make(map[uuid.UUID]write[T]),
+			reads:  make(map[uuid.UUID]int),
+		}
+		if r.journal != nil {
+			s.journal = r.journal.tx(ctx)
+		}
+		return s
+	})
+}
+
+type write[T any] struct {
+	value   T
+	created bool
+	deleted bool
+}
+
+// staging holds the changes made to a DB during a unit of work
+type staging[T any] struct {
+	db     *DB[T]
+	writes map[uuid.UUID]write[T]
+	order  []uuid.UUID
+	// reads holds the versions of the stored values read, or absent for the values found missing
+	reads map[uuid.UUID]int
+	// changes are the changes of the writes, numbered on prepare
+	changes []Change[T]
+	journal *journalTx
+}
+
+func (s *staging[T]) stage(id uuid.UUID, w write[T]) {
+	if prev, ok := s.writes[id]; ok {
+		// a value created in this unit of work is still a creation when updated or deleted
+		w.created = prev.created
+	} else {
+		s.order = append(s.order, id)
+	}
+	s.writes[id] = w
+}
+
+func (s *staging[T]) Lock() {
+	s.db.mutex.Lock()
+}
+
+func (s *staging[T]) Unlock() {
+	s.db.mutex.Unlock()
+}
+
+func (s *staging[T]) Prepare() error {
+	for id, version := range s.reads {
+		current := absent
+		if v, ok := s.db.data[id]; ok {
+			current = s.db.versioning.get(v)
+		}
+		if current != version {
+			return fmt.Errorf("%s changed since read: %w", id, fails.ErrConcurrencyConflict)
+		}
+	}
+
+	for _, id := range s.order {
+		w := s.writes[id]
+		_, exists := s.db.data[id]
+		switch {
+		case w.created && !w.deleted && exists:
+			return ErrUniquenessViolation
+		case !w.created && !w.deleted && !exists:
+			return ErrDoesNotExist
+		}
+		if !w.deleted {
+			err := s.db.checkUnique(s, id, w.value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	s.changes = s.db.changes(s.writes, s.order)
+	if s.journal != nil {
+		entries, err := s.db.journal.entries(s.changes)
+		if err != nil {
+			return err
+		}
+		s.journal.entries = append(s.journal.entries, entries...)
+	}
+	return nil
+}
+
+func (s *staging[T]) Commit() error {
+	s.db.commit(s.changes)
+	return nil
+}
+
+func (s *staging[T]) Rollback() {}
@@ -0,0 +1,209 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+type user struct {
+	Email string
+	Team  string
+}
+
+func newUsers() *DB[user] {
+	return NewDB(
+		WithUniqueIndex("email", func(u user) string { return u.Email }),
+		WithIndex("team", func(u user) string { return u.Team }),
+	)
+}
+
+func TestUniqueIndex(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name string
+		// write runs against a DB holding a@ and b@
+		write   func(ctx context.Context, db *DB[user]) error
+		wantErr error
+		// wantEmail is the owner of each email after the write, if it succeeded
+		wantEmail map[string]uuid.UUID
+	}{
+		{
+			name: "create with a new key",
+			write: func(ctx context.Context, db *DB[user]) error {
+				return db.Create(ctx, uuid.New(), user{Email: "c@"})
+			},
+		},
+		{
+			name: "create with a taken key",
+			write: func(ctx context.Context, db *DB[user]) error {
+				return db.Create(ctx, uuid.New(), user{Email: "a@"})
+			},
+			wantErr: ErrUniquenessViolation,
+		},
+		{
+			name: "empty keys are not indexed",
+			write: func(ctx context.Context, db *DB[user]) error {
+				err := db.Create(ctx, uuid.New(), user{})
+				if err != nil {
+					return err
+				}
+				return db.Create(ctx, uuid.New(), user{})
+			},
+		},
+		{
+			name: "update keeping its key",
+			write: func(ctx context.Context, db *DB[user]) error {
+				return db.Update(ctx, a, func(u user) (user, error) {
+					u.Team = "red"
+					return u, nil
+				})
+			},
+			wantEmail: map[string]uuid.UUID{"a@": a},
+		},
+		{
+			name: "update to a taken key",
+			write: func(ctx context.Context, db *DB[user]) error {
+				return db.Update(ctx, a, func(u user) (user, error) {
+					u.Email = "b@"
+					return u, nil
+				})
+			},
+			wantErr: ErrUniquenessViolation,
+		},
+		{
+			name: "key freed in the same unit of work",
+			write: func(ctx context.Context, db *DB[user]) error {
+				return uow.Run(ctx, func(ctx context.Context) error {
+					err := db.Delete(ctx, a)
+					if err != nil {
+						return err
+					}
+					return db.Update(ctx, b, func(u user) (user, error) {
+						u.Email = "a@"
+						return u, nil
+					})
+				})
+			},
+			wantEmail: map[string]uuid.UUID{"a@": b},
+		},
+		{
+			name: "same key twice in a unit of work",
+			write: func(ctx context.Context, db *DB[user]) error {
+				return uow.Run(ctx, func(ctx context.Context) error {
+					err := db.Create(ctx, uuid.New(), user{Email: "c@"})
+					if err != nil {
+						return err
+					}
+					return db.Create(ctx, uuid.New(), user{Email: "c@"})
+				})
+			},
+			wantErr: ErrUniquenessViolation,
+		},
+		{
+			name: "key taken by another unit of work before the commit",
+			write: func(ctx context.Context, db *DB[user]) error {
+				return uow.Run(ctx, func(ctx context.Context) error {
+					err := db.Create(ctx, uuid.New(), user{Email: "c@"})
+					if err != nil {
+						return err
+					}
+					return db.Create(context.Background(), uuid.New(), user{Email: "c@"})
+				})
+			},
+			wantErr: ErrUniquenessViolation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newUsers()
+			for id, email := range map[uuid.UUID]string{a: "a@", b: "b@"} {
+				err := db.Create(ctx, id, user{Email: email, Team: "blue"})
+				if err != nil {
+					t.Fatalf("Create(%s) error = %v", email, err)
+				}
+			}
+
+			err := tt.write(ctx, db)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("write error = %v, want %v", err, tt.wantErr)
+			}
+
+			for email, id := range tt.wantEmail {
+				got, err := db.GetBy(ctx, "email", email)
+				if err != nil {
+					t.Fatalf("GetBy(%s) error = %v", email, err)
+				}
+				want, _ := db.GetByID(ctx, id)
+				if got != want {
+					t.Errorf("GetBy(%s) = %+v, want %+v", email, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFindBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   string
+		key     string
+		staged  bool
+		want    []string
+		wantErr bool
+	}{
+		{name: "several values", index: "team", key: "blue", want: []string{"a@", "b@"}},
+		{name: "values staged in the unit of work", index: "team", key: "blue", staged: true, want: []string{"a@", "b@", "c@"}},
+		{name: "no value", index: "team", key: "green"},
+		{name: "unique index", index: "email", key: "b@", want: []string{"b@"}},
+		{name: "unknown index", index: "name", key: "x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newUsers()
+			for _, u := range []user{{Email: "a@", Team: "blue"}, {Email: "b@", Team: "blue"}, {Email: "r@", Team: "red"}} {
+				err := db.Create(ctx, uuid.New(), u)
+				if err != nil {
+					t.Fatalf("Create(%s) error = %v", u.Email, err)
+				}
+			}
+
+			var (
+				found []user
+				err   error
+			)
+			_ = uow.Run(ctx, func(ctx context.Context) error {
+				if tt.staged {
+					err := db.Create(ctx, uuid.New(), user{Email: "c@", Team: "blue"})
+					if err != nil {
+						t.Fatalf("Create(c@) error = %v", err)
+					}
+				}
+				found, err = db.FindBy(ctx, tt.index, tt.key)
+				// nothing is committed
+				return errors.New("rollback")
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindBy() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, u := range found {
+				got = append(got, u.Email)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
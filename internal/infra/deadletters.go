@@ -0,0 +1,106 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+// DeadLetters keeps the dead letters of the event bus in a DB backed by a journal.
+type DeadLetters struct {
+	db       *DB[deadLetterRecord]
+	registry *eventbus.Registry
+}
+
+type deadLetterRecord struct {
+	ID       uuid.UUID         `json:"id"`
+	Handler  string            `json:"handler"`
+	Kind     string            `json:"kind"`
+	Payload  json.RawMessage   `json:"payload"`
+	Metadata eventbus.Metadata `json:"metadata"`
+	Error    string            `json:"error"`
+	Attempts int               `json:"attempts"`
+	FailedAt time.Time         `json:"failedAt"`
+}
+
+func NewFileDeadLetters(j *Journal, registry *eventbus.Registry) (*DeadLetters, error) {
+	db, err := NewFileDB(j, "dead-letters", jsonCodec[deadLetterRecord]{})
+	if err != nil {
+		return nil, fmt.Errorf("opening dead letters db: %w", err)
+	}
+
+	return &DeadLetters{
+		db:       db,
+		registry: registry,
+	}, nil
+}
+
+func (s *DeadLetters) Add(ctx context.Context, dl eventbus.DeadLetter) error {
+	payload, err := s.registry.Encode(dl.Message)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Create(ctx, dl.ID, deadLetterRecord{
+		ID:       dl.ID,
+		Handler:  dl.Handler,
+		Kind:     dl.Message.Kind(),
+		Payload:  payload,
+		Metadata: dl.Metadata,
+		Error:    dl.Error,
+		Attempts: dl.Attempts,
+		FailedAt: dl.FailedAt.UTC(),
+	})
+}
+
+func (s *DeadLetters) List(ctx context.Context) ([]eventbus.DeadLetter, error) {
+	records := s.db.ListAll(ctx)
+	slices.SortFunc(records, func(a, b deadLetterRecord) int { return a.FailedAt.Compare(b.FailedAt) })
+
+	list := make([]eventbus.DeadLetter, 0, len(records))
+	for _, r := range records {
+		dl, err := s.decode(r)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, dl)
+	}
+	return list, nil
+}
+
+func (s *DeadLetters) Get(ctx context.Context, id uuid.UUID) (eventbus.DeadLetter, error) {
+	r, err := s.db.GetByID(ctx, id)
+	if errors.Is(err, ErrDoesNotExist) {
+		return eventbus.DeadLetter{}, eventbus.ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return eventbus.DeadLetter{}, err
+	}
+	return s.decode(r)
+}
+
+func (s *DeadLetters) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.db.Delete(ctx, id)
+}
+
+func (s *DeadLetters) decode(r deadLetterRecord) (eventbus.DeadLetter, error) {
+	m, err := s.registry.Decode(r.Kind, r.Payload)
+	if err != nil {
+		return eventbus.DeadLetter{}, fmt.Errorf("dead letter %s: %w", r.ID, err)
+	}
+	return eventbus.DeadLetter{
+		ID:       r.ID,
+		Handler:  r.Handler,
+		Message:  m,
+		Metadata: r.Metadata,
+		Error:    r.Error,
+		Attempts: r.Attempts,
+		FailedAt: r.FailedAt,
+	}, nil
+}
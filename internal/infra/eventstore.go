@@ -0,0 +1,263 @@
+package infra
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/eventstore"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+const (
+	streamIndex   = "stream"
+	positionIndex = "position"
+)
+
+// EventStore is an event store kept in DBs, in memory or backed by write-ahead logs (see NewFileEventStore).
+type EventStore struct {
+	// streams holds the version of each stream, kept only in memory since it is derived from the events
+	streams   *DB[streamHead]
+	events    *DB[eventRecord]
+	snapshots *DB[snapshotRecord]
+	registry  *eventbus.Registry
+}
+
+type streamHead struct {
+	ID      uuid.UUID
+	Version int
+	// rev is incremented on every append, so that the concurrent appends to a stream are detected on commit
+	rev int
+}
+
+// eventRecord is an envelope in a stream. Its ID is the ID of the event, and At when the event occurred.
+type eventRecord struct {
+	ID            uuid.UUID       `json:"id"`
+	StreamID      uuid.UUID       `json:"streamId"`
+	Version       int             `json:"version"`
+	Kind          string          `json:"kind"`
+	Payload       json.RawMessage `json:"payload"`
+	At            time.Time       `json:"at"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	CausationID   string          `json:"causationId,omitempty"`
+	SchemaVersion int             `json:"schemaVersion,omitempty"`
+}
+
+type snapshotRecord struct {
+	StreamID uuid.UUID `json:"streamId"`
+	Version  int       `json:"version"`
+	Data     []byte    `json:"data"`
+}
+
+var eventOptions = []Option[eventRecord]{
+	WithIndex(streamIndex, func(e eventRecord) string { return e.StreamID.String() }),
+	// the events of a stream are numbered without gaps, whoever appends them
+	WithUniqueIndex(positionIndex, func(e eventRecord) string { return fmt.Sprintf("%s/%d", e.StreamID, e.Version) }),
+}
+
+// NewEventStore returns an event store kept in memory, whose messages are encoded with the registry.
+func NewEventStore(registry *eventbus.Registry) *EventStore {
+	return &EventStore{
+		streams:   newStreamHeads(),
+		events:    NewDB(eventOptions...),
+		snapshots: NewDB[snapshotRecord](),
+		registry:  registry,
+	}
+}
+
+// NewFileEventStore returns an event store that keeps the events and the snapshots in the journal, under name.
+func NewFileEventStore(j *Journal, name string, registry *eventbus.Registry) (*EventStore, error) {
+	events, err := NewFileDB(j, name+"/events", jsonCodec[eventRecord]{}, eventOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("opening events db: %w", err)
+	}
+	snapshots, err := NewFileDB(j, name+"/snapshots", jsonCodec[snapshotRecord]{})
+	if err != nil {
+		return nil, fmt.Errorf("opening snapshots db: %w", err)
+	}
+
+	s := &EventStore{
+		streams:   newStreamHeads(),
+		events:    events,
+		snapshots: snapshots,
+		registry:  registry,
+	}
+
+	heads := map[uuid.UUID]int{}
+	for _, e := range events.ListAll(context.Background()) {
+		heads[e.StreamID] = max(heads[e.StreamID], e.Version)
+	}
+	for id, version := range heads {
+		err = s.streams.Create(context.Background(), id, streamHead{ID: id, Version: version})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func newStreamHeads() *DB[streamHead] {
+	return NewDB(WithVersioning(
+		func(h streamHead) int { return h.rev },
+		func(h streamHead, rev int) streamHead {
+			h.rev = rev
+			return h
+		},
+	))
+}
+
+func (s *EventStore) Append(ctx context.Context, stream uuid.UUID, expected int, envs ...eventbus.Envelope) error {
+	if len(envs) == 0 {
+		return nil
+	}
+
+	return uow.Run(ctx, func(ctx context.Context) error {
+		err := s.advance(ctx, stream, expected, len(envs))
+		if err != nil {
+			return err
+		}
+
+		for i, env := range envs {
+			payload, err := s.registry.Encode(env.Message)
+			if err != nil {
+				return err
+			}
+
+			err = s.events.Create(ctx, env.EventID, eventRecord{
+				ID:            env.EventID,
+				StreamID:      stream,
+				Version:       expected + i + 1,
+				Kind:          env.Message.Kind(),
+				Payload:       payload,
+				At:            env.OccurredAt.UTC(),
+				CorrelationID: env.CorrelationID,
+				CausationID:   env.CausationID,
+				SchemaVersion: env.SchemaVersion,
+			})
+			if errors.Is(err, ErrUniquenessViolation) {
+				return fmt.Errorf("stream %s: %w", stream, eventstore.ErrConflict)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// advance moves the stream from the expected version n events ahead, creating it if it is new
+func (s *EventStore) advance(ctx context.Context, stream uuid.UUID, expected, n int) error {
+	_, err := s.streams.GetByID(ctx, stream)
+	if errors.Is(err, ErrDoesNotExist) {
+		if expected != 0 {
+			return fmt.Errorf("stream %s does not exist, expected version %d: %w", stream, expected, eventstore.ErrConflict)
+		}
+		err = s.streams.Create(ctx, stream, streamHead{ID: stream, Version: n})
+		if errors.Is(err, ErrUniquenessViolation) {
+			return fmt.Errorf("stream %s: %w", stream, eventstore.ErrConflict)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.streams.Update(ctx, stream, func(h streamHead) (streamHead, error) {
+		if h.Version != expected {
+			return h, fmt.Errorf("stream %s is at version %d, expected %d: %w", stream, h.Version, expected, eventstore.ErrConflict)
+		}
+		h.Version += n
+		return h, nil
+	})
+}
+
+func (s *EventStore) Load(ctx context.Context, stream uuid.UUID, from int) ([]eventbus.Envelope, error) {
+	records, err := s.events.FindBy(ctx, streamIndex, stream.String())
+	if err != nil {
+		return nil, err
+	}
+	records = slices.DeleteFunc(records, func(e eventRecord) bool { return e.Version <= from })
+	slices.SortFunc(records, func(a, b eventRecord) int { return cmp.Compare(a.Version, b.Version) })
+
+	envs := make([]eventbus.Envelope, 0, len(records))
+	for _, r := range records {
+		m, err := s.registry.Decode(r.Kind, r.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("event %d of stream %s: %w", r.Version, stream, err)
+		}
+		envs = append(envs, eventbus.Envelope{
+			Metadata: eventbus.Metadata{
+				EventID:          r.ID,
+				OccurredAt:       r.At,
+				AggregateID:      r.StreamID,
+				AggregateVersion: r.Version,
+				CorrelationID:    r.CorrelationID,
+				CausationID:      r.CausationID,
+				SchemaVersion:    max(r.SchemaVersion, 1),
+			},
+			Message: m,
+		})
+	}
+	return envs, nil
+}
+
+func (s *EventStore) Streams(ctx context.Context) ([]uuid.UUID, error) {
+	heads := s.streams.ListAll(ctx)
+	ids := make([]uuid.UUID, 0, len(heads))
+	for _, h := range heads {
+		ids = append(ids, h.ID)
+	}
+	return ids, nil
+}
+
+func (s *EventStore) SaveSnapshot(ctx context.Context, snap eventstore.Snapshot) error {
+	r := snapshotRecord(snap)
+	return uow.Run(ctx, func(ctx context.Context) error {
+		_, err := s.snapshots.GetByID(ctx, snap.StreamID)
+		if errors.Is(err, ErrDoesNotExist) {
+			return s.snapshots.Create(ctx, snap.StreamID, r)
+		}
+		if err != nil {
+			return err
+		}
+		return s.snapshots.Update(ctx, snap.StreamID, func(snapshotRecord) (snapshotRecord, error) {
+			return r, nil
+		})
+	})
+}
+
+func (s *EventStore) LoadSnapshot(ctx context.Context, stream uuid.UUID) (eventstore.Snapshot, error) {
+	r, err := s.snapshots.GetByID(ctx, stream)
+	if errors.Is(err, ErrDoesNotExist) {
+		return eventstore.Snapshot{}, fmt.Errorf("stream %s: %w", stream, eventstore.ErrNoSnapshot)
+	}
+	if err != nil {
+		return eventstore.Snapshot{}, err
+	}
+
+	head, err := s.streams.GetByID(ctx, stream)
+	if err != nil || head.Version < r.Version {
+		// eg: a crash saved the snapshot but not the events it includes
+		return eventstore.Snapshot{}, fmt.Errorf("stream %s, snapshot ahead of the events: %w", stream, eventstore.ErrNoSnapshot)
+	}
+	return eventstore.Snapshot(r), nil
+}
+
+// jsonCodec encodes the values as JSON
+type jsonCodec[T any] struct{}
+
+func (jsonCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
@@ -0,0 +1,171 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/eventstore"
+)
+
+type testEvent struct {
+	N int
+}
+
+func (testEvent) Kind() string {
+	return "TestEvent"
+}
+
+func newTestRegistry() *eventbus.Registry {
+	r := eventbus.NewRegistry()
+	eventbus.RegisterKind[testEvent](r)
+	return r
+}
+
+// eventStores returns the event stores to test, by name.
+// The file backed one is reopened before being checked, so that what it returns was recovered from the journal.
+func eventStores() map[string]func(t *testing.T, write func(*EventStore)) *EventStore {
+	return map[string]func(t *testing.T, write func(*EventStore)) *EventStore{
+		"memory": func(_ *testing.T, write func(*EventStore)) *EventStore {
+			s := NewEventStore(newTestRegistry())
+			write(s)
+			return s
+		},
+		"file": func(t *testing.T, write func(*EventStore)) *EventStore {
+			t.Helper()
+
+			dir := t.TempDir()
+			j, err := OpenJournal(dir, FileConfig{})
+			if err != nil {
+				t.Fatalf("OpenJournal() error = %v", err)
+			}
+			s, err := NewFileEventStore(j, "test", newTestRegistry())
+			if err != nil {
+				t.Fatalf("NewFileEventStore() error = %v", err)
+			}
+			write(s)
+			err = j.Close()
+			if err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			j, err = OpenJournal(dir, FileConfig{})
+			if err != nil {
+				t.Fatalf("reopening journal: %v", err)
+			}
+			t.Cleanup(func() { j.Close() })
+			s, err = NewFileEventStore(j, "test", newTestRegistry())
+			if err != nil {
+				t.Fatalf("reopening event store: %v", err)
+			}
+			return s
+		},
+	}
+}
+
+func appendEvents(t *testing.T, s *EventStore, stream uuid.UUID, from, to int) {
+	t.Helper()
+
+	ctx := context.Background()
+	for n := from + 1; n <= to; n++ {
+		err := s.Append(ctx, stream, n-1, eventbus.Wrap(ctx, stream, n, testEvent{N: n})...)
+		if err != nil {
+			t.Fatalf("Append(%d) error = %v", n, err)
+		}
+	}
+}
+
+func TestEventStoreSnapshots(t *testing.T) {
+	stream := uuid.New()
+
+	tests := []struct {
+		name   string
+		events int
+		// snapshots are the versions of the snapshots saved, in order
+		snapshots   []int
+		wantErr     error
+		wantVersion int
+	}{
+		{name: "no snapshot", events: 3, wantErr: eventstore.ErrNoSnapshot},
+		{name: "no stream", wantErr: eventstore.ErrNoSnapshot},
+		{name: "snapshot", events: 3, snapshots: []int{2}, wantVersion: 2},
+		{name: "replaced snapshot", events: 3, snapshots: []int{2, 3}, wantVersion: 3},
+		{name: "snapshot ahead of the events", events: 3, snapshots: []int{5}, wantErr: eventstore.ErrNoSnapshot},
+	}
+
+	for backend, open := range eventStores() {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				s := open(t, func(s *EventStore) {
+					appendEvents(t, s, stream, 0, tt.events)
+					for _, v := range tt.snapshots {
+						err := s.SaveSnapshot(ctx, eventstore.Snapshot{StreamID: stream, Version: v, Data: []byte(`{}`)})
+						if err != nil {
+							t.Fatalf("SaveSnapshot(%d) error = %v", v, err)
+						}
+					}
+				})
+
+				snap, err := s.LoadSnapshot(ctx, stream)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LoadSnapshot() error = %v, want %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if snap.Version != tt.wantVersion || snap.StreamID != stream {
+					t.Errorf("LoadSnapshot() = %+v, want version %d of stream %s", snap, tt.wantVersion, stream)
+				}
+
+				// only the events after the snapshot are replayed
+				envs, err := s.Load(ctx, stream, snap.Version)
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				if len(envs) != tt.events-snap.Version {
+					t.Fatalf("Load() = %d events, want %d", len(envs), tt.events-snap.Version)
+				}
+				for i, env := range envs {
+					want := snap.Version + i + 1
+					if env.AggregateVersion != want || env.Message != (testEvent{N: want}) {
+						t.Errorf("event %d = %+v at version %d, want %d", i, env.Message, env.AggregateVersion, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestEventStoreAppend(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   int
+		expected int
+		wantErr  error
+	}{
+		{name: "new stream", expected: 0},
+		{name: "at the expected version", events: 2, expected: 2},
+		{name: "behind the expected version", events: 2, expected: 1, wantErr: eventstore.ErrConflict},
+		{name: "new stream at a version", expected: 1, wantErr: eventstore.ErrConflict},
+	}
+
+	for backend, open := range eventStores() {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				stream := uuid.New()
+				s := open(t, func(s *EventStore) {
+					appendEvents(t, s, stream, 0, tt.events)
+				})
+
+				err := s.Append(ctx, stream, tt.expected, eventbus.Wrap(ctx, stream, 0, testEvent{})...)
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Append() error = %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
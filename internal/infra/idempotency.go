@@ -0,0 +1,72 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileIdempotency is an idempotency store kept in a DB backed by a journal, written in the same record as the aggregates.
+type FileIdempotency struct {
+	db *DB[idempotencyRecord]
+}
+
+type idempotencyRecord struct {
+	Key string `json:"key"`
+	// Version is only there so that a key found missing in a unit of work is checked to be still missing on commit
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func NewFileIdempotency(j *Journal) (*FileIdempotency, error) {
+	db, err := NewFileDB(j, "idempotency", jsonCodec[idempotencyRecord]{}, WithVersioning(
+		func(r idempotencyRecord) int { return r.Version },
+		func(r idempotencyRecord, version int) idempotencyRecord {
+			r.Version = version
+			return r
+		},
+	))
+	if err != nil {
+		return nil, fmt.Errorf("opening idempotency db: %w", err)
+	}
+
+	return &FileIdempotency{db: db}, nil
+}
+
+func (s *FileIdempotency) Claim(ctx context.Context, key string) (bool, error) {
+	id := keyID("idempotency", key)
+	_, err := s.db.GetByID(ctx, id)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ErrDoesNotExist) {
+		return false, err
+	}
+
+	err = s.db.Create(ctx, id, idempotencyRecord{
+		Key:       key,
+		Version:   1,
+		CreatedAt: time.Now().UTC(),
+	})
+	if errors.Is(err, ErrUniquenessViolation) {
+		// claimed in the meantime
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *FileIdempotency) Contains(ctx context.Context, key string) (bool, error) {
+	_, err := s.db.GetByID(ctx, keyID("idempotency", key))
+	if errors.Is(err, ErrDoesNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// keyID returns the ID of a value identified by a string key, in the space of kind
+func keyID(kind, key string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(kind+":"+key))
+}
@@ -0,0 +1,498 @@
+package infra
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+const (
+	logFile      = "wal.log"
+	snapshotFile = "snapshot.json"
+)
+
+// Codec converts values to and from bytes, so that they can be written to disk.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// SyncMode defines when the write-ahead log is flushed to disk.
+type SyncMode int
+
+const (
+	// SyncAlways flushes after every write. Nothing acknowledged is lost on a crash.
+	SyncAlways SyncMode = iota
+	// SyncPeriodic flushes every sync interval, if there were writes since the last flush.
+	// Up to an interval of writes can be lost on a crash.
+	SyncPeriodic
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+var syncModes = []string{
+	SyncAlways:   "always",
+	SyncPeriodic: "periodic",
+	SyncNever:    "never",
+}
+
+func (m SyncMode) String() string {
+	if int(m) < len(syncModes) {
+		return syncModes[m]
+	}
+	return fmt.Sprintf("SyncMode(%d)", int(m))
+}
+
+func (m SyncMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText parses the name of a sync mode, eg: periodic
+func (m *SyncMode) UnmarshalText(text []byte) error {
+	i := slices.Index(syncModes, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown sync mode '%s', expected one of %v", text, syncModes)
+	}
+	*m = SyncMode(i)
+	return nil
+}
+
+// FileConfig configures the durability of the file backed DBs.
+type FileConfig struct {
+	Sync SyncMode `yaml:"sync"`
+	// SyncInterval is used by SyncPeriodic. Defaults to one second.
+	SyncInterval time.Duration `yaml:"syncInterval"`
+	// SnapshotEvery is the number of log records after which the log is compacted into a snapshot. Defaults to 1000.
+	SnapshotEvery int `yaml:"snapshotEvery"`
+}
+
+type entry struct {
+	// DB is the name the DB was opened with
+	DB      string    `json:"db"`
+	ID      uuid.UUID `json:"id"`
+	Deleted bool      `json:"deleted,omitempty"`
+	Data    []byte    `json:"data,omitempty"`
+	// Seq is the sequence number of the change, for the change feed
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// Journal is a write-ahead log shared by the DBs opened on it (see NewFileDB), periodically compacted into a snapshot.
+// The changes a unit of work makes to all of them are written as a single record, so that they are recovered together or not at all.
+// It keeps an encoded copy of the data, to compact the log without going through the DBs.
+type Journal struct {
+	dir string
+	cfg FileConfig
+
+	mu      sync.Mutex
+	file    walFile
+	records int
+	// offset is where the last complete record ends, the log is truncated back to it if a write fails
+	offset int64
+	// broken is set if the log could not be truncated after a failed write or sync, failing the writes that follow
+	broken error
+	dirty  bool
+	// data is the encoded data of every DB, by name, and seqs the sequence number of their last change
+	data map[string]map[uuid.UUID][]byte
+	seqs map[string]uint64
+	dbs  map[string]struct{}
+
+	done   chan struct{}
+	closed chan struct{}
+}
+
+// walFile is the file of the log
+type walFile interface {
+	io.WriteCloser
+	io.Seeker
+	Truncate(size int64) error
+	Sync() error
+}
+
+// OpenJournal opens the write-ahead log in dir, recovering the data from the last snapshot and the log.
+func OpenJournal(dir string, cfg FileConfig) (*Journal, error) {
+	if cfg.SyncInterval == 0 {
+		cfg.SyncInterval = time.Second
+	}
+	if cfg.SnapshotEvery == 0 {
+		cfg.SnapshotEvery = 1000
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating data dir: %w", err)
+	}
+
+	j := &Journal{
+		dir:  dir,
+		cfg:  cfg,
+		data: make(map[string]map[uuid.UUID][]byte),
+		seqs: make(map[string]uint64),
+		dbs:  make(map[string]struct{}),
+	}
+	err = j.recover()
+	if err != nil {
+		return nil, fmt.Errorf("recovering %s: %w", dir, err)
+	}
+
+	// compacting right away leaves a clean log, without any torn record left by a crash
+	err = j.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Sync == SyncPeriodic {
+		j.done = make(chan struct{})
+		j.closed = make(chan struct{})
+		go j.syncEvery(cfg.SyncInterval)
+	}
+	return j, nil
+}
+
+// NewFileDB returns a DB, named name in the journal, whose changes are written to the journal before they are applied.
+// Its data is recovered from the journal.
+// It panics if a DB with the same name was already opened on the journal.
+func NewFileDB[T any](j *Journal, name string, codec Codec[T], options ...Option[T]) (*DB[T], error) {
+	db := NewDB(options...)
+	data, seq := j.attach(name)
+	for id, b := range data {
+		v, err := codec.Decode(b)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s %s: %w", name, id, err)
+		}
+		db.data[id] = v
+	}
+	db.feed.seq = seq
+	db.reindex()
+	db.journal = &dbJournal[T]{
+		journal: j,
+		name:    name,
+		codec:   codec,
+	}
+	return db, nil
+}
+
+func (j *Journal) attach(name string) (map[uuid.UUID][]byte, uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.dbs[name]; ok {
+		panic(fmt.Sprintf("journal: a DB named %s is already open", name))
+	}
+	j.dbs[name] = struct{}{}
+	return j.data[name], j.seqs[name]
+}
+
+// recover loads the data from the snapshot and the log
+func (j *Journal) recover() error {
+	f, err := os.Open(filepath.Join(j.dir, snapshotFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("opening snapshot: %w", err)
+	default:
+		var entries []entry
+		err = json.NewDecoder(f).Decode(&entries)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+		j.apply(entries)
+	}
+
+	f, err = os.Open(filepath.Join(j.dir, logFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening log: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// an unterminated line is a write torn by a crash, that was never acknowledged
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading log: %w", err)
+		}
+
+		var entries []entry
+		err = json.Unmarshal(line, &entries)
+		if err != nil {
+			if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+				// a garbled last line is also a torn write
+				return nil
+			}
+			return fmt.Errorf("decoding log record: %w", err)
+		}
+		j.apply(entries)
+	}
+}
+
+func (j *Journal) apply(entries []entry) {
+	for _, e := range entries {
+		j.seqs[e.DB] = max(j.seqs[e.DB], e.Seq)
+		data := j.data[e.DB]
+		if data == nil {
+			data = make(map[uuid.UUID][]byte)
+			j.data[e.DB] = data
+		}
+		if e.Deleted {
+			delete(data, e.ID)
+		} else {
+			data[e.ID] = e.Data
+		}
+	}
+}
+
+// write appends the entries to the log as one record, compacting the log if it grew too much.
+// If the write fails the log is truncated back to the last complete record, so that a later write does not follow a torn one.
+func (j *Journal) write(entries []entry) error {
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.broken != nil {
+		return j.broken
+	}
+
+	_, err = j.file.Write(buf)
+	if err != nil {
+		return j.undo(fmt.Errorf("writing log: %w", err))
+	}
+	j.dirty = true
+	// the record is only applied once it is as durable as asked, so that a failed write is not seen before a restart
+	if j.cfg.Sync == SyncAlways {
+		err = j.sync()
+		if err != nil {
+			return j.undo(err)
+		}
+	}
+	j.offset += int64(len(buf))
+	j.records++
+	j.apply(entries)
+
+	if j.records >= j.cfg.SnapshotEvery {
+		// the record is already in the log, so a failed compaction is retried with the next ones instead of failing it
+		err = j.compactLocked()
+		if err != nil {
+			slog.Error("compacting write-ahead log", "dir", j.dir, "error", err)
+		}
+	}
+	return nil
+}
+
+// undo truncates the log back to the end of the last complete record, dropping the one that failed with err,
+// so that it is not recovered either. If the log cannot be truncated, the journal is broken. Must be called with mu held.
+func (j *Journal) undo(err error) error {
+	terr := j.file.Truncate(j.offset)
+	if terr == nil {
+		_, terr = j.file.Seek(j.offset, io.SeekStart)
+	}
+	if terr == nil && j.cfg.Sync == SyncAlways {
+		terr = j.file.Sync()
+	}
+	if terr != nil {
+		j.broken = fmt.Errorf("log left torn by a failed write: %w", terr)
+		return errors.Join(err, j.broken)
+	}
+	if j.cfg.Sync == SyncAlways {
+		j.dirty = false
+	}
+	return err
+}
+
+func (j *Journal) syncEvery(interval time.Duration) {
+	defer close(j.closed)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.done:
+			return
+		case <-ticker.C:
+			j.mu.Lock()
+			err := j.sync()
+			j.mu.Unlock()
+			if err != nil {
+				slog.Error("syncing write-ahead log", "dir", j.dir, "error", err)
+			}
+		}
+	}
+}
+
+// sync flushes the log if it was written since the last flush. Must be called with mu held.
+func (j *Journal) sync() error {
+	if !j.dirty || j.file == nil {
+		return nil
+	}
+	err := j.file.Sync()
+	if err != nil {
+		return fmt.Errorf("syncing log: %w", err)
+	}
+	j.dirty = false
+	return nil
+}
+
+func (j *Journal) compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.compactLocked()
+}
+
+// compactLocked writes all the data to a new snapshot and starts an empty log. Must be called with mu held.
+func (j *Journal) compactLocked() error {
+	var entries []entry
+	for db, data := range j.data {
+		for id, b := range data {
+			entries = append(entries, entry{DB: db, ID: id, Data: b})
+		}
+	}
+	// the sequence numbers are kept by deleting the nil ID, that is never stored, so that they are kept even without data
+	for db, seq := range j.seqs {
+		entries = append(entries, entry{DB: db, ID: uuid.Nil, Deleted: true, Seq: seq})
+	}
+
+	tmp := filepath.Join(j.dir, snapshotFile+".tmp")
+	err := writeFile(tmp, entries)
+	if err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	err = os.Rename(tmp, filepath.Join(j.dir, snapshotFile))
+	if err != nil {
+		return fmt.Errorf("replacing snapshot: %w", err)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file = nil
+	f, err := os.Create(filepath.Join(j.dir, logFile))
+	if err != nil {
+		j.broken = fmt.Errorf("creating log: %w", err)
+		return j.broken
+	}
+	j.file = f
+	j.records = 0
+	j.offset = 0
+	j.dirty = false
+	j.broken = nil
+	return nil
+}
+
+func writeFile(name string, entries []entry) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(entries)
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Close flushes the log and closes it.
+func (j *Journal) Close() error {
+	if j.done != nil {
+		close(j.done)
+		<-j.closed
+		j.done = nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return j.broken
+	}
+	j.dirty = true
+	err := j.sync()
+	err = errors.Join(err, j.file.Close())
+	j.file = nil
+	return err
+}
+
+// dbJournal writes the changes of a DB to its journal
+type dbJournal[T any] struct {
+	journal *Journal
+	name    string
+	codec   Codec[T]
+}
+
+func (j *dbJournal[T]) entries(changes []Change[T]) ([]entry, error) {
+	entries := make([]entry, 0, len(changes))
+	for _, c := range changes {
+		e := entry{DB: j.name, ID: c.ID, Seq: c.Seq}
+		if c.Op == OpDelete {
+			e.Deleted = true
+		} else {
+			data, err := j.codec.Encode(c.After)
+			if err != nil {
+				return nil, fmt.Errorf("encoding %s %s: %w", j.name, c.ID, err)
+			}
+			e.Data = data
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (j *dbJournal[T]) tx(ctx context.Context) *journalTx {
+	tx, _ := uow.Enlist(ctx, j.journal, func() *journalTx {
+		return &journalTx{journal: j.journal}
+	})
+	return tx
+}
+
+// journalTx collects the entries of the DBs changed in a unit of work, and writes them as one record,
+// after they all prepared and before any applies its changes.
+type journalTx struct {
+	journal *Journal
+	entries []entry
+}
+
+func (t *journalTx) Lock()   {}
+func (t *journalTx) Unlock() {}
+
+func (t *journalTx) Prepare() error {
+	return nil
+}
+
+func (t *journalTx) Write() error {
+	if len(t.entries) == 0 {
+		return nil
+	}
+	return t.journal.write(t.entries)
+}
+
+func (t *journalTx) Commit() error {
+	return nil
+}
+
+func (t *journalTx) Rollback() {}
@@ -0,0 +1,326 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+type item struct {
+	Name string `json:"name"`
+}
+
+func openItems(t *testing.T, dir string, cfg FileConfig, names ...string) (*Journal, []*DB[item]) {
+	t.Helper()
+
+	j, err := OpenJournal(dir, cfg)
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	t.Cleanup(func() { j.Close() })
+
+	dbs := make([]*DB[item], 0, len(names))
+	for _, name := range names {
+		db, err := NewFileDB(j, name, jsonCodec[item]{})
+		if err != nil {
+			t.Fatalf("NewFileDB(%s) error = %v", name, err)
+		}
+		dbs = append(dbs, db)
+	}
+	return j, dbs
+}
+
+func itemNames(db *DB[item]) []string {
+	var names []string
+	for _, it := range db.ListAll(context.Background()) {
+		names = append(names, it.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// record returns a log record creating the item in the items DB
+func record(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := json.Marshal(item{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := json.Marshal([]entry{{DB: "items", ID: uuid.New(), Data: data}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(line) + "\n"
+}
+
+func appendLog(t *testing.T, dir, tail string) {
+	t.Helper()
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(tail)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalRecovery(t *testing.T) {
+	tests := []struct {
+		name          string
+		snapshotEvery int
+		// tail is appended to the log once the journal is closed, as if left by a crash
+		tail    func(t *testing.T) string
+		wantErr bool
+		want    []string
+	}{
+		{
+			name: "clean log",
+			want: []string{"a", "c", "d"},
+		},
+		{
+			name:          "compacted into a snapshot",
+			snapshotEvery: 2,
+			want:          []string{"a", "c", "d"},
+		},
+		{
+			name: "complete record after the writes",
+			tail: func(t *testing.T) string { return record(t, "e") },
+			want: []string{"a", "c", "d", "e"},
+		},
+		{
+			name: "unterminated last record",
+			tail: func(t *testing.T) string {
+				r := record(t, "e")
+				return r[:len(r)-1]
+			},
+			want: []string{"a", "c", "d"},
+		},
+		{
+			name: "last record cut in the middle",
+			tail: func(t *testing.T) string {
+				r := record(t, "e")
+				return r[:len(r)/2]
+			},
+			want: []string{"a", "c", "d"},
+		},
+		{
+			name: "garbled last record",
+			tail: func(*testing.T) string { return "garbage\n" },
+			want: []string{"a", "c", "d"},
+		},
+		{
+			name:          "torn record after a snapshot",
+			snapshotEvery: 2,
+			tail: func(t *testing.T) string {
+				r := record(t, "e")
+				return r[:len(r)/2]
+			},
+			want: []string{"a", "c", "d"},
+		},
+		{
+			name:    "garbled record before the last",
+			tail:    func(t *testing.T) string { return "garbage\n" + record(t, "e") },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			cfg := FileConfig{SnapshotEvery: tt.snapshotEvery}
+
+			j, dbs := openItems(t, dir, cfg, "items")
+			ids := map[string]uuid.UUID{}
+			for _, name := range []string{"a", "b", "c", "d"} {
+				ids[name] = uuid.New()
+				err := dbs[0].Create(ctx, ids[name], item{Name: name})
+				if err != nil {
+					t.Fatalf("Create(%s) error = %v", name, err)
+				}
+			}
+			err := dbs[0].Delete(ctx, ids["b"])
+			if err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			err = j.Close()
+			if err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if tt.tail != nil {
+				appendLog(t, dir, tt.tail(t))
+			}
+
+			j, err = OpenJournal(dir, cfg)
+			if tt.wantErr {
+				if err == nil {
+					j.Close()
+					t.Fatal("OpenJournal() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenJournal() error = %v", err)
+			}
+			t.Cleanup(func() { j.Close() })
+			db, err := NewFileDB(j, "items", jsonCodec[item]{})
+			if err != nil {
+				t.Fatalf("NewFileDB() error = %v", err)
+			}
+			if got := itemNames(db); !slices.Equal(got, tt.want) {
+				t.Errorf("recovered = %v, want %v", got, tt.want)
+			}
+
+			// the log accepts new writes after the recovery
+			err = db.Create(ctx, uuid.New(), item{Name: "z"})
+			if err != nil {
+				t.Fatalf("Create() after recovery error = %v", err)
+			}
+		})
+	}
+}
+
+func TestJournalUnitOfWorkRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		// cut is the number of bytes cut from the end of the log, as if the write was torn by a crash
+		cut  int
+		want map[string][]string
+	}{
+		{name: "complete", want: map[string][]string{"orders": {"o"}, "products": {"p"}}},
+		{name: "torn", cut: 1, want: map[string][]string{"orders": nil, "products": nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			names := slices.Sorted(maps.Keys(tt.want))
+
+			j, dbs := openItems(t, dir, FileConfig{}, names...)
+			err := uow.Run(ctx, func(ctx context.Context) error {
+				for i, db := range dbs {
+					err := db.Create(ctx, uuid.New(), item{Name: names[i][:1]})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			err = j.Close()
+			if err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			log := filepath.Join(dir, logFile)
+			info, err := os.Stat(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.Truncate(log, info.Size()-int64(tt.cut))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, dbs = openItems(t, dir, FileConfig{}, names...)
+			for i, db := range dbs {
+				if got := itemNames(db); !slices.Equal(got, tt.want[names[i]]) {
+					t.Errorf("recovered %s = %v, want %v", names[i], got, tt.want[names[i]])
+				}
+			}
+		})
+	}
+}
+
+// faultyFile fails the first syncs, and every truncation if truncateErr is set
+type faultyFile struct {
+	walFile
+	syncFailures int
+	truncateErr  error
+}
+
+func (f *faultyFile) Sync() error {
+	if f.syncFailures > 0 {
+		f.syncFailures--
+		return errors.New("sync failed")
+	}
+	return f.walFile.Sync()
+}
+
+func (f *faultyFile) Truncate(size int64) error {
+	if f.truncateErr != nil {
+		return f.truncateErr
+	}
+	return f.walFile.Truncate(size)
+}
+
+func TestJournalFailedSync(t *testing.T) {
+	tests := []struct {
+		name        string
+		truncateErr error
+		// wantBroken tells if the writes after the failed one fail too
+		wantBroken bool
+		// wantRecovered is checked after reopening, if the journal is not broken
+		wantRecovered []string
+	}{
+		{name: "record truncated", wantRecovered: []string{"a", "c"}},
+		{name: "record left torn", truncateErr: errors.New("truncate failed"), wantBroken: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			cfg := FileConfig{Sync: SyncAlways}
+			j, dbs := openItems(t, dir, cfg, "items")
+			err := dbs[0].Create(ctx, uuid.New(), item{Name: "a"})
+			if err != nil {
+				t.Fatalf("Create(a) error = %v", err)
+			}
+
+			j.mu.Lock()
+			j.file = &faultyFile{walFile: j.file, syncFailures: 1, truncateErr: tt.truncateErr}
+			j.mu.Unlock()
+
+			err = dbs[0].Create(ctx, uuid.New(), item{Name: "b"})
+			if err == nil {
+				t.Fatal("Create(b) with a failed sync error = nil, want an error")
+			}
+			if got := itemNames(dbs[0]); !slices.Equal(got, []string{"a"}) {
+				t.Errorf("items after the failed sync = %v, want [a]", got)
+			}
+
+			err = dbs[0].Create(ctx, uuid.New(), item{Name: "c"})
+			if (err != nil) != tt.wantBroken {
+				t.Fatalf("Create(c) error = %v, want error %v", err, tt.wantBroken)
+			}
+			if tt.wantBroken {
+				return
+			}
+
+			err = j.Close()
+			if err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			_, dbs = openItems(t, dir, cfg, "items")
+			if got := itemNames(dbs[0]); !slices.Equal(got, tt.wantRecovered) {
+				t.Errorf("recovered = %v, want %v", got, tt.wantRecovered)
+			}
+		})
+	}
+}
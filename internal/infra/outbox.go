@@ -0,0 +1,138 @@
+package infra
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/outbox"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+// FileOutbox is an outbox kept in a DB backed by a journal, written in the same record as the aggregates.
+// Dispatched records are discarded since nothing reads them afterwards.
+type FileOutbox struct {
+	db       *DB[outboxRecord]
+	registry *eventbus.Registry
+
+	mu sync.Mutex
+	// dispatched is the highest sequence number dispatched, since the records are discarded
+	dispatched uint64
+}
+
+type outboxRecord struct {
+	ID        uuid.UUID         `json:"id"`
+	Seq       uint64            `json:"seq"`
+	Kind      string            `json:"kind"`
+	Payload   json.RawMessage   `json:"payload"`
+	Metadata  eventbus.Metadata `json:"metadata"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+func NewFileOutbox(j *Journal, registry *eventbus.Registry) (*FileOutbox, error) {
+	// the records are numbered when they are committed, so that the relay reads them in that order
+	db, err := NewFileDB(j, "outbox", jsonCodec[outboxRecord]{}, WithSequence(
+		func(r outboxRecord) uint64 { return r.Seq },
+		func(r outboxRecord, seq uint64) outboxRecord {
+			r.Seq = seq
+			return r
+		},
+	))
+	if err != nil {
+		return nil, fmt.Errorf("opening outbox db: %w", err)
+	}
+
+	return &FileOutbox{
+		db:       db,
+		registry: registry,
+	}, nil
+}
+
+func (o *FileOutbox) Add(ctx context.Context, envs ...eventbus.Envelope) error {
+	now := time.Now().UTC()
+	return uow.Run(ctx, func(ctx context.Context) error {
+		for _, env := range envs {
+			payload, err := o.registry.Encode(env.Message)
+			if err != nil {
+				return err
+			}
+
+			err = o.db.Create(ctx, env.EventID, outboxRecord{
+				ID:        env.EventID,
+				Kind:      env.Message.Kind(),
+				Payload:   payload,
+				Metadata:  env.Metadata,
+				CreatedAt: now,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (o *FileOutbox) Pending(ctx context.Context, limit int) ([]outbox.Record, error) {
+	pending := o.db.ListAll(ctx)
+	slices.SortFunc(pending, func(a, b outboxRecord) int { return cmp.Compare(a.Seq, b.Seq) })
+	pending = pending[:min(limit, len(pending))]
+
+	records := make([]outbox.Record, 0, len(pending))
+	for _, r := range pending {
+		m, err := o.registry.Decode(r.Kind, r.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("outbox record %s: %w", r.ID, err)
+		}
+		records = append(records, outbox.Record{
+			ID:        r.ID,
+			Seq:       r.Seq,
+			Envelope:  eventbus.Envelope{Metadata: r.Metadata, Message: m},
+			CreatedAt: r.CreatedAt,
+		})
+	}
+	return records, nil
+}
+
+func (o *FileOutbox) MarkDispatched(ctx context.Context, ids ...uuid.UUID) error {
+	var last uint64
+	err := uow.Run(ctx, func(ctx context.Context) error {
+		for _, id := range ids {
+			r, err := o.db.GetByID(ctx, id)
+			if err != nil {
+				continue
+			}
+			last = max(last, r.Seq)
+			err = o.db.Delete(ctx, id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.dispatched = max(o.dispatched, last)
+	return nil
+}
+
+func (o *FileOutbox) LastSeq(ctx context.Context) (uint64, error) {
+	o.mu.Lock()
+	last := o.dispatched
+	o.mu.Unlock()
+
+	for _, r := range o.db.ListAll(ctx) {
+		last = max(last, r.Seq)
+	}
+	return last, nil
+}
@@ -0,0 +1,95 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/saga"
+)
+
+const sagaIndex = "saga"
+
+// FileSagaStore keeps the state of the sagas in a DB backed by a journal, written in the same record as the aggregates.
+type FileSagaStore struct {
+	db *DB[saga.State]
+}
+
+func NewFileSagaStore(j *Journal) (*FileSagaStore, error) {
+	db, err := NewFileDB(j, "sagas", jsonCodec[saga.State]{},
+		WithClone(cloneSagaState),
+		WithVersioning(
+			func(st saga.State) int { return st.Version },
+			func(st saga.State, version int) saga.State {
+				st.Version = version
+				return st
+			},
+		),
+		WithIndex(sagaIndex, func(st saga.State) string { return st.Saga }),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("opening sagas db: %w", err)
+	}
+
+	return &FileSagaStore{db: db}, nil
+}
+
+func (s *FileSagaStore) Get(ctx context.Context, name, id string) (saga.State, error) {
+	st, err := s.db.GetByID(ctx, keyID("saga", name+"/"+id))
+	if errors.Is(err, ErrDoesNotExist) {
+		return saga.State{}, fmt.Errorf("%s %s: %w", name, id, saga.ErrNotFound)
+	}
+	if err != nil {
+		return saga.State{}, err
+	}
+	return cloneSagaState(st), nil
+}
+
+func (s *FileSagaStore) Save(ctx context.Context, st saga.State) error {
+	id := keyID("saga", st.Saga+"/"+st.ID)
+	st = cloneSagaState(st)
+	st.UpdatedAt = time.Now().UTC()
+
+	if st.Version == 0 {
+		st.Version = 1
+		err := s.db.Create(ctx, id, st)
+		if errors.Is(err, ErrUniquenessViolation) {
+			return fmt.Errorf("%s %s: %w", st.Saga, st.ID, saga.ErrConflict)
+		}
+		return err
+	}
+
+	err := s.db.Update(ctx, id, func(stored saga.State) (saga.State, error) {
+		if stored.Version != st.Version {
+			return saga.State{}, fmt.Errorf("%s %s: %w", st.Saga, st.ID, saga.ErrConflict)
+		}
+		return st, nil
+	})
+	if errors.Is(err, ErrDoesNotExist) {
+		return fmt.Errorf("%s %s: %w", st.Saga, st.ID, saga.ErrConflict)
+	}
+	return err
+}
+
+func (s *FileSagaStore) Expired(ctx context.Context, name string, now time.Time) ([]saga.State, error) {
+	states, err := s.db.FindBy(ctx, sagaIndex, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []saga.State
+	for _, st := range states {
+		if st.Status == saga.StatusRunning && !st.Deadline.IsZero() && !st.Deadline.After(now) {
+			expired = append(expired, cloneSagaState(st))
+		}
+	}
+	return expired, nil
+}
+
+func cloneSagaState(st saga.State) saga.State {
+	st.Data = slices.Clone(st.Data)
+	st.Compensations = slices.Clone(st.Compensations)
+	return st
+}
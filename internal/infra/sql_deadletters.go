@@ -0,0 +1,116 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+var deadLetterMigrations = []Migration{
+	{
+		Version: 1,
+		SQL: `CREATE TABLE dead_letters (
+			id TEXT PRIMARY KEY,
+			handler TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			metadata TEXT NOT NULL,
+			error TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			failed_at TIMESTAMP NOT NULL
+		);`,
+	},
+}
+
+// SQLDeadLetters keeps the dead letters of the event bus in a SQL table.
+type SQLDeadLetters struct {
+	db       *sql.DB
+	registry *eventbus.Registry
+}
+
+func NewSQLDeadLetters(ctx context.Context, db *sql.DB, registry *eventbus.Registry) (*SQLDeadLetters, error) {
+	err := Migrate(ctx, db, "dead-letters", deadLetterMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLDeadLetters{
+		db:       db,
+		registry: registry,
+	}, nil
+}
+
+func (s *SQLDeadLetters) Add(ctx context.Context, dl eventbus.DeadLetter) error {
+	payload, err := s.registry.Encode(dl.Message)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(dl.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, "INSERT INTO dead_letters (id, handler, kind, payload, metadata, error, attempts, failed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		dl.ID, dl.Handler, dl.Message.Kind(), payload, string(metadata), dl.Error, dl.Attempts, dl.FailedAt.UTC())
+	return SQLError(err)
+}
+
+func (s *SQLDeadLetters) List(ctx context.Context) ([]eventbus.DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, handler, kind, payload, metadata, error, attempts, failed_at FROM dead_letters ORDER BY failed_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []eventbus.DeadLetter
+	for rows.Next() {
+		dl, err := s.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, dl)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLDeadLetters) Get(ctx context.Context, id uuid.UUID) (eventbus.DeadLetter, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT id, handler, kind, payload, metadata, error, attempts, failed_at FROM dead_letters WHERE id = ?", id)
+	dl, err := s.scan(row)
+	if errors.Is(err, ErrDoesNotExist) {
+		return eventbus.DeadLetter{}, eventbus.ErrDeadLetterNotFound
+	}
+	return dl, err
+}
+
+func (s *SQLDeadLetters) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM dead_letters WHERE id = ?", id)
+	return err
+}
+
+func (s *SQLDeadLetters) scan(row interface{ Scan(...any) error }) (eventbus.DeadLetter, error) {
+	var (
+		dl       eventbus.DeadLetter
+		kind     string
+		payload  []byte
+		metadata string
+	)
+	err := row.Scan(&dl.ID, &dl.Handler, &kind, &payload, &metadata, &dl.Error, &dl.Attempts, &dl.FailedAt)
+	if err != nil {
+		return eventbus.DeadLetter{}, SQLError(err)
+	}
+
+	dl.Message, err = s.registry.Decode(kind, payload)
+	if err != nil {
+		return eventbus.DeadLetter{}, fmt.Errorf("dead letter %s: %w", dl.ID, err)
+	}
+	err = json.Unmarshal([]byte(metadata), &dl.Metadata)
+	if err != nil {
+		return eventbus.DeadLetter{}, fmt.Errorf("dead letter %s metadata: %w", dl.ID, err)
+	}
+	return dl, nil
+}
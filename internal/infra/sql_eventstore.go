@@ -0,0 +1,195 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/eventstore"
+)
+
+var eventStoreMigrations = []Migration{
+	{
+		Version: 1,
+		SQL: `CREATE TABLE events (
+			stream_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			at TIMESTAMP NOT NULL,
+			PRIMARY KEY (stream_id, version)
+		);
+		CREATE TABLE snapshots (
+			stream_id TEXT PRIMARY KEY,
+			version INTEGER NOT NULL,
+			data BLOB NOT NULL
+		);`,
+	},
+	{
+		Version: 2,
+		// the metadata of the envelopes, as JSON, that the events appended before do not have
+		SQL: `ALTER TABLE events ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';`,
+	},
+}
+
+// SQLEventStore is an event store kept in SQL tables, written in the same transaction as the outbox.
+type SQLEventStore struct {
+	db       *sql.DB
+	registry *eventbus.Registry
+}
+
+func NewSQLEventStore(ctx context.Context, db *sql.DB, registry *eventbus.Registry) (*SQLEventStore, error) {
+	err := Migrate(ctx, db, "events", eventStoreMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLEventStore{
+		db:       db,
+		registry: registry,
+	}, nil
+}
+
+func (s *SQLEventStore) Append(ctx context.Context, stream uuid.UUID, expected int, envs ...eventbus.Envelope) error {
+	if len(envs) == 0 {
+		return nil
+	}
+
+	return InTx(ctx, s.db, func(tx *sql.Tx) error {
+		var version int
+		err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM events WHERE stream_id = ?", stream).Scan(&version)
+		if err != nil {
+			return err
+		}
+		if version != expected {
+			return fmt.Errorf("stream %s is at version %d, expected %d: %w", stream, version, expected, eventstore.ErrConflict)
+		}
+
+		for i, env := range envs {
+			payload, err := s.registry.Encode(env.Message)
+			if err != nil {
+				return err
+			}
+			// the aggregate and the time are in their own columns
+			metadata, err := json.Marshal(eventMetadata{
+				EventID:       env.EventID,
+				CorrelationID: env.CorrelationID,
+				CausationID:   env.CausationID,
+				SchemaVersion: env.SchemaVersion,
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO events (stream_id, version, kind, payload, metadata, at) VALUES (?, ?, ?, ?, ?, ?)",
+				stream, expected+i+1, env.Message.Kind(), payload, string(metadata), env.OccurredAt.UTC())
+			if err = SQLError(err); errors.Is(err, ErrUniquenessViolation) {
+				return fmt.Errorf("stream %s: %w", stream, eventstore.ErrConflict)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLEventStore) Load(ctx context.Context, stream uuid.UUID, from int) ([]eventbus.Envelope, error) {
+	var envs []eventbus.Envelope
+	err := InTx(ctx, s.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT version, kind, payload, metadata, at FROM events WHERE stream_id = ? AND version > ? ORDER BY version", stream, from)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				env      = eventbus.Envelope{Metadata: eventbus.Metadata{AggregateID: stream}}
+				kind     string
+				payload  []byte
+				metadata []byte
+				md       eventMetadata
+			)
+			err = rows.Scan(&env.AggregateVersion, &kind, &payload, &metadata, &env.OccurredAt)
+			if err != nil {
+				return err
+			}
+
+			env.Message, err = s.registry.Decode(kind, payload)
+			if err != nil {
+				return fmt.Errorf("event %d of stream %s: %w", env.AggregateVersion, stream, err)
+			}
+			err = json.Unmarshal(metadata, &md)
+			if err != nil {
+				return fmt.Errorf("event %d of stream %s metadata: %w", env.AggregateVersion, stream, err)
+			}
+			env.EventID = md.EventID
+			if env.EventID == uuid.Nil {
+				// appended before the envelopes, it is given an ID derived from its position
+				env.EventID = uuid.NewSHA1(stream, []byte(strconv.Itoa(env.AggregateVersion)))
+			}
+			env.CorrelationID = md.CorrelationID
+			env.CausationID = md.CausationID
+			env.SchemaVersion = max(md.SchemaVersion, 1)
+			envs = append(envs, env)
+		}
+		return rows.Err()
+	})
+	return envs, err
+}
+
+// eventMetadata is the metadata of an envelope that is not in the columns of the events table
+type eventMetadata struct {
+	EventID       uuid.UUID `json:"eventId"`
+	CorrelationID string    `json:"correlationId,omitempty"`
+	CausationID   string    `json:"causationId,omitempty"`
+	SchemaVersion int       `json:"schemaVersion,omitempty"`
+}
+
+func (s *SQLEventStore) Streams(ctx context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := InTx(ctx, s.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT DISTINCT stream_id FROM events")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id uuid.UUID
+			err = rows.Scan(&id)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	return ids, err
+}
+
+func (s *SQLEventStore) SaveSnapshot(ctx context.Context, snap eventstore.Snapshot) error {
+	return InTx(ctx, s.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO snapshots (stream_id, version, data) VALUES (?, ?, ?)
+			ON CONFLICT (stream_id) DO UPDATE SET version = excluded.version, data = excluded.data`,
+			snap.StreamID, snap.Version, snap.Data)
+		return err
+	})
+}
+
+func (s *SQLEventStore) LoadSnapshot(ctx context.Context, stream uuid.UUID) (eventstore.Snapshot, error) {
+	snap := eventstore.Snapshot{StreamID: stream}
+	err := InTx(ctx, s.db, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, "SELECT version, data FROM snapshots WHERE stream_id = ?", stream).Scan(&snap.Version, &snap.Data)
+	})
+	if errors.Is(err, ErrDoesNotExist) {
+		return eventstore.Snapshot{}, fmt.Errorf("stream %s: %w", stream, eventstore.ErrNoSnapshot)
+	}
+	return snap, err
+}
@@ -0,0 +1,53 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+var idempotencyMigrations = []Migration{
+	{
+		Version: 1,
+		SQL: `CREATE TABLE idempotency_keys (
+			key TEXT PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL
+		)`,
+	},
+}
+
+// SQLIdempotency is an idempotency store kept in a SQL table, written in the same transaction as the aggregates.
+type SQLIdempotency struct {
+	db *sql.DB
+}
+
+func NewSQLIdempotency(ctx context.Context, db *sql.DB) (*SQLIdempotency, error) {
+	err := Migrate(ctx, db, "idempotency", idempotencyMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLIdempotency{db: db}, nil
+}
+
+func (s *SQLIdempotency) Claim(ctx context.Context, key string) (bool, error) {
+	var claimed bool
+	err := InTx(ctx, s.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "INSERT INTO idempotency_keys (key, created_at) VALUES (?, ?) ON CONFLICT DO NOTHING", key, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		claimed = n == 1
+		return err
+	})
+	return claimed, err
+}
+
+func (s *SQLIdempotency) Contains(ctx context.Context, key string) (bool, error) {
+	var found bool
+	err := InTx(ctx, s.db, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM idempotency_keys WHERE key = ?)", key).Scan(&found)
+	})
+	return found, err
+}
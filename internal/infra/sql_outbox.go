@@ -0,0 +1,136 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/outbox"
+)
+
+var outboxMigrations = []Migration{
+	{
+		Version: 1,
+		SQL: `CREATE TABLE outbox (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			id TEXT NOT NULL UNIQUE,
+			kind TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			dispatched_at TIMESTAMP
+		);
+		CREATE INDEX outbox_pending ON outbox (dispatched_at, seq);`,
+	},
+	{
+		Version: 2,
+		// the metadata of the envelopes, as JSON, of which the records added before have only the ID and the creation time
+		SQL: `ALTER TABLE outbox ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';`,
+	},
+}
+
+// SQLOutbox is an outbox kept in a SQL table, written in the same transaction as the aggregates.
+type SQLOutbox struct {
+	db       *sql.DB
+	registry *eventbus.Registry
+}
+
+func NewSQLOutbox(ctx context.Context, db *sql.DB, registry *eventbus.Registry) (*SQLOutbox, error) {
+	err := Migrate(ctx, db, "outbox", outboxMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLOutbox{
+		db:       db,
+		registry: registry,
+	}, nil
+}
+
+func (o *SQLOutbox) Add(ctx context.Context, envs ...eventbus.Envelope) error {
+	return InTx(ctx, o.db, func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		for _, env := range envs {
+			payload, err := o.registry.Encode(env.Message)
+			if err != nil {
+				return err
+			}
+			metadata, err := json.Marshal(env.Metadata)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO outbox (id, kind, payload, metadata, created_at) VALUES (?, ?, ?, ?, ?)",
+				env.EventID, env.Message.Kind(), payload, string(metadata), now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (o *SQLOutbox) Pending(ctx context.Context, limit int) ([]outbox.Record, error) {
+	rows, err := o.db.QueryContext(ctx, "SELECT seq, id, kind, payload, metadata, created_at FROM outbox WHERE dispatched_at IS NULL ORDER BY seq LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []outbox.Record
+	for rows.Next() {
+		var (
+			r        outbox.Record
+			kind     string
+			payload  []byte
+			metadata []byte
+		)
+		err = rows.Scan(&r.Seq, &r.ID, &kind, &payload, &metadata, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Envelope.Message, err = o.registry.Decode(kind, payload)
+		if err != nil {
+			return nil, fmt.Errorf("outbox record %s: %w", r.ID, err)
+		}
+		err = json.Unmarshal(metadata, &r.Envelope.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("outbox record %s metadata: %w", r.ID, err)
+		}
+		if r.Envelope.EventID == uuid.Nil {
+			// added before the envelopes
+			r.Envelope.EventID = r.ID
+			r.Envelope.OccurredAt = r.CreatedAt
+			r.Envelope.CorrelationID = r.ID.String()
+			r.Envelope.SchemaVersion = 1
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func (o *SQLOutbox) MarkDispatched(ctx context.Context, ids ...uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := []any{time.Now().UTC()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	_, err := o.db.ExecContext(ctx, "UPDATE outbox SET dispatched_at = ? WHERE id IN ("+placeholders+")", args...)
+	return err
+}
+
+func (o *SQLOutbox) LastSeq(ctx context.Context) (uint64, error) {
+	var seq uint64
+	err := o.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(seq), 0) FROM outbox").Scan(&seq)
+	return seq, err
+}
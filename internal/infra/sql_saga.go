@@ -0,0 +1,144 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/saga"
+)
+
+var sagaMigrations = []Migration{
+	{
+		Version: 1,
+		SQL: `CREATE TABLE sagas (
+			saga TEXT NOT NULL,
+			id TEXT NOT NULL,
+			step TEXT NOT NULL,
+			status TEXT NOT NULL,
+			data BLOB NOT NULL,
+			deadline TIMESTAMP,
+			compensations TEXT NOT NULL,
+			error TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (saga, id)
+		);
+		CREATE INDEX sagas_deadline ON sagas (saga, status, deadline);`,
+	},
+}
+
+// SQLSagaStore keeps the state of the sagas in a SQL table, written in the same transaction as the aggregates.
+type SQLSagaStore struct {
+	db *sql.DB
+}
+
+func NewSQLSagaStore(ctx context.Context, db *sql.DB) (*SQLSagaStore, error) {
+	err := Migrate(ctx, db, "sagas", sagaMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLSagaStore{db: db}, nil
+}
+
+func (s *SQLSagaStore) Get(ctx context.Context, name, id string) (saga.State, error) {
+	var st saga.State
+	err := InTx(ctx, s.db, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, "SELECT saga, id, step, status, data, deadline, compensations, error, version, updated_at FROM sagas WHERE saga = ? AND id = ?", name, id)
+		var err error
+		st, err = scanSaga(row)
+		return err
+	})
+	if errors.Is(err, ErrDoesNotExist) {
+		return saga.State{}, fmt.Errorf("%s %s: %w", name, id, saga.ErrNotFound)
+	}
+	return st, err
+}
+
+func (s *SQLSagaStore) Save(ctx context.Context, st saga.State) error {
+	compensations, err := json.Marshal(st.Compensations)
+	if err != nil {
+		return err
+	}
+	var deadline *time.Time
+	if !st.Deadline.IsZero() {
+		deadline = &st.Deadline
+	}
+
+	return InTx(ctx, s.db, func(tx *sql.Tx) error {
+		if st.Version == 0 {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO sagas (saga, id, step, status, data, deadline, compensations, error, version, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?)",
+				st.Saga, st.ID, st.Step, st.Status, []byte(st.Data), deadline, string(compensations), st.Error, st.UpdatedAt,
+			)
+			if errors.Is(SQLError(err), ErrUniquenessViolation) {
+				return fmt.Errorf("%s %s: %w", st.Saga, st.ID, saga.ErrConflict)
+			}
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx,
+			"UPDATE sagas SET step = ?, status = ?, data = ?, deadline = ?, compensations = ?, error = ?, version = version + 1, updated_at = ? WHERE saga = ? AND id = ? AND version = ?",
+			st.Step, st.Status, []byte(st.Data), deadline, string(compensations), st.Error, st.UpdatedAt, st.Saga, st.ID, st.Version,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%s %s: %w", st.Saga, st.ID, saga.ErrConflict)
+		}
+		return nil
+	})
+}
+
+func (s *SQLSagaStore) Expired(ctx context.Context, name string, now time.Time) ([]saga.State, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT saga, id, step, status, data, deadline, compensations, error, version, updated_at FROM sagas WHERE saga = ? AND status = ? AND deadline IS NOT NULL AND deadline <= ?",
+		name, saga.StatusRunning, now.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []saga.State
+	for rows.Next() {
+		st, err := scanSaga(rows)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, st)
+	}
+	return expired, rows.Err()
+}
+
+func scanSaga(row interface{ Scan(...any) error }) (saga.State, error) {
+	var (
+		st            saga.State
+		data          []byte
+		deadline      sql.NullTime
+		compensations string
+	)
+	err := row.Scan(&st.Saga, &st.ID, &st.Step, &st.Status, &data, &deadline, &compensations, &st.Error, &st.Version, &st.UpdatedAt)
+	if err != nil {
+		return saga.State{}, SQLError(err)
+	}
+
+	st.Data = data
+	if deadline.Valid {
+		st.Deadline = deadline.Time
+	}
+	err = json.Unmarshal([]byte(compensations), &st.Compensations)
+	if err != nil {
+		return saga.State{}, fmt.Errorf("decoding compensations of %s %s: %w", st.Saga, st.ID, err)
+	}
+	return st, nil
+}
@@ -0,0 +1,163 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// OpenSQLite opens the SQLite database file at path, creating it if needed.
+func OpenSQLite(path string) (*sql.DB, error) {
+	// immediate transactions take the write lock upfront, so that a read-modify-write does not fail half way with SQLITE_BUSY
+	dsn := fmt.Sprintf("file:%s?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening sqlite '%s': %w", path, err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to sqlite '%s': %w", path, err)
+	}
+	return db, nil
+}
+
+// Migration is a schema change, applied only once.
+type Migration struct {
+	Version int
+	SQL     string
+}
+
+// Migrate applies, in order, the migrations of the component that were not applied yet.
+func Migrate(ctx context.Context, db *sql.DB, component string, migrations []Migration) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		component TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		PRIMARY KEY (component, version)
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating migrations table: %w", err)
+	}
+
+	for _, m := range migrations {
+		err := InTx(ctx, db, func(tx *sql.Tx) error {
+			var applied int
+			err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE component = ? AND version = ?", component, m.Version).Scan(&applied)
+			if err != nil || applied > 0 {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, m.SQL)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (component, version) VALUES (?, ?)", component, m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("applying migration %d of %s: %w", m.Version, component, err)
+		}
+	}
+
+	return nil
+}
+
+// InTx calls fn with the transaction of the unit of work carried by the context, beginning it if needed,
+// so that it is committed or rolled back with the unit of work.
+// Without a unit of work, fn runs in its own transaction.
+func InTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	var beginErr error
+	p, ok := uow.Enlist(ctx, db, func() *sqlTx {
+		tx, err := db.BeginTx(ctx, nil)
+		beginErr = err
+		return &sqlTx{tx: tx}
+	})
+	if beginErr != nil {
+		return fmt.Errorf("beginning transaction: %w", beginErr)
+	}
+	if ok {
+		if p.tx == nil {
+			return errors.New("unit of work transaction failed to begin")
+		}
+		return SQLError(fn(p.tx))
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return SQLError(err)
+	}
+	return SQLError(tx.Commit())
+}
+
+// SQLError translates the database errors into the errors of this package,
+// eg: a unique constraint violation into ErrUniquenessViolation
+func SQLError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDoesNotExist
+	}
+
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		switch se.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY, sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+			return fmt.Errorf("%w: %w", ErrUniquenessViolation, err)
+		}
+	}
+	return err
+}
+
+// CheckVersion fails with fails.ErrConcurrencyConflict if the update guarded by a version did not change any row.
+func CheckVersion(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fails.ErrConcurrencyConflict
+	}
+	return nil
+}
+
+// sqlTx enlists a database transaction in a unit of work.
+// SQLite does its own locking, so there is nothing to lock or prepare, and the transaction is committed on Write.
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (t *sqlTx) Lock()   {}
+func (t *sqlTx) Unlock() {}
+
+func (t *sqlTx) Prepare() error {
+	return nil
+}
+
+func (t *sqlTx) Write() error {
+	if t.tx == nil {
+		return nil
+	}
+	return SQLError(t.tx.Commit())
+}
+
+func (t *sqlTx) Commit() error {
+	return nil
+}
+
+func (t *sqlTx) Rollback() {
+	if t.tx != nil {
+		t.tx.Rollback()
+	}
+}
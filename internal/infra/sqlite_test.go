@@ -0,0 +1,134 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+var errRollback = errors.New("rollback")
+
+func openNames(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations := []Migration{{Version: 1, SQL: "CREATE TABLE names (name TEXT PRIMARY KEY)"}}
+	// applying the migrations again is a no-op
+	for range 2 {
+		err = Migrate(context.Background(), db, "test", migrations)
+		if err != nil {
+			t.Fatalf("Migrate() error = %v", err)
+		}
+	}
+	return db
+}
+
+func insertName(ctx context.Context, db *sql.DB, name string) error {
+	return InTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO names (name) VALUES (?)", name)
+		return err
+	})
+}
+
+func countNames(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM names").Scan(&n)
+	if err != nil {
+		t.Fatalf("counting names: %v", err)
+	}
+	return n
+}
+
+func TestInTx(t *testing.T) {
+	tests := []struct {
+		name string
+		// write runs against a table holding the name a
+		write     func(ctx context.Context, db *sql.DB) error
+		wantErr   error
+		wantNames int
+	}{
+		{
+			name: "own transaction",
+			write: func(ctx context.Context, db *sql.DB) error {
+				return insertName(ctx, db, "b")
+			},
+			wantNames: 2,
+		},
+		{
+			name: "duplicate key",
+			write: func(ctx context.Context, db *sql.DB) error {
+				return insertName(ctx, db, "a")
+			},
+			wantErr:   ErrUniquenessViolation,
+			wantNames: 1,
+		},
+		{
+			name: "no rows",
+			write: func(ctx context.Context, db *sql.DB) error {
+				return InTx(ctx, db, func(tx *sql.Tx) error {
+					var name string
+					return tx.QueryRowContext(ctx, "SELECT name FROM names WHERE name = 'z'").Scan(&name)
+				})
+			},
+			wantErr:   ErrDoesNotExist,
+			wantNames: 1,
+		},
+		{
+			name: "unit of work committed",
+			write: func(ctx context.Context, db *sql.DB) error {
+				return uow.Run(ctx, func(ctx context.Context) error {
+					err := insertName(ctx, db, "b")
+					if err != nil {
+						return err
+					}
+					return insertName(ctx, db, "c")
+				})
+			},
+			wantNames: 3,
+		},
+		{
+			name: "unit of work rolled back",
+			write: func(ctx context.Context, db *sql.DB) error {
+				return uow.Run(ctx, func(ctx context.Context) error {
+					err := insertName(ctx, db, "b")
+					if err != nil {
+						return err
+					}
+					return errRollback
+				})
+			},
+			wantErr:   errRollback,
+			wantNames: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openNames(t)
+			err := insertName(ctx, db, "a")
+			if err != nil {
+				t.Fatalf("inserting a: %v", err)
+			}
+
+			err = tt.write(ctx, db)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("write error = %v, want %v", err, tt.wantErr)
+			}
+			if got := countNames(t, db); got != tt.wantNames {
+				t.Errorf("names = %d, want %d", got, tt.wantNames)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package infra
+
+type Backend string
+
+const (
+	// BackendMemory keeps the data only in memory
+	BackendMemory Backend = "memory"
+	// BackendFile keeps the data in memory, backed by write-ahead logs
+	BackendFile Backend = "file"
+	// BackendSQLite keeps the data in a SQLite database file
+	BackendSQLite Backend = "sqlite"
+)
+
+// Storage is where the modules keep their data.
+type Storage struct {
+	// Backend defaults to BackendMemory
+	Backend Backend `yaml:"backend"`
+	// DataDir is where the file and sqlite backends keep their data
+	DataDir string     `yaml:"dataDir"`
+	File    FileConfig `yaml:"file"`
+}
@@ -0,0 +1,202 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrDeadLettered wraps the failure of a handler whose message was moved to the dead letters
+	ErrDeadLettered = errors.New("moved to dead letters")
+)
+
+// DeadLetter is a message that a handler failed to handle after exhausting its retries.
+// The metadata of its envelope is handed again to the handler on redrive.
+type DeadLetter struct {
+	ID       uuid.UUID
+	Handler  string
+	Message  Message
+	Metadata Metadata
+	Error    string
+	Attempts int
+	FailedAt time.Time
+}
+
+type DeadLetterStore interface {
+	Add(ctx context.Context, dl DeadLetter) error
+	List(ctx context.Context) ([]DeadLetter, error)
+	Get(ctx context.Context, id uuid.UUID) (DeadLetter, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// WithDeadLetters sets the store where the messages that exhaust their retries are kept.
+// The handlers must then be registered WithName, since the dead letters refer to them by name.
+func WithDeadLetters(store DeadLetterStore) Option {
+	return func(b *Bus) {
+		b.deadLetters = store
+	}
+}
+
+// call calls the registered handler with the message of the envelope, according to its retry policy,
+// moving the message to the dead letters if it still fails.
+// The failure is returned wrapped in ErrDeadLettered if the message was moved to the dead letters,
+// leaving it to the caller to decide whether it is handled, see DeadLettered.
+func (b *Bus) call(ctx context.Context, r registration, env Envelope) error {
+	m := env.Message
+	attempts, err := r.retry.call(WithMetadata(ctx, env.Metadata), r.handler, m)
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("handler '%s' for message '%s': %w", r.name, m.Kind(), err)
+	if b.deadLetters == nil {
+		return err
+	}
+
+	dlErr := b.deadLetters.Add(ctx, DeadLetter{
+		ID:       uuid.New(),
+		Handler:  r.name,
+		Message:  m,
+		Metadata: env.Metadata,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	})
+	if dlErr != nil {
+		return errors.Join(err, fmt.Errorf("adding dead letter: %w", dlErr))
+	}
+	return deadLetteredError{err: err}
+}
+
+// deadLetteredError is the failure of a handler whose message was moved to the dead letters
+type deadLetteredError struct {
+	err error
+}
+
+func (e deadLetteredError) Error() string {
+	return ErrDeadLettered.Error() + ": " + e.err.Error()
+}
+
+func (e deadLetteredError) Is(target error) bool {
+	return target == ErrDeadLettered
+}
+
+func (e deadLetteredError) Unwrap() error {
+	return e.err
+}
+
+// DeadLettered tells if every failure in err, eg: the ones joined by Publish, was moved to the dead letters,
+// so that the message is left to be redriven from there instead of being published again.
+func DeadLettered(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case deadLetteredError:
+		return true
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		for _, err := range errs {
+			if !DeadLettered(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	case interface{ Unwrap() error }:
+		return DeadLettered(e.Unwrap())
+	}
+	return false
+}
+
+func (b *Bus) ListDeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	if b.deadLetters == nil {
+		return nil, nil
+	}
+	return b.deadLetters.List(ctx)
+}
+
+func (b *Bus) GetDeadLetter(ctx context.Context, id uuid.UUID) (DeadLetter, error) {
+	if b.deadLetters == nil {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return b.deadLetters.Get(ctx, id)
+}
+
+// Redrive removes the dead letter and hands its message again to the handler that failed it.
+// If the handler fails again, the message goes back to the dead letters under a new ID, failing with ErrDeadLettered.
+func (b *Bus) Redrive(ctx context.Context, id uuid.UUID) error {
+	dl, err := b.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers[dl.Message.Kind()]
+	b.mu.RUnlock()
+
+	idx := slices.IndexFunc(handlers, func(r registration) bool {
+		return r.name == dl.Handler
+	})
+	if idx < 0 {
+		return fmt.Errorf("no handler '%s' for message '%s'", dl.Handler, dl.Message.Kind())
+	}
+
+	err = b.deadLetters.Delete(ctx, id)
+	if err != nil {
+		return fmt.Errorf("deleting dead letter: %w", err)
+	}
+
+	return b.call(ctx, handlers[idx], Envelope{Metadata: dl.Metadata, Message: dl.Message})
+}
+
+type MemoryDeadLetters struct {
+	mu      sync.RWMutex
+	letters []DeadLetter
+}
+
+func NewMemoryDeadLetters() *MemoryDeadLetters {
+	return &MemoryDeadLetters{}
+}
+
+func (s *MemoryDeadLetters) Add(_ context.Context, dl DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.letters = append(s.letters, dl)
+	return nil
+}
+
+func (s *MemoryDeadLetters) List(_ context.Context) ([]DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.letters), nil
+}
+
+func (s *MemoryDeadLetters) Get(_ context.Context, id uuid.UUID) (DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, dl := range s.letters {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+	return DeadLetter{}, ErrDeadLetterNotFound
+}
+
+func (s *MemoryDeadLetters) Delete(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.letters = slices.DeleteFunc(s.letters, func(dl DeadLetter) bool {
+		return dl.ID == id
+	})
+	return nil
+}
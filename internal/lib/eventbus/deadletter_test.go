@@ -0,0 +1,197 @@
+package eventbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+var errHandler = errors.New("handler failed")
+
+func TestDeadLetters(t *testing.T) {
+	tests := []struct {
+		name         string
+		deadLetters  bool
+		policy       eventbus.RetryPolicy
+		err          error
+		wantErr      error
+		wantLetters  int
+		wantAttempts int
+		// wantDeadLettered tells if the failure returned by Publish is left to the dead letters
+		wantDeadLettered bool
+	}{
+		{
+			name:        "handled",
+			deadLetters: true,
+			policy:      eventbus.RetryPolicy{MaxAttempts: 3},
+		},
+		{
+			name:             "retries exhausted",
+			deadLetters:      true,
+			policy:           eventbus.RetryPolicy{MaxAttempts: 3},
+			err:              errHandler,
+			wantErr:          eventbus.ErrDeadLettered,
+			wantLetters:      1,
+			wantAttempts:     3,
+			wantDeadLettered: true,
+		},
+		{
+			name:             "permanent error",
+			deadLetters:      true,
+			policy:           eventbus.RetryPolicy{MaxAttempts: 3, Permanent: []error{errHandler}},
+			err:              errHandler,
+			wantErr:          eventbus.ErrDeadLettered,
+			wantLetters:      1,
+			wantAttempts:     1,
+			wantDeadLettered: true,
+		},
+		{
+			name:    "no dead letters",
+			policy:  eventbus.RetryPolicy{MaxAttempts: 2},
+			err:     errHandler,
+			wantErr: errHandler,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var options []eventbus.Option
+			store := eventbus.NewMemoryDeadLetters()
+			if tt.deadLetters {
+				options = append(options, eventbus.WithDeadLetters(store))
+			}
+			bus := eventbus.New(options...)
+			eventbus.Register(bus, func(context.Context, testMessage) error {
+				return tt.err
+			}, eventbus.WithName("test"), eventbus.WithRetry(tt.policy))
+
+			err := bus.Publish(context.Background(), testMessage{N: 1})
+			if !errors.Is(err, tt.wantErr) || !errors.Is(err, tt.err) {
+				t.Errorf("Publish() error = %v, want %v wrapping %v", err, tt.wantErr, tt.err)
+			}
+			if eventbus.DeadLettered(err) != tt.wantDeadLettered {
+				t.Errorf("DeadLettered() = %v, want %v", !tt.wantDeadLettered, tt.wantDeadLettered)
+			}
+
+			letters, err := bus.ListDeadLetters(context.Background())
+			if err != nil {
+				t.Fatalf("ListDeadLetters() error = %v", err)
+			}
+			if len(letters) != tt.wantLetters {
+				t.Fatalf("dead letters = %d, want %d", len(letters), tt.wantLetters)
+			}
+			if tt.wantLetters > 0 {
+				dl := letters[0]
+				if dl.Handler != "test" || dl.Attempts != tt.wantAttempts || dl.Message != (testMessage{N: 1}) {
+					t.Errorf("dead letter = %+v, want handler test, %d attempts and the message", dl, tt.wantAttempts)
+				}
+			}
+		})
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	tests := []struct {
+		name        string
+		failAgain   bool
+		unknown     bool
+		wantErr     error
+		wantLetters int
+	}{
+		{name: "handled", wantLetters: 0},
+		{name: "fails again", failAgain: true, wantErr: eventbus.ErrDeadLettered, wantLetters: 1},
+		{name: "unknown dead letter", unknown: true, wantErr: eventbus.ErrDeadLetterNotFound, wantLetters: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := eventbus.New(eventbus.WithDeadLetters(eventbus.NewMemoryDeadLetters()))
+			fail := true
+			var handled []testMessage
+			eventbus.Register(bus, func(_ context.Context, m testMessage) error {
+				if fail {
+					return errHandler
+				}
+				handled = append(handled, m)
+				return nil
+			}, eventbus.WithName("test"))
+
+			err := bus.Publish(context.Background(), testMessage{N: 1})
+			if !eventbus.DeadLettered(err) {
+				t.Fatalf("Publish() error = %v, want it moved to the dead letters", err)
+			}
+			letters, err := bus.ListDeadLetters(context.Background())
+			if err != nil || len(letters) != 1 {
+				t.Fatalf("ListDeadLetters() = %v, %v, want a single dead letter", letters, err)
+			}
+
+			id := letters[0].ID
+			if tt.unknown {
+				id = uuid.New()
+			}
+			fail = tt.failAgain
+			err = bus.Redrive(context.Background(), id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Redrive() error = %v, want %v", err, tt.wantErr)
+			}
+
+			after, err := bus.ListDeadLetters(context.Background())
+			if err != nil {
+				t.Fatalf("ListDeadLetters() error = %v", err)
+			}
+			if len(after) != tt.wantLetters {
+				t.Fatalf("dead letters after redrive = %d, want %d", len(after), tt.wantLetters)
+			}
+			if tt.failAgain && after[0].ID == letters[0].ID {
+				t.Errorf("dead letter failing again kept its ID %s", letters[0].ID)
+			}
+			if tt.wantErr == nil && (len(handled) != 1 || handled[0] != (testMessage{N: 1})) {
+				t.Errorf("handled = %v, want the redriven message", handled)
+			}
+		})
+	}
+}
+
+func TestDeadLettered(t *testing.T) {
+	bus := eventbus.New(eventbus.WithDeadLetters(eventbus.NewMemoryDeadLetters()))
+	eventbus.Register(bus, func(context.Context, testMessage) error {
+		return errHandler
+	}, eventbus.WithName("test"))
+	dlErr := bus.Publish(context.Background(), testMessage{N: 1})
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no failure"},
+		{name: "not moved", err: errHandler},
+		{name: "moved", err: dlErr, want: true},
+		{name: "wrapped", err: fmt.Errorf("publishing: %w", dlErr), want: true},
+		{name: "all joined moved", err: errors.Join(dlErr, dlErr), want: true},
+		{name: "some joined not moved", err: errors.Join(dlErr, errHandler)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventbus.DeadLettered(tt.err); got != tt.want {
+				t.Errorf("DeadLettered(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterWithoutName(t *testing.T) {
+	bus := eventbus.New(eventbus.WithDeadLetters(eventbus.NewMemoryDeadLetters()))
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering without a name on a bus with dead letters did not panic")
+		}
+	}()
+	eventbus.Register(bus, func(context.Context, testMessage) error { return nil })
+}
@@ -0,0 +1,103 @@
+package eventbus
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Envelope is a message with the metadata of its occurrence.
+type Envelope struct {
+	Metadata
+	Message Message
+}
+
+// Metadata tells when, where and why a message happened.
+type Metadata struct {
+	// EventID identifies the message, eg: to handle it only once
+	EventID    uuid.UUID `json:"eventId"`
+	OccurredAt time.Time `json:"occurredAt"`
+	// AggregateID is the aggregate that emitted the message, if any,
+	// and AggregateVersion its version after the message, zero if unknown
+	AggregateID      uuid.UUID `json:"aggregateId"`
+	AggregateVersion int       `json:"aggregateVersion,omitempty"`
+	// CorrelationID is shared by all the messages that follow from the same request
+	CorrelationID string `json:"correlationId,omitempty"`
+	// CausationID is the ID of the request, or of the message, that caused the message
+	CausationID string `json:"causationId,omitempty"`
+	// SchemaVersion is the version of the shape of the message, see Versioned
+	SchemaVersion int `json:"schemaVersion"`
+}
+
+// Versioned is implemented by the messages whose shape changed, to tell the handlers which version they got.
+// The messages that do not implement it are at version 1.
+type Versioned interface {
+	SchemaVersion() int
+}
+
+func schemaVersion(m Message) int {
+	if v, ok := m.(Versioned); ok {
+		return v.SchemaVersion()
+	}
+	return 1
+}
+
+type causeKey struct{}
+
+type cause struct {
+	correlationID string
+	causationID   string
+}
+
+type metadataKey struct{}
+
+// WithCause returns a context whose messages are caused by causationID, eg: the ID of a request,
+// in the flow of correlationID.
+func WithCause(ctx context.Context, correlationID, causationID string) context.Context {
+	return context.WithValue(ctx, causeKey{}, cause{correlationID: correlationID, causationID: causationID})
+}
+
+// CauseFrom returns the correlation and causation IDs carried by the context, empty if there are none.
+func CauseFrom(ctx context.Context) (correlationID, causationID string) {
+	c, _ := ctx.Value(causeKey{}).(cause)
+	return c.correlationID, c.causationID
+}
+
+// WithMetadata returns a context carrying the metadata of the message being handled,
+// so that the messages emitted by the handler are caused by it, in the same flow.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	ctx = context.WithValue(ctx, metadataKey{}, md)
+	return WithCause(ctx, md.CorrelationID, md.EventID.String())
+}
+
+// MetadataFrom returns the metadata of the message being handled, if the context carries one.
+func MetadataFrom(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(metadataKey{}).(Metadata)
+	return md, ok
+}
+
+// Wrap puts the messages emitted by an aggregate, at a version, in envelopes, with the cause carried by the context.
+// A message without a cause starts a flow of its own, correlated by its ID.
+func Wrap(ctx context.Context, aggregateID uuid.UUID, version int, msgs ...Message) []Envelope {
+	correlationID, causationID := CauseFrom(ctx)
+	now := time.Now().UTC()
+
+	envs := make([]Envelope, 0, len(msgs))
+	for _, m := range msgs {
+		md := Metadata{
+			EventID:          uuid.New(),
+			OccurredAt:       now,
+			AggregateID:      aggregateID,
+			AggregateVersion: version,
+			CorrelationID:    correlationID,
+			CausationID:      causationID,
+			SchemaVersion:    schemaVersion(m),
+		}
+		if md.CorrelationID == "" {
+			md.CorrelationID = md.EventID.String()
+		}
+		envs = append(envs, Envelope{Metadata: md, Message: m})
+	}
+	return envs
+}
@@ -0,0 +1,122 @@
+package eventbus_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+type versionedMessage struct{}
+
+func (versionedMessage) Kind() string {
+	return "Versioned"
+}
+
+func (versionedMessage) SchemaVersion() int {
+	return 2
+}
+
+func TestWrap(t *testing.T) {
+	parent := eventbus.Metadata{EventID: uuid.New(), CorrelationID: "flow"}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		msg  eventbus.Message
+		// wantCorrelation is the expected correlation ID, the ID of the envelope itself if empty
+		wantCorrelation string
+		wantCausation   string
+		wantSchema      int
+	}{
+		{name: "no cause starts a flow", ctx: context.Background(), msg: testMessage{}, wantSchema: 1},
+		{
+			name:            "caused by a request",
+			ctx:             eventbus.WithCause(context.Background(), "flow", "request"),
+			msg:             testMessage{},
+			wantCorrelation: "flow",
+			wantCausation:   "request",
+			wantSchema:      1,
+		},
+		{
+			name:            "caused by the message being handled",
+			ctx:             eventbus.WithMetadata(context.Background(), parent),
+			msg:             testMessage{},
+			wantCorrelation: "flow",
+			wantCausation:   parent.EventID.String(),
+			wantSchema:      1,
+		},
+		{name: "versioned message", ctx: context.Background(), msg: versionedMessage{}, wantSchema: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregate := uuid.New()
+
+			envs := eventbus.Wrap(tt.ctx, aggregate, 3, tt.msg, tt.msg)
+			if len(envs) != 2 {
+				t.Fatalf("Wrap() = %d envelopes, want 2", len(envs))
+			}
+			if envs[0].EventID == envs[1].EventID {
+				t.Error("the envelopes share the same event ID")
+			}
+
+			for _, env := range envs {
+				wantCorrelation := tt.wantCorrelation
+				if wantCorrelation == "" {
+					wantCorrelation = env.EventID.String()
+				}
+				if env.CorrelationID != wantCorrelation {
+					t.Errorf("CorrelationID = %q, want %q", env.CorrelationID, wantCorrelation)
+				}
+				if env.CausationID != tt.wantCausation {
+					t.Errorf("CausationID = %q, want %q", env.CausationID, tt.wantCausation)
+				}
+				if env.SchemaVersion != tt.wantSchema {
+					t.Errorf("SchemaVersion = %d, want %d", env.SchemaVersion, tt.wantSchema)
+				}
+				if env.AggregateID != aggregate || env.AggregateVersion != 3 {
+					t.Errorf("aggregate = %s at %d, want %s at 3", env.AggregateID, env.AggregateVersion, aggregate)
+				}
+				if env.OccurredAt.IsZero() {
+					t.Error("OccurredAt is not set")
+				}
+			}
+		})
+	}
+}
+
+func TestPublishEnvelopesCause(t *testing.T) {
+	ctx := eventbus.WithCause(context.Background(), "flow", "request")
+	bus := eventbus.New()
+	var handled []eventbus.Metadata
+	eventbus.Register(bus, func(ctx context.Context, m testMessage) error {
+		md, ok := eventbus.MetadataFrom(ctx)
+		if !ok {
+			t.Fatal("the context of the handler has no metadata")
+		}
+		handled = append(handled, md)
+		if m.N == 1 {
+			// the message published by the handler is caused by the one it handles
+			return bus.Publish(ctx, testMessage{N: 2})
+		}
+		return nil
+	})
+
+	err := bus.Publish(ctx, testMessage{N: 1})
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if len(handled) != 2 {
+		t.Fatalf("handled %d messages, want 2", len(handled))
+	}
+	first, second := handled[0], handled[1]
+	if first.CorrelationID != "flow" || first.CausationID != "request" {
+		t.Errorf("first message caused by %q in %q, want request in flow", first.CausationID, first.CorrelationID)
+	}
+	if second.CorrelationID != "flow" || second.CausationID != first.EventID.String() {
+		t.Errorf("second message caused by %q in %q, want %s in flow", second.CausationID, second.CorrelationID, first.EventID)
+	}
+}
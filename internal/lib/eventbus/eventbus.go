@@ -2,48 +2,242 @@ package eventbus
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
 )
 
+var ErrClosed = errors.New("event bus is closed")
+
 type Handler[T Message] func(context.Context, T) error
 
 type Message interface {
 	Kind() string
 }
 
+type registration struct {
+	name    string
+	async   bool
+	retry   RetryPolicy
+	handler Handler[Message]
+}
+
+// ErrorHandler is called with the errors of the handlers running in the background,
+// including the failures moved to the dead letters, since there is no caller to return them to.
+type ErrorHandler func(ctx context.Context, handler string, m Message, err error)
+
 type Bus struct {
-	handlers map[string][]Handler[Message]
+	mu       sync.RWMutex
+	closed   bool
+	handlers map[string][]registration
+	queues   map[string]*queue
+	workers  sync.WaitGroup
+	// done is closed on shutdown, releasing the publishers waiting for room in a queue
+	done chan struct{}
+	// sending counts the publishers sending to a queue, that must be gone before the queues are closed
+	sending sync.WaitGroup
+
+	queueSize int
+	poolSize  int
+	overflow  OverflowPolicy
+	onError   ErrorHandler
+	async     bool
+
+	deadLetters DeadLetterStore
+}
+
+type Option func(*Bus)
+
+// WithQueueSize sets the capacity of each per kind queue used by asynchronous handlers. Defaults to 100.
+func WithQueueSize(size int) Option {
+	return func(b *Bus) {
+		b.queueSize = size
+	}
+}
+
+// WithWorkers sets the number of goroutines draining each per kind queue. Defaults to 1.
+func WithWorkers(n int) Option {
+	return func(b *Bus) {
+		b.poolSize = n
+	}
+}
+
+// WithOverflow sets what happens when publishing to a full queue. Defaults to OverflowBlock.
+func WithOverflow(policy OverflowPolicy) Option {
+	return func(b *Bus) {
+		b.overflow = policy
+	}
+}
+
+// WithErrorHandler sets the handler for the errors of asynchronous handlers. Defaults to logging them.
+func WithErrorHandler(fn ErrorHandler) Option {
+	return func(b *Bus) {
+		b.onError = fn
+	}
+}
+
+// WithAsyncHandlers makes every handler run in the background, as if registered with Async.
+func WithAsyncHandlers() Option {
+	return func(b *Bus) {
+		b.async = true
+	}
+}
+
+func New(options ...Option) *Bus {
+	b := &Bus{
+		handlers:  make(map[string][]registration),
+		queues:    make(map[string]*queue),
+		done:      make(chan struct{}),
+		queueSize: 100,
+		poolSize:  1,
+		overflow:  OverflowBlock,
+		onError: func(ctx context.Context, handler string, m Message, err error) {
+			slog.ErrorContext(ctx, "handling message", "handler", handler, "kind", m.Kind(), "error", err)
+		},
+	}
+	for _, o := range options {
+		o(b)
+	}
+	return b
 }
 
-func New() *Bus {
-	return &Bus{
-		handlers: make(map[string][]Handler[Message]),
+type RegisterOption func(*registration)
+
+// WithName sets the name used to identify the handler in errors and in the dead letters.
+// Defaults to the message kind followed by the registration index, eg: OrderCreated#0,
+// which depends on the registration order, so it is required when the bus has dead letters.
+func WithName(name string) RegisterOption {
+	return func(r *registration) {
+		r.name = name
+	}
+}
+
+// Async makes the handler run in the background, drained from the queue of the message kind,
+// instead of inline with Publish.
+func Async() RegisterOption {
+	return func(r *registration) {
+		r.async = true
+	}
+}
+
+// Inline makes the handler run inline with Publish, even if the bus runs the handlers in the background by default,
+// eg: so that a read model is up to date once the message is published.
+func Inline() RegisterOption {
+	return func(r *registration) {
+		r.async = false
 	}
 }
 
-func Register[T Message](bus *Bus, handler func(context.Context, T) error) {
+// Register registers the handler of the messages of type T.
+// It panics if the bus was shut down, or if the bus has dead letters and the handler has no name.
+func Register[T Message](bus *Bus, handler func(context.Context, T) error, options ...RegisterOption) {
 	var zero T
 	kind := zero.Kind()
 
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if bus.closed {
+		panic(fmt.Sprintf("eventbus: registering a handler for %s after shutdown", kind))
+	}
+
 	handlers := bus.handlers[kind]
-	if handlers == nil {
-		handlers = []Handler[Message]{}
+
+	r := registration{
+		async: bus.async,
+		handler: func(ctx context.Context, m Message) error {
+			return handler(ctx, m.(T))
+		},
+	}
+	for _, o := range options {
+		o(&r)
+	}
+	if r.name == "" {
+		if bus.deadLetters != nil {
+			panic(fmt.Sprintf("eventbus: registering a handler for %s without a name, on a bus with dead letters", kind))
+		}
+		r.name = fmt.Sprintf("%s#%d", kind, len(handlers))
 	}
 
-	handlers = append(handlers, func(ctx context.Context, m Message) error {
-		return handler(ctx, m.(T))
-	})
+	if r.async && bus.queues[kind] == nil {
+		bus.queues[kind] = bus.startQueue()
+	}
 
-	bus.handlers[kind] = handlers
+	bus.handlers[kind] = append(handlers, r)
 }
 
+// Publish delivers every message to every handler registered for its kind, see PublishEnvelopes.
+// The messages are put in envelopes with the cause carried by the context, and no aggregate.
 func (b *Bus) Publish(ctx context.Context, msgs ...Message) error {
-	for k := range msgs {
-		handlers := b.handlers[msgs[k].Kind()]
+	return b.PublishEnvelopes(ctx, Wrap(ctx, uuid.Nil, 0, msgs...)...)
+}
+
+// PublishEnvelopes delivers the message of every envelope to every handler registered for its kind,
+// with the metadata of the envelope in the context of the handler, see MetadataFrom.
+// Inline handlers are all called even if some of them fail, and the failures are returned joined together,
+// wrapped in ErrDeadLettered if the message was moved to the dead letters, see DeadLettered.
+// Messages for asynchronous handlers are enqueued and only queueing failures are returned.
+func (b *Bus) PublishEnvelopes(ctx context.Context, envs ...Envelope) error {
+	var errs []error
+	for _, env := range envs {
+		b.mu.RLock()
+		handlers := b.handlers[env.Message.Kind()]
+		b.mu.RUnlock()
+
+		var async []registration
+		for _, r := range handlers {
+			if r.async {
+				async = append(async, r)
+				continue
+			}
 
-		for _, handler := range handlers {
-			return handler(ctx, msgs[k])
+			err := b.call(ctx, r, env)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if len(async) > 0 {
+			err := b.enqueue(ctx, env, async)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("enqueuing message '%s': %w", env.Message.Kind(), err))
+			}
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// Shutdown stops accepting messages for asynchronous handlers and waits for the queued ones to be handled.
+func (b *Bus) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	closing := !b.closed
+	if closing {
+		b.closed = true
+		close(b.done)
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		if closing {
+			// no one sends to the queues once the publishers already sending are gone
+			b.sending.Wait()
+			for _, q := range b.queues {
+				close(q.items)
+			}
+		}
+		b.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("draining event bus queues: %w", ctx.Err())
+	}
 }
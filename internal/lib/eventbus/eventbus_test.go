@@ -0,0 +1,99 @@
+package eventbus_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+type testMessage struct {
+	N int
+}
+
+func (testMessage) Kind() string {
+	return "Test"
+}
+
+type otherMessage struct{}
+
+func (otherMessage) Kind() string {
+	return "Other"
+}
+
+var (
+	errFirst  = errors.New("first failed")
+	errSecond = errors.New("second failed")
+)
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name string
+		// errs are the errors returned by the handlers, in registration order
+		errs     []error
+		msgs     []eventbus.Message
+		wantErrs []error
+		// wantCalls are the handlers called for each message, in order
+		wantCalls []string
+	}{
+		{
+			name:      "every handler is called",
+			errs:      []error{nil, nil},
+			msgs:      []eventbus.Message{testMessage{N: 1}},
+			wantCalls: []string{"first", "second"},
+		},
+		{
+			name:      "every message is delivered",
+			errs:      []error{nil},
+			msgs:      []eventbus.Message{testMessage{N: 1}, testMessage{N: 2}},
+			wantCalls: []string{"first", "first"},
+		},
+		{
+			name:      "a failure does not stop the other handlers",
+			errs:      []error{errFirst, nil},
+			msgs:      []eventbus.Message{testMessage{N: 1}},
+			wantErrs:  []error{errFirst},
+			wantCalls: []string{"first", "second"},
+		},
+		{
+			name:      "failures are joined",
+			errs:      []error{errFirst, errSecond},
+			msgs:      []eventbus.Message{testMessage{N: 1}, testMessage{N: 2}},
+			wantErrs:  []error{errFirst, errSecond},
+			wantCalls: []string{"first", "second", "first", "second"},
+		},
+		{
+			name: "message without handlers",
+			errs: []error{errFirst},
+			msgs: []eventbus.Message{otherMessage{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := eventbus.New()
+			var calls []string
+			for i, name := range []string{"first", "second"}[:len(tt.errs)] {
+				eventbus.Register(bus, func(context.Context, testMessage) error {
+					calls = append(calls, name)
+					return tt.errs[i]
+				}, eventbus.WithName(name))
+			}
+
+			err := bus.Publish(context.Background(), tt.msgs...)
+			if len(tt.wantErrs) == 0 && err != nil {
+				t.Errorf("Publish() error = %v, want nil", err)
+			}
+			for _, want := range tt.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("Publish() error = %v, want it to wrap %v", err, want)
+				}
+			}
+			if !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrQueueFull = errors.New("queue is full")
+
+// OverflowPolicy defines what happens when a message is published to a full queue.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue, or for the publishing context to be done.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop discards the message, reporting ErrQueueFull to the error handler.
+	OverflowDrop
+	// OverflowFail returns ErrQueueFull to the publisher.
+	OverflowFail
+)
+
+var overflowPolicies = []string{
+	OverflowBlock: "block",
+	OverflowDrop:  "drop",
+	OverflowFail:  "fail",
+}
+
+func (p OverflowPolicy) String() string {
+	if int(p) < len(overflowPolicies) {
+		return overflowPolicies[p]
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+func (p OverflowPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText parses the name of an overflow policy, eg: drop
+func (p *OverflowPolicy) UnmarshalText(text []byte) error {
+	i := slices.Index(overflowPolicies, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown overflow policy '%s', expected one of %v", text, overflowPolicies)
+	}
+	*p = OverflowPolicy(i)
+	return nil
+}
+
+type item struct {
+	ctx      context.Context
+	env      Envelope
+	handlers []registration
+}
+
+type queue struct {
+	items chan item
+}
+
+func (b *Bus) startQueue() *queue {
+	q := &queue{
+		items: make(chan item, b.queueSize),
+	}
+
+	for range b.poolSize {
+		b.workers.Add(1)
+		go func() {
+			defer b.workers.Done()
+			for it := range q.items {
+				b.dispatch(it)
+			}
+		}()
+	}
+
+	return q
+}
+
+func (b *Bus) enqueue(ctx context.Context, env Envelope, handlers []registration) error {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+	q := b.queues[env.Message.Kind()]
+	b.sending.Add(1)
+	b.mu.RUnlock()
+	defer b.sending.Done()
+
+	it := item{
+		// the handlers outlive the publisher, so they cannot be cancelled by it
+		ctx:      context.WithoutCancel(ctx),
+		env:      env,
+		handlers: handlers,
+	}
+
+	switch b.overflow {
+	case OverflowDrop:
+		select {
+		case q.items <- it:
+		default:
+			for _, r := range handlers {
+				b.onError(it.ctx, r.name, env.Message, ErrQueueFull)
+			}
+		}
+		return nil
+	case OverflowFail:
+		select {
+		case q.items <- it:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	default:
+		select {
+		case q.items <- it:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return ErrClosed
+		}
+	}
+}
+
+func (b *Bus) dispatch(it item) {
+	for _, r := range it.handlers {
+		err := b.call(it.ctx, r, it.env)
+		if err != nil {
+			b.onError(it.ctx, r.name, it.env.Message, err)
+		}
+	}
+}
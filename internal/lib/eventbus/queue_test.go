@@ -0,0 +1,197 @@
+package eventbus_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+// blockingHandler blocks every call until release is closed, telling when a call started
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+	handled atomic.Int32
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		started: make(chan struct{}, 100),
+		release: make(chan struct{}),
+	}
+}
+
+func (h *blockingHandler) handle(_ context.Context, _ testMessage) error {
+	h.started <- struct{}{}
+	<-h.release
+	h.handled.Add(1)
+	return nil
+}
+
+// fillQueue publishes a message being handled and another one waiting in the queue of size 1
+func fillQueue(t *testing.T, bus *eventbus.Bus, h *blockingHandler) {
+	t.Helper()
+
+	err := bus.Publish(context.Background(), testMessage{N: 1})
+	if err != nil {
+		t.Fatalf("publishing the first message: %v", err)
+	}
+	<-h.started
+	err = bus.Publish(context.Background(), testMessage{N: 2})
+	if err != nil {
+		t.Fatalf("publishing the second message: %v", err)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow eventbus.OverflowPolicy
+		wantErr  error
+		wantFull int32
+	}{
+		{name: "block", overflow: eventbus.OverflowBlock, wantErr: context.DeadlineExceeded},
+		{name: "drop", overflow: eventbus.OverflowDrop, wantFull: 1},
+		{name: "fail", overflow: eventbus.OverflowFail, wantErr: eventbus.ErrQueueFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var full atomic.Int32
+			bus := eventbus.New(
+				eventbus.WithQueueSize(1),
+				eventbus.WithOverflow(tt.overflow),
+				eventbus.WithErrorHandler(func(_ context.Context, _ string, _ eventbus.Message, err error) {
+					if errors.Is(err, eventbus.ErrQueueFull) {
+						full.Add(1)
+					}
+				}),
+			)
+			h := newBlockingHandler()
+			eventbus.Register(bus, h.handle, eventbus.Async())
+			fillQueue(t, bus, h)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := bus.Publish(ctx, testMessage{N: 3})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Publish() error = %v, want %v", err, tt.wantErr)
+			}
+
+			close(h.release)
+			err = bus.Shutdown(context.Background())
+			if err != nil {
+				t.Fatalf("Shutdown() error = %v", err)
+			}
+			if got := full.Load(); got != tt.wantFull {
+				t.Errorf("queue full reports = %d, want %d", got, tt.wantFull)
+			}
+			// the third message was never queued
+			if got := h.handled.Load(); got != 2 {
+				t.Errorf("handled = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages int
+		workers  int
+	}{
+		{name: "no messages", messages: 0, workers: 1},
+		{name: "single worker", messages: 50, workers: 1},
+		{name: "worker pool", messages: 50, workers: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := eventbus.New(eventbus.WithQueueSize(tt.messages+1), eventbus.WithWorkers(tt.workers))
+			var handled atomic.Int32
+			eventbus.Register(bus, func(context.Context, testMessage) error {
+				time.Sleep(time.Millisecond)
+				handled.Add(1)
+				return nil
+			}, eventbus.Async())
+
+			for i := range tt.messages {
+				err := bus.Publish(context.Background(), testMessage{N: i})
+				if err != nil {
+					t.Fatalf("Publish() error = %v", err)
+				}
+			}
+
+			err := bus.Shutdown(context.Background())
+			if err != nil {
+				t.Fatalf("Shutdown() error = %v", err)
+			}
+			if got := handled.Load(); got != int32(tt.messages) {
+				t.Errorf("handled = %d, want %d", got, tt.messages)
+			}
+
+			err = bus.Publish(context.Background(), testMessage{})
+			if !errors.Is(err, eventbus.ErrClosed) {
+				t.Errorf("Publish() after shutdown error = %v, want %v", err, eventbus.ErrClosed)
+			}
+		})
+	}
+}
+func TestShutdownReleasesBlockedPublishers(t *testing.T) {
+	bus := eventbus.New(eventbus.WithQueueSize(1), eventbus.WithOverflow(eventbus.OverflowBlock))
+	h := newBlockingHandler()
+	eventbus.Register(bus, h.handle, eventbus.Async())
+	fillQueue(t, bus, h)
+
+	published := make(chan error, 1)
+	go func() {
+		published <- bus.Publish(context.Background(), testMessage{N: 3})
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var shutdownErr error
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		shutdownErr = bus.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-published:
+		if !errors.Is(err, eventbus.ErrClosed) {
+			t.Errorf("blocked Publish() error = %v, want %v", err, eventbus.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked publisher not released by shutdown")
+	}
+
+	close(h.release)
+	wg.Wait()
+	if shutdownErr != nil {
+		t.Fatalf("Shutdown() error = %v", shutdownErr)
+	}
+	if got := h.handled.Load(); got != 2 {
+		t.Errorf("handled = %d, want 2", got)
+	}
+}
+
+func TestRegisterAfterShutdown(t *testing.T) {
+	bus := eventbus.New()
+	err := bus.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering after shutdown did not panic")
+		}
+	}()
+	eventbus.Register(bus, func(context.Context, testMessage) error { return nil })
+}
@@ -0,0 +1,48 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Registry knows the concrete type of each message kind, so that messages can be stored and read back.
+type Registry struct {
+	kinds map[string]func(data []byte) (Message, error)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		kinds: make(map[string]func(data []byte) (Message, error)),
+	}
+}
+
+// RegisterKind makes the kind of T known to the registry.
+func RegisterKind[T Message](r *Registry) {
+	var zero T
+	r.kinds[zero.Kind()] = func(data []byte) (Message, error) {
+		var m T
+		err := json.Unmarshal(data, &m)
+		return m, err
+	}
+}
+
+func (r *Registry) Encode(m Message) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("encoding message '%s': %w", m.Kind(), err)
+	}
+	return data, nil
+}
+
+func (r *Registry) Decode(kind string, data []byte) (Message, error) {
+	decode, ok := r.kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown message kind '%s'", kind)
+	}
+
+	m, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding message '%s': %w", kind, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,111 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy defines how many times a failing handler is called and how long to wait between calls.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of calls, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries. Zero means no cap.
+	MaxBackoff time.Duration
+	// Multiplier grows the wait after each retry. Values below 1 are treated as 1.
+	Multiplier float64
+	// Jitter randomizes each wait by up to this fraction of it, eg: 0.2 for ±20%.
+	Jitter float64
+	// Permanent lists the errors that are not worth retrying. They are matched with errors.Is.
+	Permanent []error
+}
+
+// DefaultRetryPolicy returns the policy of the handlers with no reason for another.
+// The handler is called up to 3 times, waiting 50ms before the first retry and doubling the wait after each one,
+// capped at 1s, with a jitter of ±20%.
+// Only the permanent errors, matched with errors.Is, and the ones marked with Permanent are not retried.
+func DefaultRetryPolicy(permanent ...error) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Permanent:      permanent,
+	}
+}
+
+// WithRetry sets the retry policy of the handler. Without it, a handler is called only once.
+func WithRetry(policy RetryPolicy) RegisterOption {
+	return func(r *registration) {
+		r.retry = policy
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error as not retryable, regardless of the retry policy.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+func (p RetryPolicy) isPermanent(err error) bool {
+	if errors.As(err, &permanentError{}) {
+		return true
+	}
+	for _, e := range p.Permanent {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := max(p.Multiplier, 1)
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry))
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// call calls the handler until it succeeds, fails with a permanent error or runs out of attempts,
+// returning the last error and the number of attempts.
+func (p RetryPolicy) call(ctx context.Context, handler Handler[Message], m Message) (int, error) {
+	attempts := max(p.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := handler(ctx, m)
+		if err == nil || attempt == attempts || p.isPermanent(err) {
+			return attempt, err
+		}
+
+		t := time.NewTimer(p.backoff(attempt - 1))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return attempt, errors.Join(err, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package eventstore keeps the events of the event sourced aggregates, in a stream per aggregate,
+// from which the aggregates are rebuilt by replaying them.
+package eventstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+var (
+	// ErrConflict is returned when appending to a stream that is no longer at the expected version
+	ErrConflict = errors.New("stream changed concurrently")
+	// ErrNoSnapshot is returned when a stream has no snapshot
+	ErrNoSnapshot = errors.New("no snapshot")
+)
+
+// Snapshot is the state of an aggregate at a version of its stream, so that only the events after it are replayed.
+type Snapshot struct {
+	StreamID uuid.UUID
+	Version  int
+	// Data is the state of the aggregate, encoded by its repository
+	Data []byte
+}
+
+// Store keeps the streams of events.
+// It joins the unit of work carried by the context, if any, so that the events are appended together
+// with the other changes, eg: the outbox.
+type Store interface {
+	// Append adds the envelopes to the end of the stream, failing with ErrConflict if the stream is not at the expected version.
+	// The expected version of a new stream is zero.
+	// The envelopes take the positions after the expected version, that Load returns as their aggregate version,
+	// with the stream as their aggregate.
+	Append(ctx context.Context, stream uuid.UUID, expected int, envs ...eventbus.Envelope) error
+	// Load returns the envelopes of the stream after the version from, oldest first.
+	// A stream that does not exist has no events.
+	Load(ctx context.Context, stream uuid.UUID, from int) ([]eventbus.Envelope, error)
+	// Streams returns the IDs of all the streams.
+	Streams(ctx context.Context) ([]uuid.UUID, error)
+	// SaveSnapshot replaces the snapshot of the stream.
+	SaveSnapshot(ctx context.Context, s Snapshot) error
+	// LoadSnapshot returns the last snapshot of the stream, failing with ErrNoSnapshot if there is none.
+	LoadSnapshot(ctx context.Context, stream uuid.UUID) (Snapshot, error)
+}
@@ -0,0 +1,19 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrAlreadyClaimed is returned on commit when a key claimed in the unit of work was claimed by another one in the meantime
+var ErrAlreadyClaimed = errors.New("key already claimed")
+
+// Store records the keys of the operations already done, so that doing them again can be skipped,
+// eg: when a message is delivered more than once.
+// When the context carries a unit of work, the keys are only recorded if it commits.
+type Store interface {
+	// Claim records key, returning false if it was already recorded.
+	Claim(ctx context.Context, key string) (bool, error)
+	// Contains returns true if key was recorded.
+	Contains(ctx context.Context, key string) (bool, error)
+}
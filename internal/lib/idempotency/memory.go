@@ -0,0 +1,115 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+// MemoryStore is an in memory Store
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]struct{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys: map[string]struct{}{},
+	}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, key string) (bool, error) {
+	if tx, ok := s.tx(ctx); ok {
+		if _, ok := tx.claims[key]; ok {
+			return false, nil
+		}
+		if s.contains(key) {
+			return false, nil
+		}
+		tx.claims[key] = struct{}{}
+		return true, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key]; ok {
+		return false, nil
+	}
+	s.keys[key] = struct{}{}
+	return true, nil
+}
+
+func (s *MemoryStore) Contains(ctx context.Context, key string) (bool, error) {
+	if tx, ok := s.tx(ctx); ok {
+		if _, ok := tx.claims[key]; ok {
+			return true, nil
+		}
+		found := s.contains(key)
+		if !found {
+			// a key found missing must still be missing on commit
+			tx.absent[key] = struct{}{}
+		}
+		return found, nil
+	}
+
+	return s.contains(key), nil
+}
+
+func (s *MemoryStore) contains(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.keys[key]
+	return ok
+}
+
+func (s *MemoryStore) tx(ctx context.Context) (*staging, bool) {
+	return uow.Enlist(ctx, s, func() *staging {
+		return &staging{
+			store:  s,
+			claims: map[string]struct{}{},
+			absent: map[string]struct{}{},
+		}
+	})
+}
+
+// staging holds the keys claimed, and the keys found missing, during a unit of work
+type staging struct {
+	store  *MemoryStore
+	claims map[string]struct{}
+	absent map[string]struct{}
+}
+
+func (s *staging) Lock() {
+	s.store.mu.Lock()
+}
+
+func (s *staging) Unlock() {
+	s.store.mu.Unlock()
+}
+
+func (s *staging) Prepare() error {
+	for k := range s.claims {
+		if _, ok := s.store.keys[k]; ok {
+			return fmt.Errorf("'%s': %w", k, ErrAlreadyClaimed)
+		}
+	}
+	for k := range s.absent {
+		if _, ok := s.store.keys[k]; ok {
+			return fmt.Errorf("'%s' was claimed since it was read: %w", k, ErrAlreadyClaimed)
+		}
+	}
+	return nil
+}
+
+func (s *staging) Commit() error {
+	for k := range s.claims {
+		s.store.keys[k] = struct{}{}
+	}
+	return nil
+}
+
+func (s *staging) Rollback() {}
@@ -0,0 +1,28 @@
+package idempotency
+
+import (
+	"context"
+
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+// Once returns a handler that skips the messages whose envelope ID was already handled by the handler named name,
+// eg: when the relay publishes a record again.
+// The envelope ID is claimed in the same unit of work as the changes of the handler, so it is only recorded if they are saved.
+func Once[M eventbus.Message](store Store, name string, handler eventbus.Handler[M]) eventbus.Handler[M] {
+	return func(ctx context.Context, m M) error {
+		md, ok := eventbus.MetadataFrom(ctx)
+		if !ok {
+			return handler(ctx, m)
+		}
+
+		return uow.Run(ctx, func(ctx context.Context) error {
+			first, err := store.Claim(ctx, name+"/"+md.EventID.String())
+			if err != nil || !first {
+				return err
+			}
+			return handler(ctx, m)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/idempotency"
+)
+
+type testMessage struct{}
+
+func (testMessage) Kind() string {
+	return "Test"
+}
+
+func TestOnce(t *testing.T) {
+	first := eventbus.Metadata{EventID: uuid.New()}
+	second := eventbus.Metadata{EventID: uuid.New()}
+
+	tests := []struct {
+		name string
+		// deliveries are the envelopes handed to the handler, in order
+		deliveries []eventbus.Metadata
+		// failures is how many of the first calls fail
+		failures  int
+		wantCalls int
+	}{
+		{name: "delivered once", deliveries: []eventbus.Metadata{first}, wantCalls: 1},
+		{name: "delivered twice", deliveries: []eventbus.Metadata{first, first}, wantCalls: 1},
+		{name: "different envelopes", deliveries: []eventbus.Metadata{first, second, first}, wantCalls: 2},
+		{name: "failure is not recorded", deliveries: []eventbus.Metadata{first, first, first}, failures: 1, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, failures int
+			handler := idempotency.Once(idempotency.NewMemoryStore(), "test", func(context.Context, testMessage) error {
+				if failures < tt.failures {
+					failures++
+					return errors.New("handler failed")
+				}
+				calls++
+				return nil
+			})
+
+			for _, md := range tt.deliveries {
+				_ = handler(eventbus.WithMetadata(context.Background(), md), testMessage{})
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
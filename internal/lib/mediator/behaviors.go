@@ -0,0 +1,158 @@
+package mediator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+var (
+	// ErrInvalid is returned by the Validation behavior when a request fails its validation
+	ErrInvalid = errors.New("invalid request")
+	// ErrForbidden is returned by the Authorization behavior when a request is not allowed
+	ErrForbidden = errors.New("request not allowed")
+)
+
+// Validator is implemented by the requests that validate themselves before being handled.
+type Validator interface {
+	Validate() error
+}
+
+// Validation fails with ErrInvalid, without calling the handler, the requests implementing Validator that are not valid.
+func Validation() Behavior {
+	return func(ctx context.Context, r Request, next Next) (any, error) {
+		if v, ok := r.Message.(Validator); ok {
+			err := v.Validate()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w: %w", r.Name, ErrInvalid, err)
+			}
+		}
+		return next(ctx)
+	}
+}
+
+// Logging logs every request, with how long it took and its error, if any.
+func Logging(logger *slog.Logger) Behavior {
+	return func(ctx context.Context, r Request, next Next) (any, error) {
+		start := time.Now()
+		res, err := next(ctx)
+		if err != nil {
+			logger.InfoContext(ctx, "request failed", "request", r.Name, "kind", r.Kind, "duration", time.Since(start), "error", err)
+		} else {
+			logger.DebugContext(ctx, "request handled", "request", r.Name, "kind", r.Kind, "duration", time.Since(start))
+		}
+		return res, err
+	}
+}
+
+// Authorization fails with ErrForbidden, without calling the handler, the requests that allow rejects.
+func Authorization(allow func(ctx context.Context, r Request) bool) Behavior {
+	return func(ctx context.Context, r Request, next Next) (any, error) {
+		if !allow(ctx, r) {
+			return nil, fmt.Errorf("%s: %w", r.Name, ErrForbidden)
+		}
+		return next(ctx)
+	}
+}
+
+// Transaction runs the transactional requests in a unit of work, committed if the handler succeeds.
+// A request dispatched from another handler joins the unit of work of the caller.
+func Transaction() Behavior {
+	return func(ctx context.Context, r Request, next Next) (any, error) {
+		if !r.Transactional {
+			return next(ctx)
+		}
+		return uow.Do(ctx, func(ctx context.Context) (any, error) {
+			return next(ctx)
+		})
+	}
+}
+
+// Retry calls the rest of the pipeline again, up to attempts times in total, while it fails with an error that is retryable.
+// It must come before Transaction, so that every attempt runs in a new unit of work.
+// A request dispatched from another handler is not retried, since the unit of work of the caller decides the outcome.
+func Retry(attempts int, backoff time.Duration, retryable func(error) bool) Behavior {
+	return func(ctx context.Context, r Request, next Next) (any, error) {
+		if _, ok := uow.FromContext(ctx); ok {
+			return next(ctx)
+		}
+
+		for attempt := 1; ; attempt++ {
+			res, err := next(ctx)
+			if err == nil || attempt >= attempts || !retryable(err) {
+				return res, err
+			}
+
+			t := time.NewTimer(backoff * time.Duration(attempt))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil, errors.Join(err, ctx.Err())
+			}
+		}
+	}
+}
+
+// Stats counts the requests handled by each handler, with their errors and duration.
+type Stats struct {
+	mu    sync.Mutex
+	stats map[string]*RequestStats
+}
+
+type RequestStats struct {
+	Kind   Kind `json:"kind"`
+	Count  int  `json:"count"`
+	Errors int  `json:"errors"`
+	// Duration is the total time spent handling the requests
+	Duration time.Duration `json:"duration"`
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		stats: make(map[string]*RequestStats),
+	}
+}
+
+// Snapshot returns a copy of the stats, by request name.
+func (s *Stats) Snapshot() map[string]RequestStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]RequestStats, len(s.stats))
+	for name, rs := range s.stats {
+		snapshot[name] = *rs
+	}
+	return snapshot
+}
+
+func (s *Stats) record(r Request, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs, ok := s.stats[r.Name]
+	if !ok {
+		rs = &RequestStats{Kind: r.Kind}
+		s.stats[r.Name] = rs
+	}
+	rs.Count++
+	rs.Duration += d
+	if err != nil {
+		rs.Errors++
+	}
+}
+
+// Metrics records every request in stats.
+func Metrics(stats *Stats) Behavior {
+	return func(ctx context.Context, r Request, next Next) (any, error) {
+		start := time.Now()
+		res, err := next(ctx)
+		stats.record(r, time.Since(start), err)
+		return res, err
+	}
+}
@@ -0,0 +1,167 @@
+package mediator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+var (
+	errRetryable = errors.New("retryable")
+	errFatal     = errors.New("fatal")
+)
+
+type rename struct {
+	Name string
+}
+
+func (r rename) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestValidationAndAuthorization(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         rename
+		allow       bool
+		wantErr     error
+		wantHandled bool
+	}{
+		{name: "valid and allowed", req: rename{Name: "pen"}, allow: true, wantHandled: true},
+		{name: "invalid", req: rename{}, allow: true, wantErr: mediator.ErrInvalid},
+		{name: "not allowed", req: rename{Name: "pen"}, wantErr: mediator.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mediator.New()
+			m.Use(
+				mediator.Validation(),
+				mediator.Authorization(func(context.Context, mediator.Request) bool { return tt.allow }),
+			)
+			handled := false
+			mediator.RegisterCommand(m, mediator.Void(func(context.Context, rename) error {
+				handled = true
+				return nil
+			}))
+
+			err := mediator.Exec(context.Background(), m, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exec() error = %v, want %v", err, tt.wantErr)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+		})
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		command bool
+		options []mediator.RegisterOption
+		wantTx  bool
+	}{
+		{name: "command", command: true, wantTx: true},
+		{name: "command without transaction", command: true, options: []mediator.RegisterOption{mediator.WithoutTransaction()}},
+		{name: "query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mediator.New()
+			m.Use(mediator.Transaction())
+			var inTx bool
+			handler := func(ctx context.Context, _ rename) (struct{}, error) {
+				_, inTx = uow.FromContext(ctx)
+				return struct{}{}, nil
+			}
+			if tt.command {
+				mediator.RegisterCommand(m, handler, tt.options...)
+			} else {
+				mediator.RegisterQuery(m, handler, tt.options...)
+			}
+
+			err := mediator.Exec(context.Background(), m, rename{Name: "pen"})
+			if err != nil {
+				t.Fatalf("Exec() error = %v", err)
+			}
+			if inTx != tt.wantTx {
+				t.Errorf("in a unit of work = %v, want %v", inTx, tt.wantTx)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// errs are the errors returned by each call, the calls after them succeed
+		errs      []error
+		inTx      bool
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "succeeds", wantCalls: 1},
+		{name: "retryable then succeeds", errs: []error{errRetryable, errRetryable}, wantCalls: 3},
+		{name: "attempts exhausted", errs: []error{errRetryable, errRetryable, errRetryable, errRetryable}, wantErr: errRetryable, wantCalls: 3},
+		{name: "not retryable", errs: []error{errFatal}, wantErr: errFatal, wantCalls: 1},
+		{name: "in the unit of work of the caller", errs: []error{errRetryable}, inTx: true, wantErr: errRetryable, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mediator.New()
+			m.Use(mediator.Retry(3, 0, func(err error) bool { return errors.Is(err, errRetryable) }))
+			calls := 0
+			mediator.RegisterCommand(m, mediator.Void(func(context.Context, rename) error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			}))
+
+			exec := func(ctx context.Context) error {
+				return mediator.Exec(ctx, m, rename{Name: "pen"})
+			}
+			var err error
+			if tt.inTx {
+				err = uow.Run(context.Background(), exec)
+			} else {
+				err = exec(context.Background())
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exec() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := mediator.New()
+	stats := mediator.NewStats()
+	m.Use(mediator.Metrics(stats))
+	mediator.RegisterCommand(m, mediator.Void(func(_ context.Context, r rename) error {
+		return r.Validate()
+	}))
+
+	for _, name := range []string{"pen", "", "ink"} {
+		_ = mediator.Exec(context.Background(), m, rename{Name: name})
+	}
+
+	got := stats.Snapshot()["rename"]
+	if got.Kind != mediator.KindCommand || got.Count != 3 || got.Errors != 1 {
+		t.Errorf("stats = %+v, want 3 commands with 1 error", got)
+	}
+}
@@ -0,0 +1,169 @@
+package mediator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var ErrNoHandler = errors.New("no handler registered")
+
+type Kind string
+
+const (
+	KindCommand Kind = "command"
+	KindQuery   Kind = "query"
+)
+
+// Handler handles a request of type Req, returning a result of type Res.
+type Handler[Req, Res any] func(ctx context.Context, req Req) (Res, error)
+
+// Request describes the request going through the pipeline.
+type Request struct {
+	// Name is the name of the request type, eg: CreateProductCommand
+	Name string
+	Kind Kind
+	// Transactional is true if the handler must run in a unit of work
+	Transactional bool
+	Message       any
+}
+
+// Next calls the next behavior in the pipeline, or the handler at the end of it.
+type Next func(ctx context.Context) (any, error)
+
+// Behavior wraps every handler, with logic that is common to all of them.
+type Behavior func(ctx context.Context, r Request, next Next) (any, error)
+
+// Mediator dispatches each request to the handler registered for its type,
+// through the pipeline of behaviors.
+type Mediator struct {
+	mu        sync.RWMutex
+	handlers  map[reflect.Type]registration
+	behaviors []Behavior
+}
+
+type registration struct {
+	request Request
+	handler func(ctx context.Context, req any) (any, error)
+}
+
+func New() *Mediator {
+	return &Mediator{
+		handlers: make(map[reflect.Type]registration),
+	}
+}
+
+// Use appends behaviors to the pipeline. The first behavior is the outermost one.
+func (m *Mediator) Use(behaviors ...Behavior) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.behaviors = append(m.behaviors, behaviors...)
+}
+
+type RegisterOption func(*Request)
+
+// WithoutTransaction makes a command run outside of a unit of work,
+// eg: because it starts units of work of its own that must not be joined.
+func WithoutTransaction() RegisterOption {
+	return func(r *Request) {
+		r.Transactional = false
+	}
+}
+
+// RegisterCommand registers the handler of the commands of type Req.
+// Commands run in a unit of work unless registered WithoutTransaction.
+// It panics if there is already a handler for Req.
+func RegisterCommand[Req, Res any](m *Mediator, handler Handler[Req, Res], options ...RegisterOption) {
+	register(m, KindCommand, handler, options)
+}
+
+// RegisterQuery registers the handler of the queries of type Req.
+// It panics if there is already a handler for Req.
+func RegisterQuery[Req, Res any](m *Mediator, handler Handler[Req, Res], options ...RegisterOption) {
+	register(m, KindQuery, handler, options)
+}
+
+func register[Req, Res any](m *Mediator, kind Kind, handler Handler[Req, Res], options []RegisterOption) {
+	t := reflect.TypeFor[Req]()
+	r := registration{
+		request: Request{
+			Name:          typeName(t),
+			Kind:          kind,
+			Transactional: kind == KindCommand,
+		},
+		handler: func(ctx context.Context, req any) (any, error) {
+			return handler(ctx, req.(Req))
+		},
+	}
+	for _, o := range options {
+		o(&r.request)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.handlers[t]; ok {
+		panic(fmt.Sprintf("mediator: a handler for %s is already registered", t))
+	}
+	m.handlers[t] = r
+}
+
+// Send dispatches the request to its handler, through the pipeline, returning the result of the handler.
+func Send[Res, Req any](ctx context.Context, m *Mediator, req Req) (Res, error) {
+	var zero Res
+
+	t := reflect.TypeFor[Req]()
+	m.mu.RLock()
+	r, ok := m.handlers[t]
+	behaviors := m.behaviors
+	m.mu.RUnlock()
+	if !ok {
+		return zero, fmt.Errorf("%s: %w", t, ErrNoHandler)
+	}
+
+	request := r.request
+	request.Message = req
+
+	next := func(ctx context.Context) (any, error) {
+		return r.handler(ctx, req)
+	}
+	for i := len(behaviors) - 1; i >= 0; i-- {
+		b, inner := behaviors[i], next
+		next = func(ctx context.Context) (any, error) {
+			return b(ctx, request, inner)
+		}
+	}
+
+	res, err := next(ctx)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := res.(Res)
+	if !ok && res != nil {
+		return zero, fmt.Errorf("%s returned %T, expected %s", t, res, reflect.TypeFor[Res]())
+	}
+	return typed, nil
+}
+
+// Exec dispatches a command that has no result, registered with Void.
+func Exec[Req any](ctx context.Context, m *Mediator, req Req) error {
+	_, err := Send[struct{}](ctx, m, req)
+	return err
+}
+
+// Void adapts a handler without result, to be registered as a command and dispatched with Exec.
+func Void[Req any](handler func(ctx context.Context, req Req) error) Handler[Req, struct{}] {
+	return func(ctx context.Context, req Req) (struct{}, error) {
+		return struct{}{}, handler(ctx, req)
+	}
+}
+
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,98 @@
+package mediator_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+)
+
+type greet struct {
+	Name string
+}
+
+type unknown struct{}
+
+// tracing returns a behavior adding its name to the calls, before and after the rest of the pipeline
+func tracing(name string, calls *[]string) mediator.Behavior {
+	return func(ctx context.Context, r mediator.Request, next mediator.Next) (any, error) {
+		*calls = append(*calls, name+" "+r.Name)
+		res, err := next(ctx)
+		*calls = append(*calls, name+" done")
+		return res, err
+	}
+}
+
+func TestSend(t *testing.T) {
+	var calls []string
+	m := mediator.New()
+	m.Use(tracing("outer", &calls), tracing("inner", &calls))
+	mediator.RegisterQuery(m, func(_ context.Context, req greet) (string, error) {
+		calls = append(calls, "handler")
+		return "hello " + req.Name, nil
+	})
+
+	got, err := mediator.Send[string](context.Background(), m, greet{Name: "ann"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got != "hello ann" {
+		t.Errorf("Send() = %q, want %q", got, "hello ann")
+	}
+	want := []string{"outer greet", "inner greet", "handler", "inner done", "outer done"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	_, err = mediator.Send[string](context.Background(), m, unknown{})
+	if !errors.Is(err, mediator.ErrNoHandler) {
+		t.Errorf("Send() of an unknown request error = %v, want %v", err, mediator.ErrNoHandler)
+	}
+}
+
+func TestExec(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "handled"},
+		{name: "failed", err: errFailed, wantErr: errFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mediator.New()
+			var handled []string
+			mediator.RegisterCommand(m, mediator.Void(func(_ context.Context, req greet) error {
+				handled = append(handled, req.Name)
+				return tt.err
+			}))
+
+			err := mediator.Exec(context.Background(), m, greet{Name: "ann"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exec() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(handled, []string{"ann"}) {
+				t.Errorf("handled = %v, want [ann]", handled)
+			}
+		})
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	m := mediator.New()
+	handler := func(context.Context, greet) (string, error) { return "", nil }
+	mediator.RegisterQuery(m, handler)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a second handler did not panic")
+		}
+	}()
+	mediator.RegisterCommand(m, handler)
+}
@@ -0,0 +1,51 @@
+package module
+
+import (
+	"context"
+	"sync"
+)
+
+// Background runs the long lived functions of a module, eg: pollers, until it is stopped.
+type Background struct {
+	mu      sync.Mutex
+	cancels []context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// Go runs fn in a goroutine, with a context that is cancelled when ctx is done or Stop is called.
+func (b *Background) Go(ctx context.Context, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	b.mu.Lock()
+	b.cancels = append(b.cancels, cancel)
+	b.mu.Unlock()
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(ctx)
+	}()
+}
+
+// Stop cancels the functions and waits for them to return, or for ctx to be done.
+func (b *Background) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	for _, cancel := range b.cancels {
+		cancel()
+	}
+	b.cancels = nil
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,277 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrMissingProvider   = errors.New("no module provides the dependency")
+	ErrDuplicateProvider = errors.New("more than one module provides the dependency")
+	ErrCycle             = errors.New("dependency cycle")
+	ErrNotProvided       = errors.New("dependency declared but not provided")
+)
+
+// Key identifies a dependency of type T.
+type Key[T any] struct {
+	name string
+}
+
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Module is a part of the application, eg: a slice, that declares the dependencies it provides to,
+// and requires from, the other modules.
+type Module interface {
+	Name() string
+	// Provides returns the names of the keys the module provides in Init.
+	Provides() []string
+	// Requires returns the names of the keys the module gets in Init.
+	Requires() []string
+	// Init gets the required dependencies from the container, provides its own and registers its routes and handlers.
+	// It is called after the Init of the modules providing what it requires.
+	Init(ctx context.Context, c *Container) error
+}
+
+// Starter is implemented by the modules that have background work, eg: pollers, started after every module is initialised.
+// Start must not block.
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Drainer is implemented by the modules that take work, eg: pollers or queues, to stop taking it and finish the one in flight.
+// Modules are drained in reverse dependency order, and all of them before any is stopped,
+// so that the work in flight can still use the dependencies.
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// Stopper is implemented by the modules that have resources to release.
+// Modules are stopped in reverse dependency order.
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// Container holds the dependencies provided by the modules.
+// Each module sees it scoped to the keys it declared, so that the declarations cannot drift from what Init does.
+type Container struct {
+	values   map[string]any
+	module   string
+	requires []string
+	provides []string
+}
+
+// Provide makes v available to the modules requiring k.
+// It panics if the module did not declare k in Provides.
+func Provide[T any](c *Container, k Key[T], v T) {
+	if !slices.Contains(c.provides, k.name) {
+		panic(fmt.Sprintf("module %s provides '%s' without declaring it", c.module, k.name))
+	}
+	c.values[k.name] = v
+}
+
+// Get returns the dependency k.
+// It panics if the module did not declare k in Requires, since the registry only guarantees the declared dependencies.
+func Get[T any](c *Container, k Key[T]) T {
+	if !slices.Contains(c.requires, k.name) {
+		panic(fmt.Sprintf("module %s gets '%s' without requiring it", c.module, k.name))
+	}
+	return c.values[k.name].(T)
+}
+
+// Supply returns a module that only provides v, eg: for the values created outside of the modules.
+func Supply[T any](k Key[T], v T) Module {
+	return supply[T]{key: k, value: v}
+}
+
+type supply[T any] struct {
+	key   Key[T]
+	value T
+}
+
+func (s supply[T]) Name() string {
+	return "supply:" + s.key.name
+}
+
+func (s supply[T]) Provides() []string {
+	return []string{s.key.name}
+}
+
+func (s supply[T]) Requires() []string {
+	return nil
+}
+
+func (s supply[T]) Init(_ context.Context, c *Container) error {
+	Provide(c, s.key, s.value)
+	return nil
+}
+
+// Registry initialises, starts and stops the modules in dependency order.
+type Registry struct {
+	modules     []Module
+	values      map[string]any
+	initialised []Module
+}
+
+func NewRegistry(modules ...Module) *Registry {
+	return &Registry{
+		modules: modules,
+		values:  make(map[string]any),
+	}
+}
+
+// Init initialises the modules, each after the ones providing what it requires.
+// It fails, before initialising any module, if a dependency has no provider or more than one, or if there is a cycle.
+func (r *Registry) Init(ctx context.Context) error {
+	ordered, err := r.resolve()
+	if err != nil {
+		return err
+	}
+	r.modules = ordered
+
+	for _, m := range r.modules {
+		c := &Container{
+			values:   r.values,
+			module:   m.Name(),
+			requires: m.Requires(),
+			provides: m.Provides(),
+		}
+		err := m.Init(ctx, c)
+		if err != nil {
+			return fmt.Errorf("initialising module %s: %w", m.Name(), err)
+		}
+		r.initialised = append(r.initialised, m)
+
+		for _, k := range m.Provides() {
+			if _, ok := r.values[k]; !ok {
+				return fmt.Errorf("module %s, '%s': %w", m.Name(), k, ErrNotProvided)
+			}
+		}
+	}
+	return nil
+}
+
+// Start starts the modules, in dependency order.
+// If a module fails to start, the modules are stopped.
+func (r *Registry) Start(ctx context.Context) error {
+	for _, m := range r.initialised {
+		s, ok := m.(Starter)
+		if !ok {
+			continue
+		}
+
+		err := s.Start(ctx)
+		if err != nil {
+			err = fmt.Errorf("starting module %s: %w", m.Name(), err)
+			return errors.Join(err, r.Stop(ctx))
+		}
+	}
+	return nil
+}
+
+// Stop drains and then stops the initialised modules, in reverse dependency order, eg: after Init or Start failed half way.
+// Every module is drained and stopped, even if some fail, and the failures are returned joined together.
+func (r *Registry) Stop(ctx context.Context) error {
+	var errs []error
+	for _, m := range slices.Backward(r.initialised) {
+		d, ok := m.(Drainer)
+		if !ok {
+			continue
+		}
+
+		err := d.Drain(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("draining module %s: %w", m.Name(), err))
+		}
+	}
+
+	for _, m := range slices.Backward(r.initialised) {
+		s, ok := m.(Stopper)
+		if !ok {
+			continue
+		}
+
+		err := s.Stop(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stopping module %s: %w", m.Name(), err))
+		}
+	}
+	r.initialised = nil
+	return errors.Join(errs...)
+}
+
+// resolve orders the modules so that every module comes after the providers of its requirements,
+// keeping the registration order otherwise.
+func (r *Registry) resolve() ([]Module, error) {
+	providers := make(map[string]int)
+	for i, m := range r.modules {
+		for _, k := range m.Provides() {
+			if j, ok := providers[k]; ok {
+				return nil, fmt.Errorf("'%s' by %s and %s: %w", k, r.modules[j].Name(), m.Name(), ErrDuplicateProvider)
+			}
+			providers[k] = i
+		}
+	}
+
+	var errs []error
+	for _, m := range r.modules {
+		for _, k := range m.Requires() {
+			if _, ok := providers[k]; !ok {
+				errs = append(errs, fmt.Errorf("'%s' required by %s: %w", k, m.Name(), ErrMissingProvider))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(r.modules))
+	ordered := make([]Module, 0, len(r.modules))
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			start := slices.Index(path, r.modules[i].Name())
+			cycle := append(slices.Clone(path[start:]), r.modules[i].Name())
+			return fmt.Errorf("%s: %w", strings.Join(cycle, " -> "), ErrCycle)
+		}
+
+		state[i] = visiting
+		path = append(path, r.modules[i].Name())
+		for _, k := range r.modules[i].Requires() {
+			err := visit(providers[k])
+			if err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		ordered = append(ordered, r.modules[i])
+		return nil
+	}
+
+	for i := range r.modules {
+		err := visit(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
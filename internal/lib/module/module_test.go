@@ -0,0 +1,211 @@
+package module_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/quintans/vertical-slices/internal/lib/module"
+)
+
+var errStart = errors.New("start failed")
+
+// fake provides every key it declares, unless skip is set, recording the calls in the log
+type fake struct {
+	name     string
+	provides []string
+	requires []string
+	skip     bool
+	startErr error
+	log      *[]string
+}
+
+func (f fake) Name() string {
+	return f.name
+}
+
+func (f fake) Provides() []string {
+	return f.provides
+}
+
+func (f fake) Requires() []string {
+	return f.requires
+}
+
+func (f fake) Init(_ context.Context, c *module.Container) error {
+	*f.log = append(*f.log, "init "+f.name)
+	for _, k := range f.requires {
+		module.Get(c, module.NewKey[string](k))
+	}
+	if f.skip {
+		return nil
+	}
+	for _, k := range f.provides {
+		module.Provide(c, module.NewKey[string](k), f.name)
+	}
+	return nil
+}
+
+func (f fake) Start(context.Context) error {
+	*f.log = append(*f.log, "start "+f.name)
+	return f.startErr
+}
+
+func (f fake) Stop(context.Context) error {
+	*f.log = append(*f.log, "stop "+f.name)
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []fake
+		wantErr error
+		wantLog []string
+	}{
+		{
+			name: "dependency order",
+			modules: []fake{
+				{name: "orders", provides: []string{"orders"}, requires: []string{"db", "products"}},
+				{name: "products", provides: []string{"products"}, requires: []string{"db"}},
+				{name: "db", provides: []string{"db"}},
+			},
+			wantLog: []string{
+				"init db", "init products", "init orders",
+				"start db", "start products", "start orders",
+				"stop orders", "stop products", "stop db",
+			},
+		},
+		{
+			name: "independent modules keep the registration order",
+			modules: []fake{
+				{name: "b"},
+				{name: "a"},
+			},
+			wantLog: []string{"init b", "init a", "start b", "start a", "stop a", "stop b"},
+		},
+		{
+			name: "missing provider",
+			modules: []fake{
+				{name: "orders", requires: []string{"db"}},
+			},
+			wantErr: module.ErrMissingProvider,
+		},
+		{
+			name: "more than one provider",
+			modules: []fake{
+				{name: "sqlite", provides: []string{"db"}},
+				{name: "memory", provides: []string{"db"}},
+			},
+			wantErr: module.ErrDuplicateProvider,
+		},
+		{
+			name: "cycle",
+			modules: []fake{
+				{name: "orders", provides: []string{"orders"}, requires: []string{"products"}},
+				{name: "products", provides: []string{"products"}, requires: []string{"orders"}},
+			},
+			wantErr: module.ErrCycle,
+		},
+		{
+			name: "declared but not provided",
+			modules: []fake{
+				{name: "db", provides: []string{"db"}, skip: true},
+			},
+			wantErr: module.ErrNotProvided,
+			wantLog: []string{"init db", "stop db"},
+		},
+		{
+			name: "start failure stops the started modules",
+			modules: []fake{
+				{name: "db", provides: []string{"db"}},
+				{name: "orders", requires: []string{"db"}, startErr: errStart},
+			},
+			wantErr: errStart,
+			wantLog: []string{"init db", "init orders", "start db", "start orders", "stop orders", "stop db"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var log []string
+			var modules []module.Module
+			for _, m := range tt.modules {
+				m.log = &log
+				modules = append(modules, m)
+			}
+			r := module.NewRegistry(modules...)
+
+			err := r.Init(ctx)
+			if err == nil {
+				err = r.Start(ctx)
+			}
+			if err == nil {
+				err = r.Stop(ctx)
+			} else {
+				err = errors.Join(err, r.Stop(ctx))
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(log, tt.wantLog) {
+				t.Errorf("calls = %v, want %v", log, tt.wantLog)
+			}
+		})
+	}
+}
+
+// undeclared uses a key it did not declare
+type undeclared struct {
+	get bool
+}
+
+func (undeclared) Name() string {
+	return "undeclared"
+}
+
+func (undeclared) Provides() []string {
+	return nil
+}
+
+func (undeclared) Requires() []string {
+	return nil
+}
+
+func (u undeclared) Init(_ context.Context, c *module.Container) error {
+	k := module.NewKey[string]("db")
+	if u.get {
+		module.Get(c, k)
+		return nil
+	}
+	module.Provide(c, k, "memory")
+	return nil
+}
+
+func TestUndeclared(t *testing.T) {
+	tests := []struct {
+		name string
+		get  bool
+	}{
+		{name: "get without requiring", get: true},
+		{name: "provide without declaring"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := module.NewRegistry(
+				module.Supply(module.NewKey[string]("db"), "sqlite"),
+				undeclared{get: tt.get},
+			)
+
+			defer func() {
+				if recover() == nil {
+					t.Error("using an undeclared key did not panic")
+				}
+			}()
+			_ = r.Init(context.Background())
+		})
+	}
+}
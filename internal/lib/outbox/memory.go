@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+// MemoryStore is an in memory outbox.
+// Dispatched records are discarded since nothing reads them afterwards.
+type MemoryStore struct {
+	mu      sync.Mutex
+	seq     uint64
+	records []Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Add stores the envelopes, or stages them if the context carries a unit of work.
+func (s *MemoryStore) Add(ctx context.Context, envs ...eventbus.Envelope) error {
+	if tx, ok := uow.Enlist(ctx, s, func() *staging { return &staging{store: s} }); ok {
+		tx.envs = append(tx.envs, envs...)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(envs)
+	return nil
+}
+
+// add must be called with the lock held
+func (s *MemoryStore) add(envs []eventbus.Envelope) {
+	now := time.Now()
+	for _, env := range envs {
+		s.seq++
+		s.records = append(s.records, Record{
+			ID:        env.EventID,
+			Seq:       s.seq,
+			Envelope:  env,
+			CreatedAt: now,
+		})
+	}
+}
+
+func (s *MemoryStore) Pending(_ context.Context, limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := min(limit, len(s.records))
+	return slices.Clone(s.records[:n]), nil
+}
+
+func (s *MemoryStore) MarkDispatched(_ context.Context, ids ...uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = slices.DeleteFunc(s.records, func(r Record) bool {
+		return slices.Contains(ids, r.ID)
+	})
+	return nil
+}
+
+func (s *MemoryStore) LastSeq(_ context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.seq, nil
+}
+
+// staging holds the envelopes added during a unit of work
+type staging struct {
+	store *MemoryStore
+	envs  []eventbus.Envelope
+}
+
+func (s *staging) Lock() {
+	s.store.mu.Lock()
+}
+
+func (s *staging) Unlock() {
+	s.store.mu.Unlock()
+}
+
+func (s *staging) Prepare() error {
+	return nil
+}
+
+func (s *staging) Commit() error {
+	s.store.add(s.envs)
+	return nil
+}
+
+func (s *staging) Rollback() {}
@@ -0,0 +1,30 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+// Record is a message waiting in the outbox to be published, in its envelope.
+// Its ID is the ID of the event.
+type Record struct {
+	ID        uuid.UUID
+	Seq       uint64
+	Envelope  eventbus.Envelope
+	CreatedAt time.Time
+}
+
+// Store keeps the messages to be published.
+// Repositories add the messages of an aggregate in the same unit of work that saves it,
+// and the relay publishes them afterwards.
+type Store interface {
+	Add(ctx context.Context, envs ...eventbus.Envelope) error
+	// Pending returns the records not yet dispatched, in the order they were added.
+	Pending(ctx context.Context, limit int) ([]Record, error)
+	MarkDispatched(ctx context.Context, ids ...uuid.UUID) error
+	// LastSeq returns the sequence number of the last record added, dispatched or not, or zero if there is none.
+	LastSeq(ctx context.Context) (uint64, error)
+}
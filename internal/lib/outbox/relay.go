@@ -0,0 +1,219 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+)
+
+type Publisher interface {
+	PublishEnvelopes(ctx context.Context, envs ...eventbus.Envelope) error
+}
+
+// Relay polls the outbox and publishes the pending records.
+//
+// Delivery is at least once: a record is only marked as dispatched once the publisher accepts it,
+// and a record that fails to publish is left pending, with the ones after it, and retried with backoff.
+// A record can then be handed again to handlers that already handled it, so those with side effects
+// must skip the envelope IDs they have already seen, eg: with idempotency.Once.
+// A record whose failed handlers all moved it to the dead letters is dispatched, being left to be redriven from there.
+type Relay struct {
+	store      Store
+	publisher  Publisher
+	interval   time.Duration
+	batchSize  int
+	maxBackoff time.Duration
+
+	// published holds the records published but not yet marked as dispatched
+	published map[uuid.UUID]struct{}
+
+	mu sync.Mutex
+	// position is the sequence number up to which the records were all published
+	position uint64
+	// advanced is closed, and replaced, when the position advances
+	advanced chan struct{}
+}
+
+type RelayOption func(*Relay)
+
+// WithInterval sets the time between polls. Defaults to 100ms.
+func WithInterval(interval time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.interval = interval
+	}
+}
+
+// WithMaxBackoff sets the longest wait before retrying a record that failed to publish. Defaults to 10s.
+func WithMaxBackoff(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.maxBackoff = d
+	}
+}
+
+// WithBatchSize sets the maximum number of records read in each poll. Defaults to 100.
+func WithBatchSize(size int) RelayOption {
+	return func(r *Relay) {
+		r.batchSize = size
+	}
+}
+
+func NewRelay(store Store, publisher Publisher, options ...RelayOption) *Relay {
+	r := &Relay{
+		store:      store,
+		publisher:  publisher,
+		interval:   100 * time.Millisecond,
+		batchSize:  100,
+		maxBackoff: 10 * time.Second,
+		published:  make(map[uuid.UUID]struct{}),
+		advanced:   make(chan struct{}),
+	}
+	for _, o := range options {
+		o(r)
+	}
+	return r
+}
+
+// Run polls the outbox until the context is done.
+// After a failure it waits twice as long as before, up to the max backoff, before polling again.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	backoff := r.interval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := r.Flush(ctx)
+		if err == nil {
+			backoff = r.interval
+			continue
+		}
+
+		backoff = min(2*backoff, r.maxBackoff)
+		slog.ErrorContext(ctx, "relaying outbox", "error", err, "retryIn", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// Flush publishes the pending records until there are none left.
+// It is not safe to call concurrently with itself or with Run.
+func (r *Relay) Flush(ctx context.Context) error {
+	for {
+		// read before the pending records, so that every record up to it is either pending or dispatched
+		last, err := r.store.LastSeq(ctx)
+		if err != nil {
+			return fmt.Errorf("getting last record: %w", err)
+		}
+		records, err := r.store.Pending(ctx, r.batchSize)
+		if err != nil {
+			return fmt.Errorf("getting pending records: %w", err)
+		}
+		if len(records) == 0 {
+			r.advance(last)
+			return nil
+		}
+
+		// the records after one that failed are left pending too, to keep them in order
+		ids := make([]uuid.UUID, 0, len(records))
+		var pubErr error
+		for _, rec := range records {
+			if _, ok := r.published[rec.ID]; !ok {
+				err := r.publisher.PublishEnvelopes(ctx, rec.Envelope)
+				if eventbus.DeadLettered(err) {
+					// publishing again would call the handlers that did not fail once more
+					slog.WarnContext(ctx, "relayed record moved to dead letters", "id", rec.ID, "kind", rec.Envelope.Message.Kind(), "error", err)
+				} else if err != nil {
+					pubErr = fmt.Errorf("publishing record '%s' of kind '%s': %w", rec.ID, rec.Envelope.Message.Kind(), err)
+					break
+				}
+				r.published[rec.ID] = struct{}{}
+			}
+			ids = append(ids, rec.ID)
+		}
+
+		if len(ids) > 0 {
+			err = r.store.MarkDispatched(ctx, ids...)
+			if err != nil {
+				return errors.Join(pubErr, fmt.Errorf("marking records as dispatched: %w", err))
+			}
+			for _, id := range ids {
+				delete(r.published, id)
+			}
+			r.advance(records[len(ids)-1].Seq)
+		}
+		if pubErr != nil {
+			return pubErr
+		}
+
+		if len(records) < r.batchSize {
+			r.advance(last)
+			return nil
+		}
+	}
+}
+
+func (r *Relay) advance(seq uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if seq <= r.position {
+		return
+	}
+	r.position = seq
+	close(r.advanced)
+	r.advanced = make(chan struct{})
+}
+
+// Lag returns the number of records added to the outbox, and committed, that were not published yet.
+func (r *Relay) Lag(ctx context.Context) (uint64, error) {
+	last, err := r.store.LastSeq(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("getting last record: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last <= r.position {
+		return 0, nil
+	}
+	return last - r.position, nil
+}
+
+// CatchUp waits for the records committed so far to be published, or for the context to be done.
+// With the handlers running inline, it is when they were handled.
+func (r *Relay) CatchUp(ctx context.Context) error {
+	last, err := r.store.LastSeq(ctx)
+	if err != nil {
+		return fmt.Errorf("getting last record: %w", err)
+	}
+
+	for {
+		r.mu.Lock()
+		position, advanced := r.position, r.advanced
+		r.mu.Unlock()
+		if position >= last {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for record %d, published up to %d: %w", last, position, ctx.Err())
+		case <-advanced:
+		}
+	}
+}
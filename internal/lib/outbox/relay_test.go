@@ -0,0 +1,216 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/outbox"
+)
+
+type testMessage struct {
+	N int
+}
+
+func (testMessage) Kind() string {
+	return "Test"
+}
+
+// publisher records the messages published, failing the ones in failures as many times as told,
+// and the ones in deadLettered every time, as if moved to the dead letters
+type publisher struct {
+	failures     map[int]int
+	deadLettered map[int]bool
+	published    []int
+}
+
+func (p *publisher) PublishEnvelopes(_ context.Context, envs ...eventbus.Envelope) error {
+	for _, env := range envs {
+		n := env.Message.(testMessage).N
+		if p.failures[n] > 0 {
+			p.failures[n]--
+			return errors.New("publish failed")
+		}
+		p.published = append(p.published, n)
+		if p.deadLettered[n] {
+			return deadLettered()
+		}
+	}
+	return nil
+}
+
+// deadLettered returns the failure of a handler whose message was moved to the dead letters
+func deadLettered() error {
+	bus := eventbus.New(eventbus.WithDeadLetters(eventbus.NewMemoryDeadLetters()))
+	eventbus.Register(bus, func(context.Context, testMessage) error {
+		return errors.New("handler failed")
+	}, eventbus.WithName("failing"))
+	return bus.Publish(context.Background(), testMessage{})
+}
+
+// store fails marking records as dispatched as many times as told
+type store struct {
+	*outbox.MemoryStore
+	markFailures int
+}
+
+func (s *store) MarkDispatched(ctx context.Context, ids ...uuid.UUID) error {
+	if s.markFailures > 0 {
+		s.markFailures--
+		return errors.New("mark failed")
+	}
+	return s.MemoryStore.MarkDispatched(ctx, ids...)
+}
+
+func TestRelayFlush(t *testing.T) {
+	tests := []struct {
+		name         string
+		records      int
+		batchSize    int
+		failures     map[int]int
+		deadLettered map[int]bool
+		markFailures int
+		wantErr      bool
+		// wantPublished and wantPending are checked after the first flush, and wantRetried after a second one
+		wantPublished []int
+		wantPending   int
+		wantRetried   []int
+	}{
+		{
+			name:          "all published",
+			records:       3,
+			batchSize:     10,
+			wantPublished: []int{1, 2, 3},
+			wantRetried:   []int{1, 2, 3},
+		},
+		{
+			name:          "several batches",
+			records:       5,
+			batchSize:     2,
+			wantPublished: []int{1, 2, 3, 4, 5},
+			wantRetried:   []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:          "publish failure keeps the record and the ones after it",
+			records:       3,
+			batchSize:     10,
+			failures:      map[int]int{2: 1},
+			wantErr:       true,
+			wantPublished: []int{1},
+			wantPending:   2,
+			wantRetried:   []int{1, 2, 3},
+		},
+		{
+			name:          "failure moved to the dead letters is not published again",
+			records:       3,
+			batchSize:     10,
+			deadLettered:  map[int]bool{2: true},
+			wantPublished: []int{1, 2, 3},
+			wantRetried:   []int{1, 2, 3},
+		},
+		{
+			name:          "mark failure does not publish again",
+			records:       3,
+			batchSize:     10,
+			markFailures:  1,
+			wantErr:       true,
+			wantPublished: []int{1, 2, 3},
+			wantPending:   3,
+			wantRetried:   []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := &store{MemoryStore: outbox.NewMemoryStore(), markFailures: tt.markFailures}
+			for i := 1; i <= tt.records; i++ {
+				err := s.Add(ctx, eventbus.Wrap(ctx, uuid.Nil, 0, testMessage{N: i})...)
+				if err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			p := &publisher{failures: tt.failures, deadLettered: tt.deadLettered}
+			relay := outbox.NewRelay(s, p, outbox.WithBatchSize(tt.batchSize))
+
+			err := relay.Flush(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Flush() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(p.published, tt.wantPublished) {
+				t.Errorf("published = %v, want %v", p.published, tt.wantPublished)
+			}
+			lag, err := relay.Lag(ctx)
+			if err != nil {
+				t.Fatalf("Lag() error = %v", err)
+			}
+			if lag != uint64(tt.wantPending) {
+				t.Errorf("Lag() = %d, want %d", lag, tt.wantPending)
+			}
+
+			err = relay.Flush(ctx)
+			if err != nil {
+				t.Fatalf("second Flush() error = %v", err)
+			}
+			if !slices.Equal(p.published, tt.wantRetried) {
+				t.Errorf("published after retry = %v, want %v", p.published, tt.wantRetried)
+			}
+			pending, err := s.Pending(ctx, 100)
+			if err != nil {
+				t.Fatalf("Pending() error = %v", err)
+			}
+			if len(pending) != 0 {
+				t.Errorf("pending after retry = %d, want 0", len(pending))
+			}
+		})
+	}
+}
+
+func TestRelayCatchUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		flush   bool
+		wantLag uint64
+		wantErr error
+	}{
+		{name: "published", flush: true},
+		{name: "pending", wantLag: 2, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := outbox.NewMemoryStore()
+			err := s.Add(ctx, eventbus.Wrap(ctx, uuid.Nil, 0, testMessage{N: 1}, testMessage{N: 2})...)
+			if err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			relay := outbox.NewRelay(s, &publisher{})
+			if tt.flush {
+				err = relay.Flush(ctx)
+				if err != nil {
+					t.Fatalf("Flush() error = %v", err)
+				}
+			}
+
+			lag, err := relay.Lag(ctx)
+			if err != nil {
+				t.Fatalf("Lag() error = %v", err)
+			}
+			if lag != tt.wantLag {
+				t.Errorf("Lag() = %d, want %d", lag, tt.wantLag)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+			err = relay.CatchUp(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CatchUp() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
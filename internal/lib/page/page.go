@@ -0,0 +1,248 @@
+// Package page pages through lists sorted by a key, with opaque cursors.
+//
+// A cursor points to the last item of a page by its sort value and its ID, which breaks the ties,
+// so that the next page starts right after it even if items were added or removed in the meantime.
+package page
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort key")
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// Request asks for up to Limit items, sorted by the key Sort, after the item pointed by the cursor After, if any.
+type Request struct {
+	Sort  string
+	Desc  bool
+	After *Cursor
+	Limit int
+}
+
+// Page is a page of items, with the cursor to the next page, if there are more items.
+type Page[T any] struct {
+	Items []T
+	Next  *Cursor
+}
+
+// Cursor points to an item of a list sorted by the key Sort.
+type Cursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	// Value is the sort value of the item, formatted by the sort key
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// String encodes the cursor, to be handed to the clients.
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor encoded by String. An empty string is no cursor.
+func ParseCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decoding cursor: %w", ErrInvalidCursor)
+	}
+	var c Cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("decoding cursor: %w", ErrInvalidCursor)
+	}
+	return &c, nil
+}
+
+// Key is a sort key of the items of type T.
+type Key[T any] struct {
+	compare func(a, b T) int
+	format  func(v T) string
+	// compareTo compares the sort value of an item with one formatted in a cursor
+	compareTo func(v T, value string) (int, error)
+	arg       func(value string) (any, error)
+}
+
+// Value returns the sort value of v, as kept in cursors.
+func (k Key[T]) Value(v T) string {
+	return k.format(v)
+}
+
+// Arg parses the sort value kept in a cursor, eg: to be used as a query argument.
+func (k Key[T]) Arg(value string) (any, error) {
+	v, err := k.arg(value)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cursor value '%s': %w", value, ErrInvalidCursor)
+	}
+	return v, nil
+}
+
+func orderedKey[T any, V cmp.Ordered](value func(T) V, format func(V) string, parse func(string) (V, error), arg func(V) any) Key[T] {
+	return Key[T]{
+		compare: func(a, b T) int {
+			return cmp.Compare(value(a), value(b))
+		},
+		format: func(v T) string {
+			return format(value(v))
+		},
+		compareTo: func(v T, s string) (int, error) {
+			other, err := parse(s)
+			if err != nil {
+				return 0, err
+			}
+			return cmp.Compare(value(v), other), nil
+		},
+		arg: func(s string) (any, error) {
+			v, err := parse(s)
+			if err != nil {
+				return nil, err
+			}
+			return arg(v), nil
+		},
+	}
+}
+
+func StringKey[T any](value func(T) string) Key[T] {
+	return orderedKey(
+		value,
+		func(s string) string { return s },
+		func(s string) (string, error) { return s, nil },
+		func(s string) any { return s },
+	)
+}
+
+func FloatKey[T any](value func(T) float64) Key[T] {
+	return orderedKey(
+		value,
+		func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) },
+		func(s string) (float64, error) { return strconv.ParseFloat(s, 64) },
+		func(f float64) any { return f },
+	)
+}
+
+// TimeKey sorts by a time, to the nanosecond. The query argument is the time in UTC.
+func TimeKey[T any](value func(T) time.Time) Key[T] {
+	return orderedKey(
+		func(v T) int64 { return value(v).UnixNano() },
+		func(n int64) string { return strconv.FormatInt(n, 10) },
+		func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) },
+		func(n int64) any { return time.Unix(0, n).UTC() },
+	)
+}
+
+// Check validates the request against the sort keys, defaulting the sort key to def and the limit to DefaultLimit.
+// The cursor must come from a page sorted the same way.
+func Check[T any](r Request, keys map[string]Key[T], def string) (Request, error) {
+	if r.Sort == "" {
+		r.Sort = def
+	}
+	if _, ok := keys[r.Sort]; !ok {
+		return r, fmt.Errorf("'%s', expected one of %v: %w", r.Sort, slices.Sorted(maps.Keys(keys)), ErrInvalidSort)
+	}
+	if r.After != nil && (r.After.Sort != r.Sort || r.After.Desc != r.Desc) {
+		return r, fmt.Errorf("cursor is for a different sort: %w", ErrInvalidCursor)
+	}
+
+	switch {
+	case r.Limit <= 0:
+		r.Limit = DefaultLimit
+	case r.Limit > MaxLimit:
+		r.Limit = MaxLimit
+	}
+	return r, nil
+}
+
+// Slice returns the page of items asked by r, from all the items, in any order.
+// The request must have been checked.
+func Slice[T any](items []T, r Request, keys map[string]Key[T], id func(T) uuid.UUID) (Page[T], error) {
+	key := keys[r.Sort]
+	compare := func(a, b T) int {
+		c := key.compare(a, b)
+		if c == 0 {
+			c = compareIDs(id(a), id(b))
+		}
+		if r.Desc {
+			return -c
+		}
+		return c
+	}
+	slices.SortFunc(items, compare)
+
+	start := 0
+	if r.After != nil {
+		var err error
+		start, err = after(items, r, key, id)
+		if err != nil {
+			return Page[T]{}, err
+		}
+	}
+
+	return Of(items[start:], r, key, id), nil
+}
+
+// after returns the index of the first item after the cursor of r, in items sorted as asked by r
+func after[T any](items []T, r Request, key Key[T], id func(T) uuid.UUID) (int, error) {
+	for i, v := range items {
+		c, err := key.compareTo(v, r.After.Value)
+		if err != nil {
+			return 0, fmt.Errorf("parsing cursor value '%s': %w", r.After.Value, ErrInvalidCursor)
+		}
+		if c == 0 {
+			c = compareIDs(id(v), r.After.ID)
+		}
+		if r.Desc {
+			c = -c
+		}
+		if c > 0 {
+			return i, nil
+		}
+	}
+	return len(items), nil
+}
+
+// Of returns the page made of the first items, sorted as asked by r and starting after its cursor.
+// There is a next page if there are more than r.Limit items, so it is enough to read r.Limit + 1 items.
+func Of[T any](items []T, r Request, key Key[T], id func(T) uuid.UUID) Page[T] {
+	if len(items) <= r.Limit {
+		return Page[T]{Items: items}
+	}
+
+	items = items[:r.Limit]
+	last := items[len(items)-1]
+	return Page[T]{
+		Items: items,
+		Next: &Cursor{
+			Sort:  r.Sort,
+			Desc:  r.Desc,
+			Value: key.Value(last),
+			ID:    id(last),
+		},
+	}
+}
+
+// compareIDs orders the IDs as their text, as databases do
+func compareIDs(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
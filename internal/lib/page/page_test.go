@@ -0,0 +1,203 @@
+package page_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/quintans/vertical-slices/internal/lib/page"
+)
+
+type item struct {
+	ID    uuid.UUID
+	Name  string
+	Price float64
+}
+
+var keys = map[string]page.Key[item]{
+	"name":  page.StringKey(func(i item) string { return i.Name }),
+	"price": page.FloatKey(func(i item) float64 { return i.Price }),
+}
+
+func itemID(i item) uuid.UUID {
+	return i.ID
+}
+
+// id returns an ID ordered by n
+func id(n int) uuid.UUID {
+	return uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", n))
+}
+
+// items returns the items with IDs 1 to 5, where 2, 3 and 4 have the same price
+func items() []item {
+	return []item{
+		{ID: id(3), Name: "c", Price: 2},
+		{ID: id(1), Name: "a", Price: 1},
+		{ID: id(5), Name: "e", Price: 3},
+		{ID: id(4), Name: "d", Price: 2},
+		{ID: id(2), Name: "b", Price: 2},
+	}
+}
+
+func names(items []item) []string {
+	var names []string
+	for _, i := range items {
+		names = append(names, i.Name)
+	}
+	return names
+}
+
+func TestSlice(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       page.Request
+		wantPages [][]string
+	}{
+		{
+			name:      "by name",
+			req:       page.Request{Sort: "name", Limit: 2},
+			wantPages: [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+		},
+		{
+			name:      "by name descending",
+			req:       page.Request{Sort: "name", Desc: true, Limit: 2},
+			wantPages: [][]string{{"e", "d"}, {"c", "b"}, {"a"}},
+		},
+		{
+			name:      "ties broken by the ID",
+			req:       page.Request{Sort: "price", Limit: 2},
+			wantPages: [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+		},
+		{
+			name:      "ties broken by the ID descending",
+			req:       page.Request{Sort: "price", Desc: true, Limit: 3},
+			wantPages: [][]string{{"e", "d", "c"}, {"b", "a"}},
+		},
+		{
+			name:      "exact last page",
+			req:       page.Request{Sort: "name", Limit: 5},
+			wantPages: [][]string{{"a", "b", "c", "d", "e"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := page.Check(tt.req, keys, "name")
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			var pages [][]string
+			for {
+				p, err := page.Slice(items(), req, keys, itemID)
+				if err != nil {
+					t.Fatalf("Slice() error = %v", err)
+				}
+				pages = append(pages, names(p.Items))
+				if p.Next == nil {
+					break
+				}
+				// the cursor goes through the clients
+				req.After, err = page.ParseCursor(p.Next.String())
+				if err != nil {
+					t.Fatalf("ParseCursor() error = %v", err)
+				}
+			}
+			if !slices.EqualFunc(pages, tt.wantPages, slices.Equal) {
+				t.Errorf("pages = %v, want %v", pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestSliceAfterChanges(t *testing.T) {
+	req := page.Request{Sort: "name", Limit: 2}
+	first, err := page.Slice(items(), req, keys, itemID)
+	if err != nil {
+		t.Fatalf("Slice() error = %v", err)
+	}
+
+	// b, the last item of the first page, is removed and an item is added before it
+	var changed []item
+	for _, i := range items() {
+		if i.Name != "b" {
+			changed = append(changed, i)
+		}
+	}
+	changed = append(changed, item{ID: id(6), Name: "aa"})
+
+	req.After = first.Next
+	next, err := page.Slice(changed, req, keys, itemID)
+	if err != nil {
+		t.Fatalf("Slice() error = %v", err)
+	}
+	if got := names(next.Items); !slices.Equal(got, []string{"c", "d"}) {
+		t.Errorf("next page = %v, want [c d]", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cursor := &page.Cursor{Sort: "name", Value: "b", ID: id(2)}
+
+	tests := []struct {
+		name    string
+		req     page.Request
+		want    page.Request
+		wantErr error
+	}{
+		{name: "defaults", want: page.Request{Sort: "name", Limit: page.DefaultLimit}},
+		{name: "limit capped", req: page.Request{Sort: "price", Limit: page.MaxLimit + 1}, want: page.Request{Sort: "price", Limit: page.MaxLimit}},
+		{name: "unknown sort key", req: page.Request{Sort: "colour"}, wantErr: page.ErrInvalidSort},
+		{name: "cursor of another sort key", req: page.Request{Sort: "price", After: cursor}, wantErr: page.ErrInvalidCursor},
+		{name: "cursor of another direction", req: page.Request{Sort: "name", Desc: true, After: cursor}, wantErr: page.ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := page.Check(tt.req, keys, "name")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("Check() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		want    *page.Cursor
+		wantErr error
+	}{
+		{name: "none"},
+		{name: "valid", cursor: page.Cursor{Sort: "price", Desc: true, Value: "2", ID: id(3)}.String(), want: &page.Cursor{Sort: "price", Desc: true, Value: "2", ID: id(3)}},
+		{name: "not base64", cursor: "%%%", wantErr: page.ErrInvalidCursor},
+		{name: "not JSON", cursor: "bm90IGpzb24", wantErr: page.ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := page.ParseCursor(tt.cursor)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseCursor() error = %v, want %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("ParseCursor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSliceInvalidCursorValue(t *testing.T) {
+	req := page.Request{Sort: "price", Limit: 2, After: &page.Cursor{Sort: "price", Value: "cheap", ID: id(1)}}
+
+	_, err := page.Slice(items(), req, keys, itemID)
+	if !errors.Is(err, page.ErrInvalidCursor) {
+		t.Errorf("Slice() error = %v, want %v", err, page.ErrInvalidCursor)
+	}
+}
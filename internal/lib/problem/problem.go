@@ -0,0 +1,135 @@
+package problem
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Problem is an error response body as defined by RFC 9457 Problem Details for HTTP APIs,
+// extended with a stable error code that clients can rely on.
+type Problem struct {
+	Type     string              `json:"type,omitempty" format:"uri" default:"about:blank" doc:"URI reference identifying the problem type"`
+	Title    string              `json:"title,omitempty" example:"Not Found" doc:"Short, human-readable summary of the problem type"`
+	Status   int                 `json:"status,omitempty" example:"404" doc:"HTTP status code"`
+	Detail   string              `json:"detail,omitempty" doc:"Human-readable explanation specific to this occurrence of the problem"`
+	Instance string              `json:"instance,omitempty" format:"uri" doc:"URI reference identifying this occurrence of the problem"`
+	Code     string              `json:"code" example:"not_found" doc:"Stable error code"`
+	Errors   []*huma.ErrorDetail `json:"errors,omitempty" doc:"Optional list of individual error details"`
+}
+
+func (p *Problem) Error() string {
+	return p.Detail
+}
+
+func (p *Problem) GetStatus() int {
+	return p.Status
+}
+
+func (p *Problem) ContentType(ct string) string {
+	switch ct {
+	case "application/json":
+		return "application/problem+json"
+	case "application/cbor":
+		return "application/problem+cbor"
+	}
+	return ct
+}
+
+type mapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// Mapper translates the errors returned by the handlers into problem details.
+// The errors that are not mapped are reported as internal errors.
+type Mapper struct {
+	mappings []mapping
+}
+
+func NewMapper() *Mapper {
+	return &Mapper{}
+}
+
+// Map translates err, and any error wrapping it, into a problem with the given status and code.
+// The first mapping matching an error wins.
+func (m *Mapper) Map(err error, status int, code string) {
+	m.mappings = append(m.mappings, mapping{err: err, status: status, code: code})
+}
+
+// Install makes huma report every error as a problem, translated by the mapper.
+// It must be called before registering the operations, since huma builds the error schema from it.
+func (m *Mapper) Install() {
+	huma.NewError = func(status int, msg string, errs ...error) huma.StatusError {
+		return m.problem(nil, status, msg, errs...)
+	}
+	huma.NewErrorWithContext = m.problem
+}
+
+func (m *Mapper) problem(ctx huma.Context, status int, msg string, errs ...error) huma.StatusError {
+	p := &Problem{
+		Status: status,
+		Detail: msg,
+	}
+	if ctx != nil {
+		p.Instance = ctx.URL().Path
+	}
+
+	if status == http.StatusInternalServerError {
+		if mp, err, ok := m.lookup(errs); ok {
+			p.Status = mp.status
+			p.Title = http.StatusText(mp.status)
+			p.Detail = err.Error()
+			p.Code = mp.code
+			return p
+		}
+
+		// the internals of unexpected errors are logged but not disclosed
+		if ctx != nil {
+			slog.ErrorContext(ctx.Context(), msg, "path", p.Instance, "error", errors.Join(errs...))
+		} else {
+			slog.Error(msg, "error", errors.Join(errs...))
+		}
+		p.Title = http.StatusText(status)
+		p.Code = "internal_error"
+		return p
+	}
+
+	p.Title = http.StatusText(status)
+	p.Code = codeOf(status)
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if d, ok := err.(huma.ErrorDetailer); ok {
+			p.Errors = append(p.Errors, d.ErrorDetail())
+		} else {
+			p.Errors = append(p.Errors, &huma.ErrorDetail{Message: err.Error()})
+		}
+	}
+	return p
+}
+
+func (m *Mapper) lookup(errs []error) (mapping, error, bool) {
+	for _, err := range errs {
+		for _, mp := range m.mappings {
+			if errors.Is(err, mp.err) {
+				return mp, err, true
+			}
+		}
+	}
+	return mapping{}, nil, false
+}
+
+// codeOf derives an error code from the status text, eg: 422 becomes unprocessable_entity
+func codeOf(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
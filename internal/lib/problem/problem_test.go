@@ -0,0 +1,93 @@
+package problem_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/quintans/vertical-slices/internal/lib/problem"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errConflict = errors.New("conflict")
+)
+
+func TestMapper(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		msg        string
+		errs       []error
+		want       problem.Problem
+		wantErrors int
+	}{
+		{
+			name:   "mapped error",
+			status: http.StatusInternalServerError,
+			msg:    "unexpected",
+			errs:   []error{errNotFound},
+			want:   problem.Problem{Status: http.StatusNotFound, Title: "Not Found", Detail: "not found", Code: "not_found"},
+		},
+		{
+			name:   "wrapped error",
+			status: http.StatusInternalServerError,
+			msg:    "unexpected",
+			errs:   []error{fmt.Errorf("order 1: %w", errNotFound)},
+			want:   problem.Problem{Status: http.StatusNotFound, Title: "Not Found", Detail: "order 1: not found", Code: "not_found"},
+		},
+		{
+			name:   "first mapping wins",
+			status: http.StatusInternalServerError,
+			msg:    "unexpected",
+			errs:   []error{errors.Join(errConflict, errNotFound)},
+			want:   problem.Problem{Status: http.StatusNotFound, Title: "Not Found", Detail: "conflict\nnot found", Code: "not_found"},
+		},
+		{
+			name:   "unmapped error is not disclosed",
+			status: http.StatusInternalServerError,
+			msg:    "unexpected",
+			errs:   []error{errors.New("connection refused")},
+			want:   problem.Problem{Status: http.StatusInternalServerError, Title: "Internal Server Error", Detail: "unexpected", Code: "internal_error"},
+		},
+		{
+			name:       "error raised by huma",
+			status:     http.StatusUnprocessableEntity,
+			msg:        "validation failed",
+			errs:       []error{&huma.ErrorDetail{Message: "expected number", Location: "body.price"}, errors.New("too long")},
+			want:       problem.Problem{Status: http.StatusUnprocessableEntity, Title: "Unprocessable Entity", Detail: "validation failed", Code: "unprocessable_entity"},
+			wantErrors: 2,
+		},
+	}
+
+	m := problem.NewMapper()
+	m.Map(errNotFound, http.StatusNotFound, "not_found")
+	m.Map(errConflict, http.StatusConflict, "conflict")
+
+	newError, newErrorWithContext := huma.NewError, huma.NewErrorWithContext
+	t.Cleanup(func() {
+		huma.NewError, huma.NewErrorWithContext = newError, newErrorWithContext
+	})
+	m.Install()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := huma.NewError(tt.status, tt.msg, tt.errs...)
+
+			var p *problem.Problem
+			if !errors.As(err, &p) {
+				t.Fatalf("NewError() = %T, want a problem", err)
+			}
+			if len(p.Errors) != tt.wantErrors {
+				t.Errorf("errors = %v, want %d", p.Errors, tt.wantErrors)
+			}
+			p.Errors = nil
+			if !reflect.DeepEqual(*p, tt.want) {
+				t.Errorf("NewError() = %+v, want %+v", *p, tt.want)
+			}
+		})
+	}
+}
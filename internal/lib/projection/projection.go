@@ -0,0 +1,91 @@
+// Package projection keeps track of the read models built from the events, the projections,
+// so that they can be rebuilt and their lag checked.
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknown = errors.New("unknown projection")
+	// ErrLagging is returned when a read model did not catch up with the changes in time
+	ErrLagging = errors.New("read model lagging behind")
+)
+
+// Projection keeps a read model up to date with the events.
+type Projection interface {
+	Name() string
+	// Rebuild discards the read model and builds it again from the source of truth.
+	// The events handled meanwhile must not be lost.
+	Rebuild(ctx context.Context) error
+}
+
+// Checkpoint tells how far behind the events the projections are.
+type Checkpoint interface {
+	// Lag returns the number of changes committed that were not handled yet
+	Lag(ctx context.Context) (uint64, error)
+	// CatchUp waits for the changes committed so far to be handled, or for the context to be done
+	CatchUp(ctx context.Context) error
+}
+
+// Wait waits up to timeout for the projections to catch up with the changes committed so far,
+// failing with ErrLagging if they did not.
+func Wait(ctx context.Context, cp Checkpoint, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := cp.CatchUp(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrLagging, err)
+	}
+	return err
+}
+
+// Registry holds the projections of every module, by name.
+type Registry struct {
+	mu          sync.RWMutex
+	projections map[string]Projection
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		projections: make(map[string]Projection),
+	}
+}
+
+func (r *Registry) Add(p Projection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.projections[p.Name()] = p
+}
+
+// Names returns the names of the projections, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(r.projections))
+}
+
+// Rebuild rebuilds the projection name, failing with ErrUnknown if there is none.
+func (r *Registry) Rebuild(ctx context.Context, name string) error {
+	r.mu.RLock()
+	p, ok := r.projections[name]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("'%s': %w", name, ErrUnknown)
+	}
+
+	err := p.Rebuild(ctx)
+	if err != nil {
+		return fmt.Errorf("rebuilding projection '%s': %w", name, err)
+	}
+	return nil
+}
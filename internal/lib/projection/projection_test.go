@@ -0,0 +1,101 @@
+package projection_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/projection"
+)
+
+var errRebuild = errors.New("rebuild failed")
+
+type fake struct {
+	name    string
+	err     error
+	rebuilt int
+}
+
+func (f *fake) Name() string {
+	return f.name
+}
+
+func (f *fake) Rebuild(context.Context) error {
+	f.rebuilt++
+	return f.err
+}
+
+func TestRebuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		projection  string
+		wantErr     error
+		wantRebuilt int
+	}{
+		{name: "rebuilt", projection: "orders", wantRebuilt: 1},
+		{name: "failed", projection: "broken", wantErr: errRebuild},
+		{name: "unknown", projection: "products", wantErr: projection.ErrUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders := &fake{name: "orders"}
+			r := projection.NewRegistry()
+			r.Add(orders)
+			r.Add(&fake{name: "broken", err: errRebuild})
+
+			if got := r.Names(); !slices.Equal(got, []string{"broken", "orders"}) {
+				t.Errorf("Names() = %v, want [broken orders]", got)
+			}
+			err := r.Rebuild(context.Background(), tt.projection)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Rebuild() error = %v, want %v", err, tt.wantErr)
+			}
+			if orders.rebuilt != tt.wantRebuilt {
+				t.Errorf("orders rebuilt %d times, want %d", orders.rebuilt, tt.wantRebuilt)
+			}
+		})
+	}
+}
+
+// checkpoint catches up after the delay, or fails with err
+type checkpoint struct {
+	delay time.Duration
+	err   error
+}
+
+func (c checkpoint) Lag(context.Context) (uint64, error) {
+	return 0, nil
+}
+
+func (c checkpoint) CatchUp(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.delay):
+		return c.err
+	}
+}
+
+func TestWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint checkpoint
+		wantErr    error
+	}{
+		{name: "caught up", checkpoint: checkpoint{}},
+		{name: "lagging", checkpoint: checkpoint{delay: time.Hour}, wantErr: projection.ErrLagging},
+		{name: "failed", checkpoint: checkpoint{err: errRebuild}, wantErr: errRebuild},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := projection.Wait(context.Background(), tt.checkpoint, 20*time.Millisecond)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Wait() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+type key struct {
+	saga string
+	id   string
+}
+
+// MemoryStore is an in memory Store
+type MemoryStore struct {
+	mu     sync.RWMutex
+	states map[key]State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[key]State),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, saga, id string) (State, error) {
+	k := key{saga: saga, id: id}
+	if tx, ok := s.tx(ctx); ok {
+		if st, ok := tx.writes[k]; ok {
+			return clone(st), nil
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, ok := s.states[k]
+	if !ok {
+		return State{}, fmt.Errorf("%s %s: %w", saga, id, ErrNotFound)
+	}
+	return clone(st), nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, st State) error {
+	k := key{saga: st.Saga, id: st.ID}
+	if tx, ok := s.tx(ctx); ok {
+		if prev, ok := tx.writes[k]; ok {
+			// saved again in the same unit of work
+			if prev.Version != st.Version {
+				return fmt.Errorf("%s %s: %w", st.Saga, st.ID, ErrConflict)
+			}
+		} else {
+			tx.base[k] = st.Version
+			st.Version++
+		}
+		tx.writes[k] = clone(st)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.check(k, st.Version)
+	if err != nil {
+		return err
+	}
+	st.Version++
+	s.states[k] = clone(st)
+	return nil
+}
+
+func (s *MemoryStore) Expired(_ context.Context, saga string, now time.Time) ([]State, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var expired []State
+	for k, st := range s.states {
+		if k.saga == saga && st.Status == StatusRunning && !st.Deadline.IsZero() && !st.Deadline.After(now) {
+			expired = append(expired, clone(st))
+		}
+	}
+	return expired, nil
+}
+
+// check fails if the stored version is not version. Must be called with the lock held.
+func (s *MemoryStore) check(k key, version int) error {
+	stored, ok := s.states[k]
+	if (!ok && version != 0) || (ok && stored.Version != version) {
+		return fmt.Errorf("%s %s: %w", k.saga, k.id, ErrConflict)
+	}
+	return nil
+}
+
+func (s *MemoryStore) tx(ctx context.Context) (*staging, bool) {
+	return uow.Enlist(ctx, s, func() *staging {
+		return &staging{
+			store:  s,
+			writes: make(map[key]State),
+			base:   make(map[key]int),
+		}
+	})
+}
+
+func clone(st State) State {
+	st.Data = slices.Clone(st.Data)
+	st.Compensations = slices.Clone(st.Compensations)
+	return st
+}
+
+// staging holds the states saved during a unit of work
+type staging struct {
+	store  *MemoryStore
+	writes map[key]State
+	// base is the version each state had when it was first saved in the unit of work
+	base map[key]int
+}
+
+func (s *staging) Lock() {
+	s.store.mu.Lock()
+}
+
+func (s *staging) Unlock() {
+	s.store.mu.Unlock()
+}
+
+func (s *staging) Prepare() error {
+	for k, version := range s.base {
+		err := s.store.check(k, version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *staging) Commit() error {
+	for k, st := range s.writes {
+		s.store.states[k] = st
+	}
+	return nil
+}
+
+func (s *staging) Rollback() {}
@@ -0,0 +1,339 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+var (
+	ErrNotFound = errors.New("saga instance not found")
+	// ErrConflict is returned when saving an instance that was changed since it was read
+	ErrConflict = errors.New("saga instance changed concurrently")
+)
+
+type Status string
+
+const (
+	StatusRunning     Status = "running"
+	StatusCompleted   Status = "completed"
+	StatusCompensated Status = "compensated"
+)
+
+// State is the persisted state of a saga instance.
+type State struct {
+	Saga   string
+	ID     string
+	Step   string
+	Status Status
+	Data   json.RawMessage
+	// Deadline is when the timeout of the saga fires, if not zero
+	Deadline time.Time
+	// Compensations are the names of the compensations to run, in the order they were added
+	Compensations []string
+	// Error is the cause of the compensation
+	Error     string
+	Version   int
+	UpdatedAt time.Time
+}
+
+// Store persists the state of saga instances.
+// When the context carries a unit of work, the changes are only saved if it commits.
+type Store interface {
+	// Get fails with ErrNotFound if there is no instance.
+	Get(ctx context.Context, saga, id string) (State, error)
+	// Save creates the instance if its version is zero, or updates it if the stored version is still the same,
+	// failing with ErrConflict otherwise. The stored version is incremented.
+	Save(ctx context.Context, s State) error
+	// Expired returns the running instances whose deadline has passed.
+	Expired(ctx context.Context, saga string, now time.Time) ([]State, error)
+}
+
+// Saga is a workflow whose steps react to messages, issuing commands, and whose state D is persisted between steps.
+// When a step cannot go on, the compensations added by the previous steps are run, newest first, to undo what they did.
+//
+// Every step runs in a unit of work, with the commands it issues and the saving of the state,
+// so that the commands and the state are saved together, or not at all and the message is retried.
+// A step returning Fail is rolled back and the compensations run in a new unit of work.
+type Saga[D any] struct {
+	name          string
+	store         Store
+	compensations map[string]func(ctx context.Context, inst *Instance[D]) error
+	timeout       func(ctx context.Context, inst *Instance[D]) error
+}
+
+func New[D any](name string, store Store) *Saga[D] {
+	return &Saga[D]{
+		name:          name,
+		store:         store,
+		compensations: make(map[string]func(ctx context.Context, inst *Instance[D]) error),
+	}
+}
+
+func (s *Saga[D]) Name() string {
+	return s.name
+}
+
+// Compensation registers the compensation that steps can add by name.
+func (s *Saga[D]) Compensation(name string, fn func(ctx context.Context, inst *Instance[D]) error) {
+	s.compensations[name] = fn
+}
+
+// OnTimeout sets what to do when the deadline of a running instance passes, usually compensating.
+func (s *Saga[D]) OnTimeout(fn func(ctx context.Context, inst *Instance[D]) error) {
+	s.timeout = fn
+}
+
+// Start returns a handler that starts an instance, correlated to the message by correlate, with the step fn.
+// A message for an instance that was already started is ignored.
+func Start[D any, T eventbus.Message](s *Saga[D], correlate func(T) string, fn func(ctx context.Context, inst *Instance[D], m T) error) eventbus.Handler[T] {
+	return func(ctx context.Context, m T) error {
+		return s.step(ctx, correlate(m), true, func(ctx context.Context, inst *Instance[D]) error {
+			return fn(ctx, inst, m)
+		})
+	}
+}
+
+// On returns a handler that runs the step fn on the instance correlated to the message by correlate.
+// A message for an instance that is no longer running is ignored, and one for an instance that was not started yet,
+// eg: handled before the message starting it, fails with ErrNotFound, to be retried.
+func On[D any, T eventbus.Message](s *Saga[D], correlate func(T) string, fn func(ctx context.Context, inst *Instance[D], m T) error) eventbus.Handler[T] {
+	return func(ctx context.Context, m T) error {
+		return s.step(ctx, correlate(m), false, func(ctx context.Context, inst *Instance[D]) error {
+			return fn(ctx, inst, m)
+		})
+	}
+}
+
+// Fail is returned by a step that cannot go on because of cause.
+// The changes of the step are rolled back and the saga is compensated, in a new unit of work.
+func Fail(cause error) error {
+	return &failure{cause: cause}
+}
+
+type failure struct {
+	cause error
+}
+
+func (f *failure) Error() string {
+	return f.cause.Error()
+}
+
+func (f *failure) Unwrap() error {
+	return f.cause
+}
+
+// step runs fn on the running instance id, and saves it, in a unit of work.
+// If start is true the instance is created, unless it already exists.
+// The steps must not be called in a unit of work, otherwise a failed step could not be rolled back before compensating.
+func (s *Saga[D]) step(ctx context.Context, id string, start bool, fn func(ctx context.Context, inst *Instance[D]) error) error {
+	var fail *failure
+	err := uow.Run(ctx, func(ctx context.Context) error {
+		inst, ok, err := s.running(ctx, id, start)
+		if err != nil || !ok {
+			return err
+		}
+
+		err = fn(ctx, inst)
+		if err != nil {
+			return err
+		}
+		return s.save(ctx, inst)
+	})
+	if !errors.As(err, &fail) {
+		return err
+	}
+
+	return uow.Run(ctx, func(ctx context.Context) error {
+		inst, ok, err := s.running(ctx, id, start)
+		if err != nil || !ok {
+			return err
+		}
+
+		err = inst.Compensate(ctx, fail.cause)
+		if err != nil {
+			return err
+		}
+		return s.save(ctx, inst)
+	})
+}
+
+// running returns the instance id if it is running, or a new one if start is true and the instance does not exist.
+// It fails with ErrNotFound if start is false and the instance does not exist.
+func (s *Saga[D]) running(ctx context.Context, id string, start bool) (*Instance[D], bool, error) {
+	inst, err := s.load(ctx, id)
+	if errors.Is(err, ErrNotFound) && start {
+		return &Instance[D]{
+			ID:   id,
+			saga: s,
+			state: State{
+				Saga:   s.name,
+				ID:     id,
+				Status: StatusRunning,
+			},
+		}, true, nil
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, fmt.Errorf("%s %s not started: %w", s.name, id, err)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	// a message redelivered after the instance was started, or for an instance that already ended
+	if start || inst.state.Status != StatusRunning {
+		return nil, false, nil
+	}
+	return inst, true, nil
+}
+
+// RunTimeouts fires the timeouts of the instances whose deadline passed, periodically, until ctx is done.
+func (s *Saga[D]) RunTimeouts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.FireTimeouts(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "firing saga timeouts", "saga", s.name, "error", err)
+			}
+		}
+	}
+}
+
+// FireTimeouts fires the timeouts of the instances whose deadline passed, each as a step of its own.
+func (s *Saga[D]) FireTimeouts(ctx context.Context) error {
+	if s.timeout == nil {
+		return nil
+	}
+
+	now := time.Now()
+	expired, err := s.store.Expired(ctx, s.name, now)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, st := range expired {
+		err := s.step(ctx, st.ID, false, func(ctx context.Context, inst *Instance[D]) error {
+			// it may have moved on since it was listed
+			if inst.state.Deadline.IsZero() || inst.state.Deadline.After(now) {
+				return nil
+			}
+			inst.ClearDeadline()
+			return s.timeout(ctx, inst)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("timeout of %s %s: %w", s.name, st.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Saga[D]) load(ctx context.Context, id string) (*Instance[D], error) {
+	st, err := s.store.Get(ctx, s.name, id)
+	if err != nil {
+		return nil, err
+	}
+
+	inst := &Instance[D]{
+		ID:    id,
+		saga:  s,
+		state: st,
+	}
+	if len(st.Data) > 0 {
+		err = json.Unmarshal(st.Data, &inst.Data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding data of %s %s: %w", s.name, id, err)
+		}
+	}
+	return inst, nil
+}
+
+func (s *Saga[D]) save(ctx context.Context, inst *Instance[D]) error {
+	data, err := json.Marshal(inst.Data)
+	if err != nil {
+		return fmt.Errorf("encoding data of %s %s: %w", s.name, inst.ID, err)
+	}
+	inst.state.Data = data
+	inst.state.UpdatedAt = time.Now().UTC()
+
+	return s.store.Save(ctx, inst.state)
+}
+
+// Instance is a running saga, with its data.
+type Instance[D any] struct {
+	ID   string
+	Data D
+
+	saga  *Saga[D]
+	state State
+}
+
+func (i *Instance[D]) Step() string {
+	return i.state.Step
+}
+
+func (i *Instance[D]) Status() Status {
+	return i.state.Status
+}
+
+// GoTo records the step the saga is at
+func (i *Instance[D]) GoTo(step string) {
+	i.state.Step = step
+}
+
+// SetDeadline sets when the timeout of the saga fires, if it is still running.
+func (i *Instance[D]) SetDeadline(deadline time.Time) {
+	i.state.Deadline = deadline.UTC()
+}
+
+func (i *Instance[D]) ClearDeadline() {
+	i.state.Deadline = time.Time{}
+}
+
+// AddCompensation adds the registered compensation name, to be run if the saga compensates.
+func (i *Instance[D]) AddCompensation(name string) {
+	i.state.Compensations = append(i.state.Compensations, name)
+}
+
+// Complete ends the saga successfully.
+func (i *Instance[D]) Complete() {
+	i.state.Status = StatusCompleted
+	i.state.Compensations = nil
+	i.ClearDeadline()
+}
+
+// Compensate runs the compensations added so far, newest first, and ends the saga because of cause.
+// If a compensation fails, the error is returned so that the step is retried.
+// A step that failed, and whose changes must be rolled back first, should return Fail instead.
+func (i *Instance[D]) Compensate(ctx context.Context, cause error) error {
+	for j := len(i.state.Compensations) - 1; j >= 0; j-- {
+		name := i.state.Compensations[j]
+		fn, ok := i.saga.compensations[name]
+		if !ok {
+			return fmt.Errorf("unknown compensation '%s' of %s", name, i.saga.name)
+		}
+
+		err := fn(ctx, i)
+		if err != nil {
+			return fmt.Errorf("compensating %s %s with '%s': %w", i.saga.name, i.ID, name, err)
+		}
+	}
+
+	slog.InfoContext(ctx, "saga compensated", "saga", i.saga.name, "id", i.ID, "step", i.state.Step, "cause", cause)
+	i.state.Status = StatusCompensated
+	i.state.Compensations = nil
+	i.state.Error = cause.Error()
+	i.ClearDeadline()
+	return nil
+}
@@ -0,0 +1,268 @@
+package saga_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/quintans/vertical-slices/internal/lib/saga"
+)
+
+var errStep = errors.New("step failed")
+
+type stepped struct {
+	ID   string
+	Step string
+	Fail bool
+}
+
+func (stepped) Kind() string {
+	return "Stepped"
+}
+
+type data struct {
+	Steps []string
+}
+
+// harness runs a saga whose steps record their name and add a compensation undoing them
+type harness struct {
+	store  *saga.MemoryStore
+	saga   *saga.Saga[data]
+	start  func(ctx context.Context, m stepped) error
+	on     func(ctx context.Context, m stepped) error
+	undone []string
+	// failures is how many times each compensation fails before succeeding
+	failures map[string]int
+}
+
+func newHarness() *harness {
+	h := &harness{
+		store:    saga.NewMemoryStore(),
+		failures: map[string]int{},
+	}
+	h.saga = saga.New[data]("test", h.store)
+
+	for _, name := range []string{"undo-a", "undo-b"} {
+		h.saga.Compensation(name, func(context.Context, *saga.Instance[data]) error {
+			if h.failures[name] > 0 {
+				h.failures[name]--
+				return errors.New("compensation failed")
+			}
+			h.undone = append(h.undone, name)
+			return nil
+		})
+	}
+	h.saga.OnTimeout(func(ctx context.Context, inst *saga.Instance[data]) error {
+		return inst.Compensate(ctx, errors.New("timed out"))
+	})
+
+	correlate := func(m stepped) string { return m.ID }
+	step := func(_ context.Context, inst *saga.Instance[data], m stepped) error {
+		inst.Data.Steps = append(inst.Data.Steps, m.Step)
+		inst.GoTo(m.Step)
+		if m.Fail {
+			return saga.Fail(errStep)
+		}
+		if m.Step == "done" {
+			inst.Complete()
+			return nil
+		}
+		inst.AddCompensation("undo-" + m.Step)
+		return nil
+	}
+	h.start = saga.Start(h.saga, correlate, step)
+	h.on = saga.On(h.saga, correlate, step)
+	return h
+}
+
+func (h *harness) state(t *testing.T, id string) (saga.State, data) {
+	t.Helper()
+
+	st, err := h.store.Get(context.Background(), "test", id)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	var d data
+	err = json.Unmarshal(st.Data, &d)
+	if err != nil {
+		t.Fatalf("decoding data: %v", err)
+	}
+	return st, d
+}
+
+type delivery struct {
+	start   bool
+	step    string
+	fail    bool
+	wantErr bool
+}
+
+func TestSteps(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   map[string]int
+		deliveries []delivery
+		wantStatus saga.Status
+		wantSteps  []string
+		wantUndone []string
+		wantError  string
+	}{
+		{
+			name:       "completed",
+			deliveries: []delivery{{start: true, step: "a"}, {step: "b"}, {step: "done"}},
+			wantStatus: saga.StatusCompleted,
+			wantSteps:  []string{"a", "b", "done"},
+		},
+		{
+			name:       "failed step is rolled back and compensated newest first",
+			deliveries: []delivery{{start: true, step: "a"}, {step: "b"}, {step: "c", fail: true}},
+			wantStatus: saga.StatusCompensated,
+			wantSteps:  []string{"a", "b"},
+			wantUndone: []string{"undo-b", "undo-a"},
+			wantError:  errStep.Error(),
+		},
+		{
+			name:       "start redelivered",
+			deliveries: []delivery{{start: true, step: "a"}, {start: true, step: "a"}},
+			wantStatus: saga.StatusRunning,
+			wantSteps:  []string{"a"},
+		},
+		{
+			name:       "message for an ended instance",
+			deliveries: []delivery{{start: true, step: "a"}, {step: "done"}, {step: "b"}},
+			wantStatus: saga.StatusCompleted,
+			wantSteps:  []string{"a", "done"},
+		},
+		{
+			name:     "failed compensation is retried",
+			failures: map[string]int{"undo-a": 1},
+			deliveries: []delivery{
+				{start: true, step: "a"},
+				{step: "b", fail: true, wantErr: true},
+				{step: "b", fail: true},
+			},
+			wantStatus: saga.StatusCompensated,
+			wantSteps:  []string{"a"},
+			wantUndone: []string{"undo-a"},
+			wantError:  errStep.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h := newHarness()
+			maps.Copy(h.failures, tt.failures)
+
+			for i, d := range tt.deliveries {
+				handle := h.on
+				if d.start {
+					handle = h.start
+				}
+				err := handle(ctx, stepped{ID: "1", Step: d.step, Fail: d.fail})
+				if (err != nil) != d.wantErr {
+					t.Fatalf("delivery %d error = %v, want error %v", i, err, d.wantErr)
+				}
+			}
+
+			st, d := h.state(t, "1")
+			if st.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", st.Status, tt.wantStatus)
+			}
+			if !slices.Equal(d.Steps, tt.wantSteps) {
+				t.Errorf("steps = %v, want %v", d.Steps, tt.wantSteps)
+			}
+			if !slices.Equal(h.undone, tt.wantUndone) {
+				t.Errorf("compensations run = %v, want %v", h.undone, tt.wantUndone)
+			}
+			if st.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", st.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestOnNotStarted(t *testing.T) {
+	ctx := context.Background()
+	h := newHarness()
+
+	err := h.on(ctx, stepped{ID: "1", Step: "b"})
+	if !errors.Is(err, saga.ErrNotFound) {
+		t.Fatalf("On() before Start() error = %v, want %v", err, saga.ErrNotFound)
+	}
+	_, err = h.store.Get(ctx, "test", "1")
+	if !errors.Is(err, saga.ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, saga.ErrNotFound)
+	}
+
+	// the message is retried once the instance is started
+	err = h.start(ctx, stepped{ID: "1", Step: "a"})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	err = h.on(ctx, stepped{ID: "1", Step: "b"})
+	if err != nil {
+		t.Fatalf("On() after Start() error = %v", err)
+	}
+	st, d := h.state(t, "1")
+	if st.Step != "b" || !slices.Equal(d.Steps, []string{"a", "b"}) {
+		t.Errorf("state = step %s, steps %v, want step b, steps [a b]", st.Step, d.Steps)
+	}
+}
+
+func TestFireTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		// deadline is set by the first step, relative to now, and not set if zero
+		deadline   time.Duration
+		complete   bool
+		wantStatus saga.Status
+		wantUndone []string
+	}{
+		{name: "deadline passed", deadline: -time.Second, wantStatus: saga.StatusCompensated, wantUndone: []string{"undo-a"}},
+		{name: "deadline ahead", deadline: time.Hour, wantStatus: saga.StatusRunning},
+		{name: "no deadline", wantStatus: saga.StatusRunning},
+		{name: "completed", deadline: -time.Second, complete: true, wantStatus: saga.StatusCompleted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h := newHarness()
+			start := saga.Start(h.saga, func(m stepped) string { return m.ID }, func(_ context.Context, inst *saga.Instance[data], m stepped) error {
+				inst.AddCompensation("undo-a")
+				if tt.deadline != 0 {
+					inst.SetDeadline(time.Now().Add(tt.deadline))
+				}
+				return nil
+			})
+			err := start(ctx, stepped{ID: "1"})
+			if err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			if tt.complete {
+				err = h.on(ctx, stepped{ID: "1", Step: "done"})
+				if err != nil {
+					t.Fatalf("On() error = %v", err)
+				}
+			}
+
+			err = h.saga.FireTimeouts(ctx)
+			if err != nil {
+				t.Fatalf("FireTimeouts() error = %v", err)
+			}
+
+			st, _ := h.state(t, "1")
+			if st.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", st.Status, tt.wantStatus)
+			}
+			if !slices.Equal(h.undone, tt.wantUndone) {
+				t.Errorf("compensations run = %v, want %v", h.undone, tt.wantUndone)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPrepare is returned when a participant cannot prepare the commit, eg: because of a conflicting change.
+// The unit of work is rolled back and can be run again.
+var ErrPrepare = errors.New("preparing unit of work")
+
+// Participant is a resource that stages changes during a unit of work and applies them on commit.
+type Participant interface {
+	// Lock locks the resource, so that no one else changes it while the unit of work is committing.
+	Lock()
+	Unlock()
+	// Prepare checks, with the lock held, that the staged changes can still be applied.
+	// Whatever can fail must fail here, or in Write, before any participant commits.
+	Prepare() error
+	// Commit applies the staged changes, with the lock held.
+	Commit() error
+	// Rollback discards the staged changes.
+	Rollback()
+}
+
+// Writer is implemented by the participants that make the changes durable, eg: a database transaction.
+// Write is called once every participant prepared, and before any commits, failing the unit of work if it fails.
+// Since a write cannot be undone, a unit of work should have a single writer.
+type Writer interface {
+	Write() error
+}
+
+// UnitOfWork groups the changes made to several resources, so that they are all applied or none is.
+type UnitOfWork struct {
+	participants map[any]Participant
+	keys         []any
+	done         bool
+}
+
+type ctxKey struct{}
+
+// commits serializes the commits, so that participants can be locked in any order without deadlocks
+var commits sync.Mutex
+
+// FromContext returns the unit of work carried by the context, if it is still active.
+func FromContext(ctx context.Context) (*UnitOfWork, bool) {
+	u, ok := ctx.Value(ctxKey{}).(*UnitOfWork)
+	if !ok || u.done {
+		return nil, false
+	}
+	return u, true
+}
+
+// Run calls fn with a context carrying a unit of work, committing it if fn succeeds and rolling it back otherwise.
+// If the context already carries an active unit of work, fn joins it and the outer Run decides the outcome.
+func Run(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := FromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	u := &UnitOfWork{
+		participants: make(map[any]Participant),
+	}
+	err := fn(context.WithValue(ctx, ctxKey{}, u))
+	if err != nil {
+		u.rollback()
+		return err
+	}
+
+	return u.commit()
+}
+
+// Do is like Run but for functions that also return a value.
+func Do[T any](ctx context.Context, fn func(context.Context) (T, error)) (T, error) {
+	var result T
+	err := Run(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	return result, err
+}
+
+// Enlist returns the participant registered under key in the unit of work of the context,
+// creating and registering it if it does not exist yet.
+// The boolean is false if the context does not carry an active unit of work.
+func Enlist[P Participant](ctx context.Context, key any, create func() P) (P, bool) {
+	u, ok := FromContext(ctx)
+	if !ok {
+		var zero P
+		return zero, false
+	}
+
+	if p, ok := u.participants[key]; ok {
+		return p.(P), true
+	}
+
+	p := create()
+	u.participants[key] = p
+	u.keys = append(u.keys, key)
+	return p, true
+}
+
+func (u *UnitOfWork) rollback() {
+	u.done = true
+	for _, k := range u.keys {
+		u.participants[k].Rollback()
+	}
+}
+
+func (u *UnitOfWork) commit() error {
+	u.done = true
+
+	commits.Lock()
+	defer commits.Unlock()
+
+	for _, k := range u.keys {
+		u.participants[k].Lock()
+	}
+	defer func() {
+		for _, k := range u.keys {
+			u.participants[k].Unlock()
+		}
+	}()
+
+	for _, k := range u.keys {
+		err := u.participants[k].Prepare()
+		if err != nil {
+			u.rollback()
+			return fmt.Errorf("%w: %w", ErrPrepare, err)
+		}
+	}
+
+	for _, k := range u.keys {
+		w, ok := u.participants[k].(Writer)
+		if !ok {
+			continue
+		}
+		err := w.Write()
+		if err != nil {
+			u.rollback()
+			return fmt.Errorf("writing unit of work: %w", err)
+		}
+	}
+
+	var errs []error
+	for _, k := range u.keys {
+		err := u.participants[k].Commit()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("committing unit of work: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package uow_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/quintans/vertical-slices/internal/lib/uow"
+)
+
+var (
+	errFn      = errors.New("fn failed")
+	errPrepare = errors.New("prepare failed")
+	errWrite   = errors.New("write failed")
+)
+
+// participant logs the calls made to it
+type participant struct {
+	name       string
+	log        *[]string
+	prepareErr error
+}
+
+func (p *participant) Lock()   { *p.log = append(*p.log, "lock "+p.name) }
+func (p *participant) Unlock() { *p.log = append(*p.log, "unlock "+p.name) }
+
+func (p *participant) Prepare() error {
+	*p.log = append(*p.log, "prepare "+p.name)
+	return p.prepareErr
+}
+
+func (p *participant) Commit() error {
+	*p.log = append(*p.log, "commit "+p.name)
+	return nil
+}
+
+func (p *participant) Rollback() { *p.log = append(*p.log, "rollback "+p.name) }
+
+// writer is a participant that makes the changes durable
+type writer struct {
+	participant
+	writeErr error
+}
+
+func (w *writer) Write() error {
+	*w.log = append(*w.log, "write "+w.name)
+	return w.writeErr
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		fnErr       error
+		prepareErr  error
+		writeErr    error
+		wantErr     error
+		wantPrepare bool
+		wantLog     []string
+	}{
+		{
+			name: "committed",
+			wantLog: []string{
+				"lock a", "lock w",
+				"prepare a", "prepare w",
+				"write w",
+				"commit a", "commit w",
+				"unlock a", "unlock w",
+			},
+		},
+		{
+			name:    "fn fails",
+			fnErr:   errFn,
+			wantErr: errFn,
+			wantLog: []string{"rollback a", "rollback w"},
+		},
+		{
+			name:        "prepare fails",
+			prepareErr:  errPrepare,
+			wantErr:     errPrepare,
+			wantPrepare: true,
+			wantLog: []string{
+				"lock a", "lock w",
+				"prepare a",
+				"rollback a", "rollback w",
+				"unlock a", "unlock w",
+			},
+		},
+		{
+			name:     "write fails",
+			writeErr: errWrite,
+			wantErr:  errWrite,
+			wantLog: []string{
+				"lock a", "lock w",
+				"prepare a", "prepare w",
+				"write w",
+				"rollback a", "rollback w",
+				"unlock a", "unlock w",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log []string
+			err := uow.Run(context.Background(), func(ctx context.Context) error {
+				uow.Enlist(ctx, "a", func() *participant {
+					return &participant{name: "a", log: &log, prepareErr: tt.prepareErr}
+				})
+				uow.Enlist(ctx, "w", func() *writer {
+					return &writer{participant: participant{name: "w", log: &log}, writeErr: tt.writeErr}
+				})
+				// enlisting again joins the participant already enlisted
+				uow.Enlist(ctx, "a", func() *participant {
+					t.Error("participant enlisted twice")
+					return &participant{}
+				})
+				return tt.fnErr
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(err, uow.ErrPrepare) != tt.wantPrepare {
+				t.Errorf("Run() error = %v, want ErrPrepare %v", err, tt.wantPrepare)
+			}
+			if !slices.Equal(log, tt.wantLog) {
+				t.Errorf("calls = %v, want %v", log, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestRunJoinsOuterUnitOfWork(t *testing.T) {
+	tests := []struct {
+		name       string
+		innerErr   error
+		wantErr    error
+		wantCommit bool
+	}{
+		{name: "inner succeeds", wantCommit: true},
+		{name: "inner fails", innerErr: errFn, wantErr: errFn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log []string
+			err := uow.Run(context.Background(), func(ctx context.Context) error {
+				uow.Enlist(ctx, "a", func() *participant { return &participant{name: "a", log: &log} })
+				return uow.Run(ctx, func(ctx context.Context) error {
+					// the inner run neither commits nor rolls back
+					if len(log) > 0 {
+						t.Errorf("calls before the outer run ended = %v", log)
+					}
+					return tt.innerErr
+				})
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := slices.Contains(log, "commit a"); got != tt.wantCommit {
+				t.Errorf("committed = %v, want %v, calls = %v", got, tt.wantCommit, log)
+			}
+		})
+	}
+}
+
+func TestEnlistWithoutUnitOfWork(t *testing.T) {
+	_, ok := uow.Enlist(context.Background(), "a", func() *participant { return &participant{} })
+	if ok {
+		t.Error("Enlist() without a unit of work = true, want false")
+	}
+}
@@ -11,3 +11,9 @@ import (
 type Publisher interface {
 	Publish(ctx context.Context, m ...eventbus.Message) error
 }
+
+// Outbox stores messages, in their envelopes, to be published once the unit of work that produced them is saved
+// This is declared in the shared package because it will be used accros all slices
+type Outbox interface {
+	Add(ctx context.Context, envs ...eventbus.Envelope) error
+}
@@ -0,0 +1,45 @@
+package etag
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+// ErrInvalid is returned for an If-Match header that is not an entity tag
+var ErrInvalid = errors.New("invalid entity tag")
+
+// Format returns the entity tag of an aggregate version, to be used in the ETag header.
+func Format(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// Parse returns the aggregate version in an If-Match header.
+// An empty header or * match any version, and are returned as 0.
+// If-Match compares the tags strongly (RFC 9110, 13.1.1), so a weak tag never matches and fails with fails.ErrPreconditionFailed,
+// and so does a list of tags, since a change expects a single version.
+func Parse(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	if strings.HasPrefix(header, "W/") {
+		return 0, fmt.Errorf("weak entity tag '%s' never matches: %w", header, fails.ErrPreconditionFailed)
+	}
+	if strings.Contains(header, ",") {
+		return 0, fmt.Errorf("list of entity tags '%s' is not supported: %w", header, fails.ErrPreconditionFailed)
+	}
+
+	tag, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, fmt.Errorf("'%s': %w", header, ErrInvalid)
+	}
+	version, err := strconv.Atoi(tag)
+	if err != nil {
+		return 0, fmt.Errorf("'%s': %w", header, ErrInvalid)
+	}
+	return version, nil
+}
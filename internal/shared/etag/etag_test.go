@@ -0,0 +1,48 @@
+package etag_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/quintans/vertical-slices/internal/shared/etag"
+	"github.com/quintans/vertical-slices/internal/shared/fails"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    int
+		wantErr error
+	}{
+		{name: "version", header: `"3"`, want: 3},
+		{name: "surrounding spaces", header: ` "3" `, want: 3},
+		{name: "empty", header: "", want: 0},
+		{name: "any", header: "*", want: 0},
+		{name: "unquoted", header: "3", wantErr: etag.ErrInvalid},
+		{name: "not a version", header: `"abc"`, wantErr: etag.ErrInvalid},
+		{name: "weak", header: `W/"3"`, wantErr: fails.ErrPreconditionFailed},
+		{name: "list", header: `"3", "4"`, wantErr: fails.ErrPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := etag.Parse(tt.header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%s) error = %v, want %v", tt.header, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%s) = %d, want %d", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatParse(t *testing.T) {
+	for _, version := range []int{1, 42} {
+		got, err := etag.Parse(etag.Format(version))
+		if err != nil || got != version {
+			t.Errorf("Parse(Format(%d)) = %d, %v, want %d", version, got, err, version)
+		}
+	}
+}
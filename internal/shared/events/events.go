@@ -1,13 +1,181 @@
 package events
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type OrderCreated struct {
-	ID        uuid.UUID
+	ID    uuid.UUID
+	Lines []OrderLine
+	Total float64
+}
+
+type OrderLine struct {
 	ProductID uuid.UUID
 	Quantity  int
+	UnitPrice float64
 }
 
 func (e OrderCreated) Kind() string {
 	return "OrderCreated"
 }
+
+type OrderConfirmed struct {
+	ID    uuid.UUID
+	Lines []OrderLine
+}
+
+func (e OrderConfirmed) Kind() string {
+	return "OrderConfirmed"
+}
+
+type OrderPaid struct {
+	ID uuid.UUID
+}
+
+func (e OrderPaid) Kind() string {
+	return "OrderPaid"
+}
+
+type OrderShipped struct {
+	ID uuid.UUID
+}
+
+func (e OrderShipped) Kind() string {
+	return "OrderShipped"
+}
+
+type OrderDelivered struct {
+	ID uuid.UUID
+}
+
+func (e OrderDelivered) Kind() string {
+	return "OrderDelivered"
+}
+
+type OrderCancelled struct {
+	ID    uuid.UUID
+	Lines []OrderLine
+}
+
+func (e OrderCancelled) Kind() string {
+	return "OrderCancelled"
+}
+
+type OrderDeleted struct {
+	ID uuid.UUID
+}
+
+func (e OrderDeleted) Kind() string {
+	return "OrderDeleted"
+}
+
+type OrderRefunded struct {
+	ID uuid.UUID
+}
+
+func (e OrderRefunded) Kind() string {
+	return "OrderRefunded"
+}
+
+type StockReserved struct {
+	ID        uuid.UUID
+	OrderID   uuid.UUID
+	Quantity  int
+	ExpiresAt time.Time
+}
+
+func (e StockReserved) Kind() string {
+	return "StockReserved"
+}
+
+type ReservationCommitted struct {
+	ID       uuid.UUID
+	OrderID  uuid.UUID
+	Quantity int
+	// Stock is the quantity in stock after the commit
+	Stock int
+}
+
+func (e ReservationCommitted) Kind() string {
+	return "ReservationCommitted"
+}
+
+type ReservationReleased struct {
+	ID       uuid.UUID
+	OrderID  uuid.UUID
+	Quantity int
+	// Reason is either cancelled or expired
+	Reason string
+}
+
+func (e ReservationReleased) Kind() string {
+	return "ReservationReleased"
+}
+
+type StockReturned struct {
+	ID       uuid.UUID
+	OrderID  uuid.UUID
+	Quantity int
+	// Stock is the quantity in stock after the return
+	Stock int
+}
+
+func (e StockReturned) Kind() string {
+	return "StockReturned"
+}
+
+type ProductCreated struct {
+	ID    uuid.UUID
+	SKU   string
+	Name  string
+	Price float64
+}
+
+func (e ProductCreated) Kind() string {
+	return "ProductCreated"
+}
+
+type ProductRenamed struct {
+	ID   uuid.UUID
+	Name string
+}
+
+func (e ProductRenamed) Kind() string {
+	return "ProductRenamed"
+}
+
+type PriceChanged struct {
+	ID       uuid.UUID
+	OldPrice float64
+	NewPrice float64
+}
+
+func (e PriceChanged) Kind() string {
+	return "PriceChanged"
+}
+
+type ProductRestocked struct {
+	ID       uuid.UUID
+	Quantity int
+	// Stock is the quantity in stock after restocking
+	Stock int
+}
+
+func (e ProductRestocked) Kind() string {
+	return "ProductRestocked"
+}
+
+type StockAdjusted struct {
+	ID     uuid.UUID
+	Delta  int
+	Reason string
+	// Stock is the quantity in stock after the adjustment
+	Stock int
+}
+
+func (e StockAdjusted) Kind() string {
+	return "StockAdjusted"
+}
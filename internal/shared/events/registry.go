@@ -0,0 +1,26 @@
+package events
+
+import "github.com/quintans/vertical-slices/internal/lib/eventbus"
+
+// NewRegistry returns a registry with all the events shared between slices
+func NewRegistry() *eventbus.Registry {
+	r := eventbus.NewRegistry()
+	eventbus.RegisterKind[OrderCreated](r)
+	eventbus.RegisterKind[OrderConfirmed](r)
+	eventbus.RegisterKind[OrderPaid](r)
+	eventbus.RegisterKind[OrderShipped](r)
+	eventbus.RegisterKind[OrderDelivered](r)
+	eventbus.RegisterKind[OrderCancelled](r)
+	eventbus.RegisterKind[OrderRefunded](r)
+	eventbus.RegisterKind[OrderDeleted](r)
+	eventbus.RegisterKind[ProductCreated](r)
+	eventbus.RegisterKind[ProductRenamed](r)
+	eventbus.RegisterKind[PriceChanged](r)
+	eventbus.RegisterKind[ProductRestocked](r)
+	eventbus.RegisterKind[StockAdjusted](r)
+	eventbus.RegisterKind[StockReserved](r)
+	eventbus.RegisterKind[ReservationCommitted](r)
+	eventbus.RegisterKind[ReservationReleased](r)
+	eventbus.RegisterKind[StockReturned](r)
+	return r
+}
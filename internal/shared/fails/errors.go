@@ -4,3 +4,7 @@ import "errors"
 
 var ErrNotFound = errors.New("not found")
 var ErrAlreadyExists = errors.New("already exists")
+var ErrConcurrencyConflict = errors.New("concurrency conflict")
+
+// ErrPreconditionFailed is returned when the version the client expects, eg: in If-Match, is not the current one
+var ErrPreconditionFailed = errors.New("precondition failed")
@@ -0,0 +1,38 @@
+// Package keys declares the dependencies shared by every module, provided by the infrastructure.
+// The dependencies of a slice are declared in the slice itself.
+package keys
+
+import (
+	"database/sql"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/quintans/vertical-slices/internal/infra"
+	"github.com/quintans/vertical-slices/internal/lib/eventbus"
+	"github.com/quintans/vertical-slices/internal/lib/idempotency"
+	"github.com/quintans/vertical-slices/internal/lib/mediator"
+	"github.com/quintans/vertical-slices/internal/lib/module"
+	"github.com/quintans/vertical-slices/internal/lib/problem"
+	"github.com/quintans/vertical-slices/internal/lib/projection"
+	"github.com/quintans/vertical-slices/internal/lib/saga"
+	"github.com/quintans/vertical-slices/internal/shared"
+)
+
+var (
+	// API is where the modules register their routes
+	API = module.NewKey[huma.API]("api")
+	// Errors is where the modules map their errors to HTTP problems
+	Errors      = module.NewKey[*problem.Mapper]("errors")
+	Mediator    = module.NewKey[*mediator.Mediator]("mediator")
+	EventBus    = module.NewKey[*eventbus.Bus]("event-bus")
+	Outbox      = module.NewKey[shared.Outbox]("outbox")
+	Idempotency = module.NewKey[idempotency.Store]("idempotency")
+	SagaStore   = module.NewKey[saga.Store]("saga-store")
+	// Projections is where the modules add their read models, to be rebuilt on demand
+	Projections = module.NewKey[*projection.Registry]("projections")
+	// Checkpoint tells whether the read models caught up with the committed changes
+	Checkpoint = module.NewKey[projection.Checkpoint]("projection-checkpoint")
+	// SQL is only provided by the sqlite storage backend
+	SQL = module.NewKey[*sql.DB]("sql")
+	// Journal is only provided by the file storage backend
+	Journal = module.NewKey[*infra.Journal]("journal")
+)
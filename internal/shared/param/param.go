@@ -0,0 +1,37 @@
+package param
+
+import (
+	"reflect"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Optional is a request parameter that can be left out, eg: a filter, unlike the plain ones that default to their zero value.
+type Optional[T any] struct {
+	Value T
+	IsSet bool
+}
+
+// Schema documents the parameter as a T.
+func (o Optional[T]) Schema(r huma.Registry) *huma.Schema {
+	return huma.SchemaFromType(r, reflect.TypeOf(o.Value))
+}
+
+// Receiver lets the API parse the parameter into Value.
+func (o *Optional[T]) Receiver() reflect.Value {
+	return reflect.ValueOf(o).Elem().Field(0)
+}
+
+// OnParamSet records whether the parameter was in the request.
+func (o *Optional[T]) OnParamSet(isSet bool, _ any) {
+	o.IsSet = isSet
+}
+
+// Ptr returns the value, or nil if the parameter was left out.
+func (o Optional[T]) Ptr() *T {
+	if !o.IsSet {
+		return nil
+	}
+	v := o.Value
+	return &v
+}